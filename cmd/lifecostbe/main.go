@@ -16,14 +16,35 @@ import (
 func main() {
 	var reBuild bool
 
+	var importRates string
+
+	var migrateSQLite string
+
+	var backup, restore string
+
+	var repair, migrateSchema, encryptData, dryRun bool
+
 	flag.BoolVar(&reBuild, "re-build", false, "rebuild statistics")
+	flag.StringVar(&importRates, "import-rates", "", "import exchange rates from csv file: date(YYYYMMDD),from,to,rate")
+	flag.StringVar(&migrateSQLite, "migrate-sqlite", "", "import the data directory into the empty sqlite database file")
+	flag.BoolVar(&repair, "repair", false, "check the bill files, quarantine malformed lines and fix the files")
+	flag.BoolVar(&migrateSchema, "migrate-schema", false, "upgrade the data to the current schema version")
+	flag.BoolVar(&encryptData, "encrypt-data", false, "encrypt the plaintext data directory with the configured key")
+	flag.StringVar(&backup, "backup", "", "write the backup archive of the data directory to the file")
+	flag.StringVar(&restore, "restore", "", "validate the backup archive file and replace the data directory with it")
+	flag.BoolVar(&dryRun, "dry-run", false, "with -repair, -migrate-schema or -restore: only report, write nothing")
 	flag.Parse()
 
 	logger := l.NewWrapper(liblogrus.NewLogrusEx(logrus.New()))
 	logger.GetLogger().SetLevel(l.LevelDebug)
 
+	var cfg config.Config
+	_, _ = libconfig.Load("config.yaml", &cfg)
+
+	_ = cfg.Valid() // fills the defaults, NewServer reports an invalid config
+
 	if reBuild {
-		err := server.RebuildBills()
+		err := server.RebuildBills(&cfg)
 		if err != nil {
 			logger.WithFields(l.ErrorField(err)).Fatal("rebuild bills failed")
 		} else {
@@ -33,8 +54,92 @@ func main() {
 		return
 	}
 
-	var cfg config.Config
-	_, _ = libconfig.Load("config.yaml", &cfg)
+	if importRates != "" {
+		count, err := server.ImportExchangeRates(&cfg, importRates)
+		if err != nil {
+			logger.WithFields(l.ErrorField(err)).Fatal("import exchange rates failed")
+		} else {
+			logger.WithFields(l.IntField("count", count)).Info("import exchange rates success")
+		}
+
+		return
+	}
+
+	if migrateSQLite != "" {
+		count, err := server.MigrateToSQLite(migrateSQLite, logger)
+		if err != nil {
+			logger.WithFields(l.ErrorField(err)).Fatal("migrate to sqlite failed")
+		} else {
+			logger.WithFields(l.IntField("bills", count)).Info("migrate to sqlite success")
+		}
+
+		return
+	}
+
+	if repair {
+		report, err := server.RepairBills(&cfg, dryRun, logger)
+		if err != nil {
+			logger.WithFields(l.ErrorField(err)).Fatal("repair bills failed")
+		}
+
+		for _, problem := range report.Problems {
+			logger.WithFields(l.StringField("file", problem.File), l.IntField("badLines", problem.BadLines),
+				l.BoolField("broken", problem.Broken), l.BoolField("unsorted", problem.Unsorted),
+				l.BoolField("repaired", problem.Repaired)).Warn("bill file problem")
+		}
+
+		logger.WithFields(l.IntField("files", report.Files), l.IntField("bills", report.Bills),
+			l.IntField("problems", len(report.Problems))).Info("repair bills finished")
+
+		return
+	}
+
+	if migrateSchema {
+		report, err := server.MigrateSchema(&cfg, dryRun, logger)
+		if err != nil {
+			logger.WithFields(l.ErrorField(err)).Fatal("migrate schema failed")
+		}
+
+		logger.WithFields(l.IntField("from", report.FromVersion), l.IntField("to", report.ToVersion),
+			l.IntField("steps", len(report.Steps)), l.BoolField("dryRun", dryRun)).Info("migrate schema finished")
+
+		return
+	}
+
+	if encryptData {
+		count, err := server.EncryptData(&cfg, logger)
+		if err != nil {
+			logger.WithFields(l.ErrorField(err)).Fatal("encrypt data failed")
+		}
+
+		logger.WithFields(l.IntField("files", count)).Info("encrypt data success")
+
+		return
+	}
+
+	if backup != "" {
+		manifest, err := server.Backup(&cfg, backup)
+		if err != nil {
+			logger.WithFields(l.ErrorField(err)).Fatal("backup failed")
+		}
+
+		logger.WithFields(l.StringField("archive", backup), l.IntField("files", len(manifest.Files))).
+			Info("backup success")
+
+		return
+	}
+
+	if restore != "" {
+		manifest, err := server.Restore(&cfg, restore, dryRun, logger)
+		if err != nil {
+			logger.WithFields(l.ErrorField(err)).Fatal("restore failed")
+		}
+
+		logger.WithFields(l.StringField("archive", restore), l.IntField("files", len(manifest.Files)),
+			l.Int64Field("createdAt", manifest.CreatedAt), l.BoolField("dryRun", dryRun)).Info("restore success")
+
+		return
+	}
 
 	cfg.AccountConfig.TokenSignKey = "x"
 	cfg.AccountConfig.PasswordHashIterCount = 100
@@ -1,14 +1,125 @@
 package config
 
-import "github.com/sgostarter/libcomponents/account"
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sgostarter/libcomponents/account"
+)
+
+const (
+	StorageFile   = "file"
+	StorageSQLite = "sqlite"
+
+	defaultSQLiteFile = "data/lifecost.db"
+
+	EncryptionKeyEnv = "LIFECOST_ENCRYPTION_KEY"
+
+	encryptionKeySize = 32
+)
 
 type Config struct {
 	Debug  bool   `yaml:"debug" json:"debug"`
 	Listen string `yaml:"listen" json:"listen"`
 
+	Storage    string `yaml:"storage" json:"storage"`       // file(default) or sqlite
+	SQLiteFile string `yaml:"sqliteFile" json:"sqliteFile"` // default data/lifecost.db
+
+	// 0: default 64; bill day files kept open for appending, idle ones are closed
+	MaxOpenBillFiles int `yaml:"maxOpenBillFiles" json:"maxOpenBillFiles"`
+
+	// the data directory is encrypted if a key is set in the env LIFECOST_ENCRYPTION_KEY or in this file:
+	// 32 bytes, raw or in base64/hex. Only the file storage supports it
+	EncryptionKeyFile string `yaml:"encryptionKeyFile" json:"encryptionKeyFile"`
+
+	// 0: keep deleted records forever; > 0: they are purged after these days
+	DeletedRecordRetentionDays int `yaml:"deletedRecordRetentionDays" json:"deletedRecordRetentionDays"`
+
+	// the users allowed to call the /admin endpoints, e.g. backup
+	AdminUserNames []string `yaml:"adminUserNames" json:"adminUserNames"`
+
 	AccountConfig account.Config `yaml:"accountConfig" json:"accountConfig"`
 }
 
 func (cfg *Config) Valid() bool {
+	if cfg.Storage == "" {
+		cfg.Storage = StorageFile
+	}
+
+	if cfg.Storage != StorageFile && cfg.Storage != StorageSQLite {
+		return false
+	}
+
+	if cfg.SQLiteFile == "" {
+		cfg.SQLiteFile = defaultSQLiteFile
+	}
+
+	if cfg.Storage == StorageSQLite && cfg.EncryptionEnabled() {
+		return false
+	}
+
 	return cfg.Listen != ""
 }
+
+// DeletedRecordRetention returns how long deleted records are kept, 0 means forever.
+func (cfg *Config) DeletedRecordRetention() time.Duration {
+	if cfg.DeletedRecordRetentionDays <= 0 {
+		return 0
+	}
+
+	return time.Hour * 24 * time.Duration(cfg.DeletedRecordRetentionDays)
+}
+
+func (cfg *Config) EncryptionEnabled() bool {
+	return os.Getenv(EncryptionKeyEnv) != "" || cfg.EncryptionKeyFile != ""
+}
+
+// EncryptionKey returns the data encryption key, nil if the data is not encrypted.
+func (cfg *Config) EncryptionKey() ([]byte, error) {
+	if key := os.Getenv(EncryptionKeyEnv); key != "" {
+		return decodeEncryptionKey([]byte(key))
+	}
+
+	if cfg.EncryptionKeyFile == "" {
+		return nil, nil
+	}
+
+	d, err := os.ReadFile(cfg.EncryptionKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(d) == encryptionKeySize {
+		return d, nil
+	}
+
+	return decodeEncryptionKey(d)
+}
+
+func decodeEncryptionKey(d []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(d))
+
+	if key, err := hex.DecodeString(text); err == nil && len(key) == encryptionKeySize {
+		return key, nil
+	}
+
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == encryptionKeySize {
+		return key, nil
+	}
+
+	return nil, errors.New("the encryption key must be 32 bytes, in base64 or hex")
+}
+
+func (cfg *Config) IsAdmin(userName string) bool {
+	for _, adminUserName := range cfg.AdminUserNames {
+		if adminUserName == userName {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,8 @@
+package model
+
+type Attachment struct {
+	ID          string `json:"id"` // sha256 of the content
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"golang.org/x/exp/slices"
+)
+
+type SplitMode int
+
+const (
+	SplitModeEqual SplitMode = iota + 1
+	SplitModeShare
+	SplitModeAmount
+)
+
+type SplitShare struct {
+	PersonID uint64 `json:"personID"`
+	Share    int    `json:"share,omitempty"` // SplitModeShare: weight
+	Amount   int    `json:"amount"`          // owed amount, resolved from the mode
+}
+
+// BillSplit tells how the payer (the person of the from wallet) shares the bill amount with group members.
+type BillSplit struct {
+	Mode   SplitMode    `json:"mode"`
+	Shares []SplitShare `json:"shares"`
+}
+
+// Resolve fills the owed amount of each share so that they sum up to total.
+func (split *BillSplit) Resolve(total int) bool {
+	if len(split.Shares) == 0 || total <= 0 {
+		return false
+	}
+
+	personIDs := make([]uint64, 0, len(split.Shares))
+
+	for _, share := range split.Shares {
+		if share.PersonID == 0 || slices.Contains(personIDs, share.PersonID) {
+			return false
+		}
+
+		personIDs = append(personIDs, share.PersonID)
+	}
+
+	switch split.Mode {
+	case SplitModeEqual:
+		for idx := range split.Shares {
+			split.Shares[idx].Share = 1
+		}
+
+		return split.resolveByShare(total)
+	case SplitModeShare:
+		return split.resolveByShare(total)
+	case SplitModeAmount:
+		var sum int
+
+		for _, share := range split.Shares {
+			if share.Amount < 0 {
+				return false
+			}
+
+			sum += share.Amount
+		}
+
+		return sum == total
+	}
+
+	return false
+}
+
+func (split *BillSplit) resolveByShare(total int) bool {
+	var totalShare int
+
+	for _, share := range split.Shares {
+		if share.Share <= 0 {
+			return false
+		}
+
+		totalShare += share.Share
+	}
+
+	var sum int
+
+	for idx := range split.Shares {
+		split.Shares[idx].Amount = total * split.Shares[idx].Share / totalShare
+		sum += split.Shares[idx].Amount
+	}
+
+	// the remainder (less than len(Shares)) goes one by one to the first shares
+	for idx := 0; sum < total; idx = (idx + 1) % len(split.Shares) {
+		split.Shares[idx].Amount++
+		sum++
+	}
+
+	return true
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBillSplitResolve(t *testing.T) {
+	cases := []struct {
+		name    string
+		split   BillSplit
+		total   int
+		ok      bool
+		amounts []int
+	}{
+		{
+			name:    "equal",
+			split:   BillSplit{Mode: SplitModeEqual, Shares: []SplitShare{{PersonID: 1}, {PersonID: 2}, {PersonID: 3}}},
+			total:   300,
+			ok:      true,
+			amounts: []int{100, 100, 100},
+		},
+		{
+			name:    "equal remainder goes to the first shares",
+			split:   BillSplit{Mode: SplitModeEqual, Shares: []SplitShare{{PersonID: 1}, {PersonID: 2}, {PersonID: 3}}},
+			total:   101,
+			ok:      true,
+			amounts: []int{34, 34, 33},
+		},
+		{
+			name: "share weights",
+			split: BillSplit{Mode: SplitModeShare, Shares: []SplitShare{
+				{PersonID: 1, Share: 1}, {PersonID: 2, Share: 3},
+			}},
+			total:   100,
+			ok:      true,
+			amounts: []int{25, 75},
+		},
+		{
+			name: "share without weight",
+			split: BillSplit{Mode: SplitModeShare, Shares: []SplitShare{
+				{PersonID: 1, Share: 1}, {PersonID: 2},
+			}},
+			total: 100,
+		},
+		{
+			name: "amounts summing up to total",
+			split: BillSplit{Mode: SplitModeAmount, Shares: []SplitShare{
+				{PersonID: 1, Amount: 30}, {PersonID: 2, Amount: 70},
+			}},
+			total:   100,
+			ok:      true,
+			amounts: []int{30, 70},
+		},
+		{
+			name: "amounts not summing up to total",
+			split: BillSplit{Mode: SplitModeAmount, Shares: []SplitShare{
+				{PersonID: 1, Amount: 30}, {PersonID: 2, Amount: 60},
+			}},
+			total: 100,
+		},
+		{
+			name: "negative amount",
+			split: BillSplit{Mode: SplitModeAmount, Shares: []SplitShare{
+				{PersonID: 1, Amount: -10}, {PersonID: 2, Amount: 110},
+			}},
+			total: 100,
+		},
+		{
+			name:  "duplicated person",
+			split: BillSplit{Mode: SplitModeEqual, Shares: []SplitShare{{PersonID: 1}, {PersonID: 1}}},
+			total: 100,
+		},
+		{
+			name:  "zero person",
+			split: BillSplit{Mode: SplitModeEqual, Shares: []SplitShare{{PersonID: 0}}},
+			total: 100,
+		},
+		{
+			name:  "no shares",
+			split: BillSplit{Mode: SplitModeEqual},
+			total: 100,
+		},
+		{
+			name:  "zero total",
+			split: BillSplit{Mode: SplitModeEqual, Shares: []SplitShare{{PersonID: 1}}},
+		},
+		{
+			name:  "unknown mode",
+			split: BillSplit{Mode: 0, Shares: []SplitShare{{PersonID: 1}}},
+			total: 100,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ok := c.split.Resolve(c.total)
+			assert.EqualValues(t, c.ok, ok)
+
+			if !c.ok {
+				return
+			}
+
+			amounts := make([]int, 0, len(c.split.Shares))
+			for _, share := range c.split.Shares {
+				amounts = append(amounts, share.Amount)
+			}
+
+			assert.EqualValues(t, c.amounts, amounts)
+		})
+	}
+}
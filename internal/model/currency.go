@@ -0,0 +1,45 @@
+package model
+
+import "strings"
+
+const (
+	DefaultCurrency = "CNY"
+)
+
+type ExchangeRate struct {
+	From string  `json:"from"`
+	To   string  `json:"to"`
+	Date string  `json:"date"` // YYYYMMDD, effective from this date on
+	Rate float64 `json:"rate"` // 1 From = Rate To
+}
+
+func (rate *ExchangeRate) Valid() bool {
+	rate.From = strings.ToUpper(rate.From)
+	rate.To = strings.ToUpper(rate.To)
+
+	return ValidCurrency(rate.From) && ValidCurrency(rate.To) && rate.From != rate.To &&
+		len(rate.Date) == 8 && rate.Rate > 0
+}
+
+// ValidCurrency checks an ISO 4217 style code, e.g. CNY, USD.
+func ValidCurrency(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+
+	for _, c := range currency {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func CurrencyOrDefault(currency string) string {
+	if currency == "" {
+		return DefaultCurrency
+	}
+
+	return currency
+}
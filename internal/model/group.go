@@ -5,4 +5,5 @@ type Group struct {
 	Name            string   `json:"name"`
 	MemberPersonIDs []uint64 `json:"memberPersonIDs"`
 	AdminPersonIDs  []uint64 `json:"adminPersonIDs"`
+	BaseCurrency    string   `json:"baseCurrency,omitempty"` // empty: DefaultCurrency
 }
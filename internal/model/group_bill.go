@@ -14,14 +14,21 @@ type GroupBill struct {
 	ID                string   `json:"id"`
 	FromSubWalletID   uint64   `json:"fromSubWalletID"`
 	ToSubWalletID     uint64   `json:"toSubWalletID"`
-	CostDir           CostDir  `json:"coastDir"`
+	CostDir           CostDir  `json:"costDir"`
 	Amount            int      `json:"amount"`
+	Currency          string   `json:"currency,omitempty"`   // empty: DefaultCurrency
+	BaseAmount        int      `json:"baseAmount,omitempty"` // Amount in the group base currency, set when Currency differs from it
 	LabelIDs          []uint64 `json:"labelIDs"`
 	Remark            string   `json:"remark"`
 	LossAmount        int      `json:"lossAmount"`
 	LossWalletID      uint64   `json:"lossWalletID"`
 	At                int64    `json:"at"`
 	OperationPersonID uint64   `json:"operationPersonID"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	Split      *BillSplit `json:"split,omitempty"`
+	Settlement bool       `json:"settlement,omitempty"` // in group transfer settling split bills
 }
 
 func (gb *GroupBill) Valid() bool {
@@ -37,7 +44,17 @@ func (gb *GroupBill) Valid() bool {
 	return true
 }
 
+// StatAmount is the amount accumulated by statistics.
+func (gb *GroupBill) StatAmount() int {
+	if gb.BaseAmount != 0 {
+		return gb.BaseAmount
+	}
+
+	return gb.Amount
+}
+
 type DeletedGroupBill struct {
 	GroupBill `json:",inline"`
 	DeletedAt time.Time `json:"deletedAt"`
+	DeletedBy uint64    `json:"deletedBy,omitempty"` // the person who deleted it, 0 for the history before it is kept
 }
@@ -0,0 +1,111 @@
+package model
+
+import "time"
+
+type RecurringSchedule int
+
+const (
+	RecurringScheduleDaily RecurringSchedule = iota + 1
+	RecurringScheduleWeekly
+	RecurringScheduleMonthly
+	RecurringScheduleYearly
+)
+
+type RecurringRule struct {
+	ID       uint64 `json:"id"`
+	PersonID uint64 `json:"personID"`
+	Name     string `json:"name"`
+
+	FromSubWalletID uint64   `json:"fromSubWalletID"`
+	ToSubWalletID   uint64   `json:"toSubWalletID"`
+	Amount          int      `json:"amount"`
+	Currency        string   `json:"currency,omitempty"`
+	LabelIDs        []uint64 `json:"labelIDs"`
+	Remark          string   `json:"remark"`
+	LossAmount      int      `json:"lossAmount"`
+	LossWalletID    uint64   `json:"lossWalletID"`
+
+	Schedule RecurringSchedule `json:"schedule"`
+	Month    int               `json:"month"` // yearly: 1-12
+	Day      int               `json:"day"`   // weekly: 0(Sunday)-6; monthly/yearly: 1-31, clamped to the last day of month
+	Hour     int               `json:"hour"`
+	Minute   int               `json:"minute"`
+
+	Paused    bool  `json:"paused"`
+	StartAt   int64 `json:"startAt"`
+	LastRunAt int64 `json:"lastRunAt"`
+}
+
+func (rule *RecurringRule) Valid() bool {
+	if rule.PersonID == 0 || rule.FromSubWalletID == 0 || rule.ToSubWalletID == 0 || rule.Amount <= 0 {
+		return false
+	}
+
+	if rule.Hour < 0 || rule.Hour > 23 || rule.Minute < 0 || rule.Minute > 59 {
+		return false
+	}
+
+	switch rule.Schedule {
+	case RecurringScheduleDaily:
+	case RecurringScheduleWeekly:
+		if rule.Day < 0 || rule.Day > 6 {
+			return false
+		}
+	case RecurringScheduleMonthly:
+		if rule.Day < 1 || rule.Day > 31 {
+			return false
+		}
+	case RecurringScheduleYearly:
+		if rule.Month < 1 || rule.Month > 12 || rule.Day < 1 || rule.Day > 31 {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if rule.StartAt <= 0 {
+		rule.StartAt = time.Now().Unix()
+	}
+
+	return true
+}
+
+// NextAt returns the first time strictly after `after` the rule is due, or zero time for an invalid rule.
+func (rule *RecurringRule) NextAt(after time.Time) time.Time {
+	d := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, after.Location())
+
+	for idx := 0; idx <= 366*4; idx++ {
+		at := time.Date(d.Year(), d.Month(), d.Day(), rule.Hour, rule.Minute, 0, 0, d.Location())
+		if at.After(after) && rule.matchDay(at) {
+			return at
+		}
+
+		d = d.AddDate(0, 0, 1)
+	}
+
+	return time.Time{}
+}
+
+func (rule *RecurringRule) matchDay(t time.Time) bool {
+	fnMonthDay := func() int {
+		lastDay := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+		if rule.Day > lastDay {
+			return lastDay
+		}
+
+		return rule.Day
+	}
+
+	switch rule.Schedule {
+	case RecurringScheduleDaily:
+		return true
+	case RecurringScheduleWeekly:
+		return int(t.Weekday()) == rule.Day
+	case RecurringScheduleMonthly:
+		return t.Day() == fnMonthDay()
+	case RecurringScheduleYearly:
+		return int(t.Month()) == rule.Month && t.Day() == fnMonthDay()
+	}
+
+	return false
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecurringRuleNextAt(t *testing.T) {
+	fnAt := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.Local)
+	}
+
+	cases := []struct {
+		name  string
+		rule  RecurringRule
+		after time.Time
+		next  time.Time
+	}{
+		{
+			name:  "daily later today",
+			rule:  RecurringRule{Schedule: RecurringScheduleDaily, Hour: 9, Minute: 30},
+			after: fnAt(2023, 11, 10, 8, 0),
+			next:  fnAt(2023, 11, 10, 9, 30),
+		},
+		{
+			name:  "daily at the due time is strictly after",
+			rule:  RecurringRule{Schedule: RecurringScheduleDaily, Hour: 9, Minute: 30},
+			after: fnAt(2023, 11, 10, 9, 30),
+			next:  fnAt(2023, 11, 11, 9, 30),
+		},
+		{
+			name:  "weekly",
+			rule:  RecurringRule{Schedule: RecurringScheduleWeekly, Day: int(time.Monday)},
+			after: fnAt(2023, 11, 10, 0, 0), // Friday
+			next:  fnAt(2023, 11, 13, 0, 0),
+		},
+		{
+			name:  "monthly 31st clamped to february",
+			rule:  RecurringRule{Schedule: RecurringScheduleMonthly, Day: 31},
+			after: fnAt(2023, 1, 31, 12, 0),
+			next:  fnAt(2023, 2, 28, 0, 0),
+		},
+		{
+			name:  "monthly 31st clamped to leap february",
+			rule:  RecurringRule{Schedule: RecurringScheduleMonthly, Day: 31},
+			after: fnAt(2024, 1, 31, 12, 0),
+			next:  fnAt(2024, 2, 29, 0, 0),
+		},
+		{
+			name:  "monthly 31st after the clamped day",
+			rule:  RecurringRule{Schedule: RecurringScheduleMonthly, Day: 31},
+			after: fnAt(2023, 2, 28, 12, 0),
+			next:  fnAt(2023, 3, 31, 0, 0),
+		},
+		{
+			name:  "monthly 31st clamped to 30 days month",
+			rule:  RecurringRule{Schedule: RecurringScheduleMonthly, Day: 31, Hour: 8},
+			after: fnAt(2023, 4, 1, 0, 0),
+			next:  fnAt(2023, 4, 30, 8, 0),
+		},
+		{
+			name:  "yearly leap day clamped",
+			rule:  RecurringRule{Schedule: RecurringScheduleYearly, Month: 2, Day: 29},
+			after: fnAt(2023, 1, 1, 0, 0),
+			next:  fnAt(2023, 2, 28, 0, 0),
+		},
+		{
+			name:  "yearly leap day",
+			rule:  RecurringRule{Schedule: RecurringScheduleYearly, Month: 2, Day: 29},
+			after: fnAt(2023, 3, 1, 0, 0),
+			next:  fnAt(2024, 2, 29, 0, 0),
+		},
+		{
+			name:  "invalid schedule",
+			rule:  RecurringRule{},
+			after: fnAt(2023, 1, 1, 0, 0),
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+
+		t.Run(c.name, func(t *testing.T) {
+			assert.True(t, c.next.Equal(c.rule.NextAt(c.after)), c.rule.NextAt(c.after))
+		})
+	}
+}
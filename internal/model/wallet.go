@@ -4,4 +4,5 @@ type Wallet struct {
 	ID       uint64 `json:"id"`
 	Name     string `json:"name"`
 	PersonID uint64 `json:"personID"`
+	Currency string `json:"currency,omitempty"` // empty: DefaultCurrency
 }
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sgostarter/libcomponents/account"
+)
+
+// quiescedAccountStorage lets the backup block the account writes, the token checks renew tokens,
+// so every call is treated as a writer.
+type quiescedAccountStorage struct {
+	lock    sync.RWMutex // held for read by the calls, for write by quiesce
+	storage account.Storage
+}
+
+func newQuiescedAccountStorage(storage account.Storage) *quiescedAccountStorage {
+	return &quiescedAccountStorage{
+		storage: storage,
+	}
+}
+
+func (impl *quiescedAccountStorage) quiesce(fn func() error) error {
+	impl.lock.Lock()
+	defer impl.lock.Unlock()
+
+	return fn()
+}
+
+func (impl *quiescedAccountStorage) AddAccount(accountName, hashedPassword string) (uid uint64, err error) {
+	impl.lock.RLock()
+	defer impl.lock.RUnlock()
+
+	return impl.storage.AddAccount(accountName, hashedPassword)
+}
+
+func (impl *quiescedAccountStorage) SetHashedPassword(accountName, hashedPassword string) (err error) {
+	impl.lock.RLock()
+	defer impl.lock.RUnlock()
+
+	return impl.storage.SetHashedPassword(accountName, hashedPassword)
+}
+
+func (impl *quiescedAccountStorage) FindAccount(accountName string) (uid uint64, hashedPassword string, err error) {
+	impl.lock.RLock()
+	defer impl.lock.RUnlock()
+
+	return impl.storage.FindAccount(accountName)
+}
+
+func (impl *quiescedAccountStorage) AddToken(token string, expiredAt time.Time) error {
+	impl.lock.RLock()
+	defer impl.lock.RUnlock()
+
+	return impl.storage.AddToken(token, expiredAt)
+}
+
+func (impl *quiescedAccountStorage) DelToken(token string) error {
+	impl.lock.RLock()
+	defer impl.lock.RUnlock()
+
+	return impl.storage.DelToken(token)
+}
+
+func (impl *quiescedAccountStorage) TokenExists(token string, renewDuration time.Duration) (bool, error) {
+	impl.lock.RLock()
+	defer impl.lock.RUnlock()
+
+	return impl.storage.TokenExists(token, renewDuration)
+}
+
+func (impl *quiescedAccountStorage) SetPropertyData(accountName string, d interface{}) error {
+	impl.lock.RLock()
+	defer impl.lock.RUnlock()
+
+	return impl.storage.SetPropertyData(accountName, d)
+}
+
+func (impl *quiescedAccountStorage) GetPropertyData(accountName string, d interface{}) error {
+	impl.lock.RLock()
+	defer impl.lock.RUnlock()
+
+	return impl.storage.GetPropertyData(accountName, d)
+}
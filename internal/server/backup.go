@@ -0,0 +1,438 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/s-min-sys/lifecostbe/internal/config"
+	"github.com/s-min-sys/lifecostbe/internal/storage"
+	"github.com/sgostarter/i/l"
+)
+
+/*
+backup archive, tar.gz:
+	manifest.json
+	data/<files of the data directory>
+*/
+
+const (
+	backupManifestName = "manifest.json"
+	backupDataDir      = "data"
+)
+
+type BackupFile struct {
+	Path   string `json:"path"` // in the data directory, slash separated
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type BackupManifest struct {
+	CreatedAt     int64        `json:"createdAt"`
+	SchemaVersion int          `json:"schemaVersion"`
+	Storage       string       `json:"storage"`
+	Files         []BackupFile `json:"files"`
+}
+
+// snapshotData copies the data directory to a temp directory while quiesce blocks the writers, the copies are
+// checksummed after the writers are resumed. The caller removes the returned directory.
+func snapshotData(cfg *config.Config, quiesce func(fn func() error) error) (snapshotDir string, manifest BackupManifest,
+	err error) {
+	if cfg.Storage == config.StorageSQLite {
+		if err = checkInDataRoot(cfg.SQLiteFile); err != nil {
+			return
+		}
+	}
+
+	snapshotDir, err = os.MkdirTemp("", "lifecost-backup-")
+	if err != nil {
+		return
+	}
+
+	err = quiesce(func() (e error) {
+		manifest.Files, e = copyDataDir(dataRoot, snapshotDir)
+
+		return
+	})
+	if err == nil {
+		err = checksumDataFiles(snapshotDir, manifest.Files)
+	}
+
+	if err != nil {
+		_ = os.RemoveAll(snapshotDir)
+
+		return
+	}
+
+	manifest.CreatedAt = time.Now().Unix()
+	manifest.SchemaVersion = storage.CurrentSchemaVersion
+	manifest.Storage = cfg.Storage
+
+	return
+}
+
+func checkInDataRoot(filePath string) error {
+	root, err := filepath.Abs(dataRoot)
+	if err != nil {
+		return err
+	}
+
+	absFilePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(root, absFilePath)
+	if err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("%s is not in the data directory, it can't be backed up", filePath)
+	}
+
+	return nil
+}
+
+func copyDataDir(srcDir, dstDir string) (files []BackupFile, err error) {
+	err = filepath.WalkDir(srcDir, func(filePath string, entry fs.DirEntry, e error) error {
+		if e != nil {
+			return e
+		}
+
+		// temp files of interrupted writes are dropped on start
+		if !entry.Type().IsRegular() || strings.HasSuffix(entry.Name(), ".tmp") {
+			return nil
+		}
+
+		rel, e := filepath.Rel(srcDir, filePath)
+		if e != nil {
+			return e
+		}
+
+		if e = copyDataFile(filePath, filepath.Join(dstDir, rel)); e != nil {
+			return e
+		}
+
+		files = append(files, BackupFile{
+			Path: filepath.ToSlash(rel),
+		})
+
+		return nil
+	})
+
+	return
+}
+
+// copyDataFile copies srcPath to dstPath without syncing, the snapshot is a temp copy.
+func copyDataFile(srcPath, dstPath string) (err error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return
+	}
+
+	defer src.Close()
+
+	if err = os.MkdirAll(filepath.Dir(dstPath), 0700); err != nil {
+		return
+	}
+
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+
+	_, err = io.Copy(dst, src)
+
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+
+	return
+}
+
+func checksumDataFiles(dir string, files []BackupFile) error {
+	for idx := range files {
+		file, err := os.Open(filepath.Join(dir, filepath.FromSlash(files[idx].Path)))
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.New()
+
+		files[idx].Size, err = io.Copy(hash, file)
+
+		_ = file.Close()
+
+		if err != nil {
+			return err
+		}
+
+		files[idx].SHA256 = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	return nil
+}
+
+// writeDataFile writes r to filePath and returns its size and checksum.
+func writeDataFile(filePath string, r io.Reader) (file BackupFile, err error) {
+	if err = os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return
+	}
+
+	dst, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+
+	hash := sha256.New()
+
+	file.Size, err = io.Copy(io.MultiWriter(dst, hash), r)
+	if err == nil {
+		err = dst.Sync()
+	}
+
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	return
+}
+
+func writeBackupArchive(w io.Writer, snapshotDir string, manifest BackupManifest) (err error) {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	d, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return
+	}
+
+	err = tarWriter.WriteHeader(&tar.Header{
+		Name:    backupManifestName,
+		Mode:    0600,
+		Size:    int64(len(d)),
+		ModTime: time.Unix(manifest.CreatedAt, 0),
+	})
+	if err != nil {
+		return
+	}
+
+	if _, err = tarWriter.Write(d); err != nil {
+		return
+	}
+
+	for _, file := range manifest.Files {
+		if err = writeBackupArchiveFile(tarWriter, snapshotDir, file, manifest.CreatedAt); err != nil {
+			return
+		}
+	}
+
+	if err = tarWriter.Close(); err != nil {
+		return
+	}
+
+	err = gzipWriter.Close()
+
+	return
+}
+
+func writeBackupArchiveFile(tarWriter *tar.Writer, snapshotDir string, file BackupFile, createdAt int64) error {
+	src, err := os.Open(filepath.Join(snapshotDir, filepath.FromSlash(file.Path)))
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	err = tarWriter.WriteHeader(&tar.Header{
+		Name:    path.Join(backupDataDir, file.Path),
+		Mode:    0600,
+		Size:    file.Size,
+		ModTime: time.Unix(createdAt, 0),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tarWriter, src)
+
+	return err
+}
+
+// Backup writes the backup archive of the data directory to archivePath, the server must not be running:
+// use the /admin/backup endpoint of a running server.
+func Backup(cfg *config.Config, archivePath string) (manifest BackupManifest, err error) {
+	snapshotDir, manifest, err := snapshotData(cfg, func(fn func() error) error {
+		return fn()
+	})
+	if err != nil {
+		return
+	}
+
+	defer os.RemoveAll(snapshotDir)
+
+	file, err := os.OpenFile(archivePath+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+
+	err = writeBackupArchive(file, snapshotDir, manifest)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if e := file.Close(); err == nil {
+		err = e
+	}
+
+	if err == nil {
+		err = os.Rename(archivePath+".tmp", archivePath)
+	}
+
+	if err != nil {
+		_ = os.Remove(archivePath + ".tmp")
+	}
+
+	return
+}
+
+// Restore validates the backup archive and replaces the data directory with it, the old data directory is
+// kept next to it. The archive must be of the configured storage. With dryRun the archive is only validated.
+// The server must not be running.
+func Restore(cfg *config.Config, archivePath string, dryRun bool, logger l.Wrapper) (manifest BackupManifest,
+	err error) {
+	restoreDir := dataRoot + ".restore"
+
+	_ = os.RemoveAll(restoreDir)
+
+	manifest, err = extractBackupArchive(archivePath, cfg.Storage, restoreDir)
+	if err != nil || dryRun {
+		_ = os.RemoveAll(restoreDir)
+
+		return
+	}
+
+	if _, e := os.Stat(dataRoot); e == nil {
+		oldDataRoot := dataRoot + ".before-restore-" + time.Now().Format("20060102150405")
+
+		if err = os.Rename(dataRoot, oldDataRoot); err != nil {
+			return
+		}
+
+		logger.WithFields(l.StringField("dir", oldDataRoot)).Info("old data directory kept")
+	}
+
+	err = os.Rename(restoreDir, dataRoot)
+
+	return
+}
+
+// extractBackupArchive extracts the data files of the archive to dir, checking them against the manifest.
+func extractBackupArchive(archivePath, storageName, dir string) (manifest BackupManifest, err error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return
+	}
+
+	tarReader := tar.NewReader(gzipReader)
+
+	header, err := tarReader.Next()
+	if err != nil {
+		return
+	}
+
+	if header.Name != backupManifestName {
+		err = errors.New("the backup archive has no manifest")
+
+		return
+	}
+
+	if err = json.NewDecoder(tarReader).Decode(&manifest); err != nil {
+		return
+	}
+
+	if manifest.SchemaVersion > storage.CurrentSchemaVersion {
+		err = fmt.Errorf("the backup schema version %d is newer than %d", manifest.SchemaVersion,
+			storage.CurrentSchemaVersion)
+
+		return
+	}
+
+	if manifest.Storage != storageName {
+		err = fmt.Errorf("the backup is of the %s storage, not of the configured %s storage", manifest.Storage,
+			storageName)
+
+		return
+	}
+
+	files := make(map[string]BackupFile, len(manifest.Files))
+	for _, f := range manifest.Files {
+		files[f.Path] = f
+	}
+
+	for {
+		header, err = tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			err = nil
+
+			break
+		}
+
+		if err != nil {
+			return
+		}
+
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		rel, inDataDir := strings.CutPrefix(header.Name, backupDataDir+"/")
+
+		expected, ok := files[rel]
+		if !ok || !inDataDir || header.Typeflag != tar.TypeReg || !filepath.IsLocal(filepath.FromSlash(rel)) {
+			err = fmt.Errorf("unexpected file %s in the backup archive", header.Name)
+
+			return
+		}
+
+		var extracted BackupFile
+
+		extracted, err = writeDataFile(filepath.Join(dir, filepath.FromSlash(rel)), tarReader)
+		if err != nil {
+			return
+		}
+
+		if extracted.Size != expected.Size || extracted.SHA256 != expected.SHA256 {
+			err = fmt.Errorf("checksum mismatch of %s in the backup archive", rel)
+
+			return
+		}
+
+		delete(files, rel)
+	}
+
+	for rel := range files {
+		err = fmt.Errorf("%s is missing in the backup archive", rel)
+
+		return
+	}
+
+	return
+}
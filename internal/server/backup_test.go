@@ -0,0 +1,195 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/s-min-sys/lifecostbe/internal/config"
+	"github.com/s-min-sys/lifecostbe/internal/storage"
+	"github.com/sgostarter/i/l"
+	"github.com/stretchr/testify/assert"
+)
+
+type utBackupArchiveFile struct {
+	name string
+	data string
+}
+
+func utBackupFile(path, data string) BackupFile {
+	hash := sha256.Sum256([]byte(data))
+
+	return BackupFile{
+		Path:   path,
+		Size:   int64(len(data)),
+		SHA256: hex.EncodeToString(hash[:]),
+	}
+}
+
+func utWriteBackupArchive(t *testing.T, archivePath string, manifest BackupManifest, files []utBackupArchiveFile) {
+	file, err := os.Create(archivePath)
+	assert.Nil(t, err)
+
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	d, err := json.Marshal(manifest)
+	assert.Nil(t, err)
+
+	files = append([]utBackupArchiveFile{{name: backupManifestName, data: string(d)}}, files...)
+
+	for _, f := range files {
+		assert.Nil(t, tarWriter.WriteHeader(&tar.Header{
+			Name:     f.name,
+			Typeflag: tar.TypeReg,
+			Mode:     0600,
+			Size:     int64(len(f.data)),
+		}))
+
+		_, err = tarWriter.Write([]byte(f.data))
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, tarWriter.Close())
+	assert.Nil(t, gzipWriter.Close())
+}
+
+func TestBackupRestore(t *testing.T) {
+	_ = os.RemoveAll(dataRoot)
+	assert.Nil(t, os.MkdirAll(filepath.Join(dataRoot, "bills"), 0700))
+	assert.Nil(t, os.WriteFile(filepath.Join(dataRoot, "etd"), []byte("tmp data"), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dataRoot, "bills", "1-20240229"), []byte("bills"), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dataRoot, "bills", "1-20240229.tmp"), []byte("partial"), 0600))
+
+	cfg := &config.Config{
+		Storage: config.StorageFile,
+	}
+
+	manifest, err := Backup(cfg, "backup.tar.gz")
+	assert.Nil(t, err)
+	assert.EqualValues(t, config.StorageFile, manifest.Storage)
+	assert.EqualValues(t, storage.CurrentSchemaVersion, manifest.SchemaVersion)
+	assert.ElementsMatch(t, []BackupFile{utBackupFile("etd", "tmp data"), utBackupFile("bills/1-20240229", "bills")},
+		manifest.Files)
+
+	assert.Nil(t, os.WriteFile(filepath.Join(dataRoot, "etd"), []byte("changed"), 0600))
+
+	_, err = Restore(&config.Config{Storage: config.StorageSQLite}, "backup.tar.gz", false, l.NewNopLoggerWrapper())
+	assert.NotNil(t, err)
+
+	d, err := os.ReadFile(filepath.Join(dataRoot, "etd"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, "changed", string(d))
+
+	_, err = Restore(cfg, "backup.tar.gz", true, l.NewNopLoggerWrapper())
+	assert.Nil(t, err)
+
+	d, err = os.ReadFile(filepath.Join(dataRoot, "etd"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, "changed", string(d))
+
+	restored, err := Restore(cfg, "backup.tar.gz", false, l.NewNopLoggerWrapper())
+	assert.Nil(t, err)
+	assert.EqualValues(t, manifest, restored)
+
+	d, err = os.ReadFile(filepath.Join(dataRoot, "etd"))
+	assert.Nil(t, err)
+	assert.EqualValues(t, "tmp data", string(d))
+
+	_, err = os.Stat(filepath.Join(dataRoot, "bills", "1-20240229.tmp"))
+	assert.True(t, os.IsNotExist(err))
+
+	oldDataRoots, err := filepath.Glob(dataRoot + ".before-restore-*")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(oldDataRoots))
+
+	for _, dir := range oldDataRoots {
+		_ = os.RemoveAll(dir)
+	}
+
+	_ = os.RemoveAll(dataRoot)
+	_ = os.Remove("backup.tar.gz")
+}
+
+func TestExtractBackupArchive(t *testing.T) {
+	manifest := BackupManifest{
+		SchemaVersion: storage.CurrentSchemaVersion,
+		Storage:       config.StorageFile,
+		Files: []BackupFile{
+			utBackupFile("etd", "tmp data"),
+			utBackupFile("bills/1-20240229", "bills"),
+		},
+	}
+
+	files := []utBackupArchiveFile{
+		{name: "data/etd", data: "tmp data"},
+		{name: "data/bills/1-20240229", data: "bills"},
+	}
+
+	traversalManifest := manifest
+	traversalManifest.Files = append([]BackupFile{utBackupFile("../escaped", "x")}, manifest.Files...)
+
+	newerManifest := manifest
+	newerManifest.SchemaVersion = storage.CurrentSchemaVersion + 1
+
+	cases := []struct {
+		name     string
+		storage  string
+		manifest BackupManifest
+		files    []utBackupArchiveFile
+		ok       bool
+	}{
+		{"valid", config.StorageFile, manifest, files, true},
+		{"missing file", config.StorageFile, manifest, files[:1], false},
+		{"extra file", config.StorageFile, manifest, append([]utBackupArchiveFile{
+			{name: "data/extra", data: "x"},
+		}, files...), false},
+		{"file out of the data directory", config.StorageFile, manifest, append([]utBackupArchiveFile{
+			{name: "etd", data: "tmp data"},
+		}, files[1:]...), false},
+		{"checksum mismatch", config.StorageFile, manifest, []utBackupArchiveFile{
+			{name: "data/etd", data: "tmp dat!"},
+			files[1],
+		}, false},
+		{"size mismatch", config.StorageFile, manifest, []utBackupArchiveFile{
+			{name: "data/etd", data: "tmp data!"},
+			files[1],
+		}, false},
+		{"path traversal", config.StorageFile, traversalManifest, append([]utBackupArchiveFile{
+			{name: "data/../escaped", data: "x"},
+		}, files...), false},
+		{"newer schema", config.StorageFile, newerManifest, files, false},
+		{"other storage", config.StorageSQLite, manifest, files, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_ = os.RemoveAll("extract")
+			_ = os.Remove("escaped")
+
+			utWriteBackupArchive(t, "backup.tar.gz", c.manifest, c.files)
+
+			_, err := extractBackupArchive("backup.tar.gz", c.storage, filepath.Join("extract", "data"))
+			assert.EqualValues(t, c.ok, err == nil, err)
+
+			_, err = os.Stat(filepath.Join("extract", "escaped"))
+			assert.True(t, os.IsNotExist(err))
+
+			if c.ok {
+				d, e := os.ReadFile(filepath.Join("extract", "data", "bills", "1-20240229"))
+				assert.Nil(t, e)
+				assert.EqualValues(t, "bills", string(d))
+			}
+		})
+	}
+
+	_ = os.RemoveAll("extract")
+	_ = os.Remove("backup.tar.gz")
+}
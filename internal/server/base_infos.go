@@ -42,8 +42,9 @@ func (s *Server) buildMerchantWallets(info storage.MerchantPersonInfo) (merchant
 	wallet, err := s.storage.GetWallet(info.PersonID)
 	if err == nil {
 		merchantWallets.Wallets = append(merchantWallets.Wallets, &WalletWithInfo{
-			ID:   idN2S(wallet.ID),
-			Name: wallet.Name,
+			ID:       idN2S(wallet.ID),
+			Name:     wallet.Name,
+			Currency: model.CurrencyOrDefault(wallet.Currency),
 		})
 	}
 
@@ -59,8 +60,9 @@ func (s *Server) buildMerchantWallets(info storage.MerchantPersonInfo) (merchant
 		}
 
 		merchantWallets.Wallets = append(merchantWallets.Wallets, &WalletWithInfo{
-			ID:   idN2S(wallet.ID),
-			Name: wallet.Name,
+			ID:       idN2S(wallet.ID),
+			Name:     wallet.Name,
+			Currency: model.CurrencyOrDefault(wallet.Currency),
 		})
 	}
 
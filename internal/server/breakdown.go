@@ -0,0 +1,273 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	breakdownOtherName   = "其他"
+	breakdownNoLabelName = "无标签"
+)
+
+// getBillsBetween returns the bills of the group with startAt <= At <= finishAt, 0: no bound.
+func (s *Server) getBillsBetween(groupID uint64, startAt, finishAt int64) (bills []model.GroupBill, err error) {
+	var startYear, startMonth, startDay, finishYear, finishMonth, finishDay int
+
+	if startAt > 0 {
+		t := time.Unix(startAt, 0)
+		startYear, startMonth, startDay = t.Year(), int(t.Month()), t.Day()
+	}
+
+	if finishAt > 0 {
+		t := time.Unix(finishAt, 0)
+		finishYear, finishMonth, finishDay = t.Year(), int(t.Month()), t.Day()
+	}
+
+	dayBills, err := s.storage.GetBillsEx(groupID, startYear, startMonth, startDay, finishYear, finishMonth, finishDay)
+	if err != nil {
+		return
+	}
+
+	bills = make([]model.GroupBill, 0, len(dayBills))
+
+	for _, bill := range dayBills {
+		if (startAt > 0 && bill.At < startAt) || (finishAt > 0 && bill.At > finishAt) {
+			continue
+		}
+
+		bills = append(bills, bill)
+	}
+
+	return
+}
+
+// merchantPersonIDs returns the merchant persons of all groups and of the group.
+func (s *Server) merchantPersonIDs(groupID uint64) (personIDs []uint64) {
+	for _, info := range append(s.storage.GetMerchantPersons(), s.storage.GetGroupMerchantPersons(groupID)...) {
+		personIDs = append(personIDs, info.PersonID)
+	}
+
+	return
+}
+
+// breakdownWalletID returns the wallet of the merchant side of the bill: the wallet of a merchant person,
+// or the to wallet of outgoing bills and the from wallet of incoming ones.
+func (s *Server) breakdownWalletID(bill model.GroupBill, merchantPersonIDs []uint64) uint64 {
+	for _, walletID := range []uint64{bill.ToSubWalletID, bill.FromSubWalletID} {
+		wallet, err := s.storage.GetWallet(walletID)
+		if err == nil && slices.Contains(merchantPersonIDs, wallet.PersonID) {
+			return walletID
+		}
+	}
+
+	if bill.CostDir == model.CostDirIn {
+		return bill.FromSubWalletID
+	}
+
+	return bill.ToSubWalletID
+}
+
+func (s *Server) breakdownWalletName(walletID uint64) string {
+	wallet, err := s.storage.GetWallet(walletID)
+	if err != nil {
+		return ""
+	}
+
+	// default wallets are named "*"
+	if wallet.Name == "*" {
+		return s.helperPersonName(wallet.PersonID)
+	}
+
+	return wallet.Name
+}
+
+func (s *Server) breakdownLabelName(labelID, groupID uint64) string {
+	if labelID == 0 {
+		return breakdownNoLabelName
+	}
+
+	name, err := s.storage.GetLabelName(labelID)
+	if err == nil {
+		return name
+	}
+
+	name, _ = s.storage.GetGroupLabelName(labelID, groupID)
+
+	return name
+}
+
+// breakdownItems sorts the items by amount and merges the ones after the top N into the other bucket.
+func breakdownItems(items map[uint64]*BreakdownItem, topN int, totalAmount int) []BreakdownItem {
+	rItems := make([]BreakdownItem, 0, len(items))
+
+	for _, item := range items {
+		rItems = append(rItems, *item)
+	}
+
+	slices.SortFunc(rItems, func(a, b BreakdownItem) int {
+		if a.Amount != b.Amount {
+			return b.Amount - a.Amount
+		}
+
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	if topN > 0 && len(rItems) > topN {
+		other := BreakdownItem{
+			Name: breakdownOtherName,
+		}
+
+		for _, item := range rItems[topN:] {
+			other.Count += item.Count
+			other.Amount += item.Amount
+		}
+
+		rItems = append(rItems[:topN], other)
+	}
+
+	for idx := range rItems {
+		rItems[idx].Percent = breakdownPercent(rItems[idx].Amount, totalAmount)
+	}
+
+	return rItems
+}
+
+func breakdownPercent(amount, totalAmount int) float64 {
+	if totalAmount == 0 {
+		return 0
+	}
+
+	return math.Round(float64(amount)*10000/float64(totalAmount)) / 100
+}
+
+func (s *Server) breakdown(groupID uint64, req BreakdownRequest) (resp BreakdownResponse, err error) {
+	resp.StartAt = req.StartAt
+	resp.FinishAt = req.FinishAt
+	resp.CostDir = req.CostDir
+
+	resp.Currency, err = s.storage.GetGroupBaseCurrency(groupID)
+	if err != nil {
+		return
+	}
+
+	bills, err := s.getBillsBetween(groupID, req.StartAt, req.FinishAt)
+	if err != nil {
+		return
+	}
+
+	merchantPersonIDs := s.merchantPersonIDs(groupID)
+
+	wallets := make(map[uint64]*BreakdownItem)
+	labels := make(map[uint64]*BreakdownItem)
+
+	fnAdd := func(items map[uint64]*BreakdownItem, id uint64, fnName func() string, amount int) {
+		item, ok := items[id]
+		if !ok {
+			item = &BreakdownItem{
+				ID:   idN2S(id),
+				Name: fnName(),
+			}
+
+			items[id] = item
+		}
+
+		item.Count++
+		item.Amount += amount
+	}
+
+	for _, bill := range bills {
+		if bill.CostDir != req.CostDir {
+			continue
+		}
+
+		amount := bill.StatAmount()
+
+		resp.TotalCount++
+		resp.TotalAmount += amount
+
+		walletID := s.breakdownWalletID(bill, merchantPersonIDs)
+		fnAdd(wallets, walletID, func() string {
+			return s.breakdownWalletName(walletID)
+		}, amount)
+
+		// a bill with labels counts in each of them
+		labelIDs := bill.LabelIDs
+		if len(labelIDs) == 0 {
+			labelIDs = []uint64{0}
+		}
+
+		for _, labelID := range labelIDs {
+			labelID := labelID
+
+			fnAdd(labels, labelID, func() string {
+				return s.breakdownLabelName(labelID, groupID)
+			}, amount)
+		}
+	}
+
+	resp.Wallets = breakdownItems(wallets, req.TopN, resp.TotalAmount)
+	resp.Labels = breakdownItems(labels, req.TopN, resp.TotalAmount)
+
+	return
+}
+
+func (s *Server) handleStatisticsBreakdown(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	resp, code, msg := s.handleStatisticsBreakdownInner(c)
+	if code == CodeSuccess {
+		respWrapper.Resp = resp
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleStatisticsBreakdownInner(c *gin.Context) (resp BreakdownResponse, code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	var req BreakdownRequest
+
+	err := c.BindJSON(&req)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	if !req.Valid() {
+		code = CodeInvalidArgs
+
+		return
+	}
+
+	groupID, ok := s.getGroupID4Person(uid, req.GroupID)
+	if !ok {
+		code = CodeInvalidArgs
+		msg = "非法的组ID"
+
+		return
+	}
+
+	resp, err = s.breakdown(groupID, req)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	return
+}
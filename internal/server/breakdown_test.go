@@ -0,0 +1,199 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakdownItems(t *testing.T) {
+	items := func() map[uint64]*BreakdownItem {
+		return map[uint64]*BreakdownItem{
+			1: {ID: "1", Name: "b", Count: 1, Amount: 50},
+			2: {ID: "2", Name: "a", Count: 2, Amount: 50},
+			3: {ID: "3", Name: "c", Count: 3, Amount: 100},
+			4: {ID: "4", Name: "d", Count: 1, Amount: 25},
+		}
+	}
+
+	cases := []struct {
+		name     string
+		topN     int
+		expected []BreakdownItem
+	}{
+		{
+			name: "sorted by amount then name",
+			topN: 0,
+			expected: []BreakdownItem{
+				{ID: "3", Name: "c", Count: 3, Amount: 100, Percent: 44.44},
+				{ID: "2", Name: "a", Count: 2, Amount: 50, Percent: 22.22},
+				{ID: "1", Name: "b", Count: 1, Amount: 50, Percent: 22.22},
+				{ID: "4", Name: "d", Count: 1, Amount: 25, Percent: 11.11},
+			},
+		},
+		{
+			name: "the items after the top N are merged",
+			topN: 2,
+			expected: []BreakdownItem{
+				{ID: "3", Name: "c", Count: 3, Amount: 100, Percent: 44.44},
+				{ID: "2", Name: "a", Count: 2, Amount: 50, Percent: 22.22},
+				{Name: breakdownOtherName, Count: 2, Amount: 75, Percent: 33.33},
+			},
+		},
+		{
+			name: "top N covers all",
+			topN: 4,
+			expected: []BreakdownItem{
+				{ID: "3", Name: "c", Count: 3, Amount: 100, Percent: 44.44},
+				{ID: "2", Name: "a", Count: 2, Amount: 50, Percent: 22.22},
+				{ID: "1", Name: "b", Count: 1, Amount: 50, Percent: 22.22},
+				{ID: "4", Name: "d", Count: 1, Amount: 25, Percent: 11.11},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.EqualValues(t, c.expected, breakdownItems(items(), c.topN, 225))
+		})
+	}
+
+	assert.EqualValues(t, 0, breakdownPercent(10, 0))
+}
+
+func TestBreakdown(t *testing.T) {
+	s := utNewServer(t, "breakdown")
+
+	zjzID, zjzWalletID, err := s.storage.NewPersonEx("zjz", 1001)
+	assert.Nil(t, err)
+
+	zymID, zymWalletID, err := s.storage.NewPersonEx("zym", 1002)
+	assert.Nil(t, err)
+
+	shopID, shopWalletID, err := s.storage.NewPerson("shop")
+	assert.Nil(t, err)
+	assert.Nil(t, s.storage.SetPersonMerchant(shopID, model.CostDirOut))
+
+	groupID, err := s.storage.NewGroup("home", zjzID)
+	assert.Nil(t, err)
+	assert.Nil(t, s.storage.JoinGroup(groupID, zymID))
+
+	foodLabelID, err := s.storage.NewLabel("ut-food")
+	assert.Nil(t, err)
+
+	rentLabelID, err := s.storage.NewGroupLabel(groupID, "ut-rent")
+	assert.Nil(t, err)
+
+	fnRecord := func(from, to uint64, costDir model.CostDir, amount int, at int64, labelIDs ...uint64) {
+		utRecord(t, s, groupID, model.GroupBill{
+			FromSubWalletID: from,
+			ToSubWalletID:   to,
+			CostDir:         costDir,
+			Amount:          amount,
+			LabelIDs:        labelIDs,
+			At:              at,
+		})
+	}
+
+	fnRecord(zjzWalletID, shopWalletID, model.CostDirOut, 100, utAt(2024, 3, 10, 9), foodLabelID)
+	fnRecord(zymWalletID, shopWalletID, model.CostDirOut, 50, utAt(2024, 3, 10, 12), foodLabelID, rentLabelID)
+	// no merchant: the to wallet of the outgoing bill
+	fnRecord(zjzWalletID, zymWalletID, model.CostDirOut, 30, utAt(2024, 3, 10, 18))
+	// the merchant is the from wallet of the incoming bill
+	fnRecord(shopWalletID, zjzWalletID, model.CostDirIn, 70, utAt(2024, 3, 10, 20), rentLabelID)
+	fnRecord(zjzWalletID, zymWalletID, model.CostDirInGroup, 10, utAt(2024, 3, 10, 21))
+	fnRecord(zymWalletID, shopWalletID, model.CostDirOut, 20, utAt(2024, 3, 20, 12))
+
+	shop := func(count, amount int, percent float64) BreakdownItem {
+		return BreakdownItem{ID: idN2S(shopWalletID), Name: "shop", Count: count, Amount: amount, Percent: percent}
+	}
+
+	zym := func(count, amount int, percent float64) BreakdownItem {
+		return BreakdownItem{ID: idN2S(zymWalletID), Name: "zym", Count: count, Amount: amount, Percent: percent}
+	}
+
+	food := func(count, amount int, percent float64) BreakdownItem {
+		return BreakdownItem{ID: idN2S(foodLabelID), Name: "ut-food", Count: count, Amount: amount, Percent: percent}
+	}
+
+	rent := func(count, amount int, percent float64) BreakdownItem {
+		return BreakdownItem{ID: idN2S(rentLabelID), Name: "ut-rent", Count: count, Amount: amount, Percent: percent}
+	}
+
+	noLabel := func(count, amount int, percent float64) BreakdownItem {
+		return BreakdownItem{ID: idN2S(0), Name: breakdownNoLabelName, Count: count, Amount: amount, Percent: percent}
+	}
+
+	other := func(count, amount int, percent float64) BreakdownItem {
+		return BreakdownItem{Name: breakdownOtherName, Count: count, Amount: amount, Percent: percent}
+	}
+
+	month := BreakdownRequest{StartAt: utAt(2024, 3, 1, 0), FinishAt: utAt(2024, 4, 1, 0) - 1}
+
+	cases := []struct {
+		name        string
+		req         BreakdownRequest
+		totalCount  int
+		totalAmount int
+		wallets     []BreakdownItem
+		labels      []BreakdownItem
+	}{
+		{
+			name:        "outgoing bills of the month",
+			req:         BreakdownRequest{StartAt: month.StartAt, FinishAt: month.FinishAt, CostDir: model.CostDirOut},
+			totalCount:  4,
+			totalAmount: 200,
+			wallets:     []BreakdownItem{shop(3, 170, 85), zym(1, 30, 15)},
+			// a bill with several labels counts in each of them
+			labels: []BreakdownItem{food(2, 150, 75), rent(1, 50, 25), noLabel(2, 50, 25)},
+		},
+		{
+			name: "top 1",
+			req: BreakdownRequest{StartAt: month.StartAt, FinishAt: month.FinishAt, CostDir: model.CostDirOut,
+				TopN: 1},
+			totalCount:  4,
+			totalAmount: 200,
+			wallets:     []BreakdownItem{shop(3, 170, 85), other(1, 30, 15)},
+			labels:      []BreakdownItem{food(2, 150, 75), other(3, 100, 50)},
+		},
+		{
+			name:        "incoming bills",
+			req:         BreakdownRequest{StartAt: month.StartAt, FinishAt: month.FinishAt, CostDir: model.CostDirIn},
+			totalCount:  1,
+			totalAmount: 70,
+			wallets:     []BreakdownItem{shop(1, 70, 100)},
+			labels:      []BreakdownItem{rent(1, 70, 100)},
+		},
+		{
+			name: "one day",
+			req: BreakdownRequest{StartAt: utAt(2024, 3, 10, 0), FinishAt: utAt(2024, 3, 11, 0) - 1,
+				CostDir: model.CostDirOut},
+			totalCount:  3,
+			totalAmount: 180,
+			wallets:     []BreakdownItem{shop(2, 150, 83.33), zym(1, 30, 16.67)},
+			labels:      []BreakdownItem{food(2, 150, 83.33), rent(1, 50, 27.78), noLabel(1, 30, 16.67)},
+		},
+		{
+			name: "no bills",
+			req: BreakdownRequest{StartAt: utAt(2024, 5, 1, 0), FinishAt: utAt(2024, 6, 1, 0) - 1,
+				CostDir: model.CostDirOut},
+			wallets: []BreakdownItem{},
+			labels:  []BreakdownItem{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.True(t, c.req.Valid())
+
+			resp, e := s.breakdown(groupID, c.req)
+			assert.Nil(t, e)
+			assert.EqualValues(t, model.DefaultCurrency, resp.Currency)
+			assert.EqualValues(t, c.totalCount, resp.TotalCount)
+			assert.EqualValues(t, c.totalAmount, resp.TotalAmount)
+			assert.EqualValues(t, c.wallets, resp.Wallets)
+			assert.EqualValues(t, c.labels, resp.Labels)
+		})
+	}
+}
@@ -20,6 +20,7 @@ const (
 	CodeInvalidToken
 	CodeNeedAuth
 	CodeDisabled
+	CodeBatchAborted
 )
 
 func (c Code) String() string {
@@ -42,6 +43,8 @@ func (c Code) String() string {
 		return "需要授权"
 	case CodeDisabled:
 		return "被禁止"
+	case CodeBatchAborted:
+		return "批量记录已取消"
 	}
 
 	return fmt.Sprintf("未知错误%d", c)
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/s-min-sys/lifecostbe/internal/config"
+	"github.com/s-min-sys/lifecostbe/internal/storage"
+	"github.com/sgostarter/i/l"
+)
+
+// dataCrypter returns the crypter of the configured encryption key, nil if the data is not encrypted,
+// and makes sure the data directory matches it.
+func dataCrypter(cfg *config.Config) (crypter *storage.Crypter, err error) {
+	key, err := cfg.EncryptionKey()
+	if err != nil {
+		return
+	}
+
+	if key != nil {
+		crypter, err = storage.NewCrypter(key)
+		if err != nil {
+			return
+		}
+	}
+
+	err = storage.CheckEncryption(dataRoot, crypter)
+
+	return
+}
+
+// EncryptData encrypts the plaintext data directory with the configured encryption key.
+func EncryptData(cfg *config.Config, logger l.Wrapper) (count int, err error) {
+	key, err := cfg.EncryptionKey()
+	if err != nil {
+		return
+	}
+
+	if key == nil {
+		err = errors.New("no encryption key configured")
+
+		return
+	}
+
+	crypter, err := storage.NewCrypter(key)
+	if err != nil {
+		return
+	}
+
+	return storage.EncryptDataDir(dataRoot, crypter, []string{statFileName}, logger)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/s-min-sys/lifecostbe/internal/config"
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/s-min-sys/lifecostbe/internal/storage"
+	"github.com/spf13/cast"
+)
+
+/*
+csv columns: date(YYYYMMDD),from,to,rate
+a first line starting with "date" is taken as header
+*/
+
+func ImportExchangeRates(cfg *config.Config, csvPath string) (count int, err error) {
+	crypter, err := dataCrypter(cfg)
+	if err != nil {
+		return
+	}
+
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+
+	stg := storage.NewStorageEx(dataRoot, false, storage.Options{Crypter: crypter}, nil)
+	defer stg.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	for line := 1; ; line++ {
+		var record []string
+
+		record, err = reader.Read()
+		if errors.Is(err, io.EOF) {
+			err = nil
+
+			break
+		}
+
+		if err != nil {
+			return
+		}
+
+		if line == 1 && strings.EqualFold(record[0], "date") {
+			continue
+		}
+
+		rate, e := cast.ToFloat64E(record[3])
+		if e != nil {
+			err = fmt.Errorf("line %d: invalid rate %s", line, record[3])
+
+			return
+		}
+
+		err = stg.SetExchangeRate(model.ExchangeRate{
+			From: record[1],
+			To:   record[2],
+			Date: record[0],
+			Rate: rate,
+		})
+		if err != nil {
+			err = fmt.Errorf("line %d: %w", line, err)
+
+			return
+		}
+
+		count++
+	}
+
+	return
+}
@@ -0,0 +1,748 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/s-min-sys/lifecostbe/internal/storage"
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"golang.org/x/exp/slices"
+)
+
+/*
+export document, JSON, everything the exporting person sees:
+	version:      exportDocumentVersion
+	exportedAt:   unix seconds
+	personID:     the exporting person
+	persons:      the exporting person, the group members, the merchants and the persons of the bills
+	wallets:      all wallets of the persons
+	labels:       the labels of all groups
+	merchants:    groupID 0 for the merchants of all groups
+	groups:       the groups of the exporting person with their members, admins, base currency,
+	              labels, bills and deleted bills
+
+IDs are the ones of the exporting server. The import maps them to new ones: the exporting person is the
+importing one, other persons are always created, as matching them by name would add the server's persons
+to the imported groups; a taken name gets a #n suffix. Wallets of the importing person and labels are matched
+by name or created, groups are always created and their bills are recorded again with statistics.
+Everything the import created is removed if it fails, so it can be retried: the groups, the persons with
+their wallets and merchant settings, the wallets of the importing person and the labels.
+Attachment contents, recurring rules and exchange rates are not exported; deleted bills keep their deletion
+time and person, so their retention goes on.
+*/
+
+const exportDocumentVersion = 1
+
+type ExportMerchant struct {
+	PersonID uint64        `json:"personID"`
+	GroupID  uint64        `json:"groupID,omitempty"` // 0: merchant of all groups
+	CostDir  model.CostDir `json:"costDir"`
+}
+
+type ExportGroup struct {
+	model.Group
+
+	Labels       []model.Label            `json:"labels"`
+	Bills        []model.GroupBill        `json:"bills"`
+	DeletedBills []model.DeletedGroupBill `json:"deletedBills"`
+}
+
+type ExportDocument struct {
+	Version    int              `json:"version"`
+	ExportedAt int64            `json:"exportedAt"`
+	PersonID   uint64           `json:"personID"`
+	Persons    []model.Person   `json:"persons"`
+	Wallets    []model.Wallet   `json:"wallets"`
+	Labels     []model.Label    `json:"labels"`
+	Merchants  []ExportMerchant `json:"merchants"`
+	Groups     []ExportGroup    `json:"groups"`
+}
+
+type ImportReport struct {
+	Persons      int `json:"persons"`
+	Wallets      int `json:"wallets"` // created ones, the matched ones are not counted
+	Labels       int `json:"labels"`
+	Groups       int `json:"groups"`
+	Bills        int `json:"bills"`
+	DeletedBills int `json:"deletedBills"`
+}
+
+func (s *Server) exportDocument(uid uint64) (doc ExportDocument, err error) {
+	doc = ExportDocument{
+		Version:    exportDocumentVersion,
+		ExportedAt: time.Now().Unix(),
+		PersonID:   uid,
+	}
+
+	groupIDs, err := s.storage.GetPersonGroupsIDs(uid)
+	if err != nil {
+		return
+	}
+
+	groupNames, err := s.storage.GetGroupNames(groupIDs)
+	if err != nil {
+		return
+	}
+
+	personIDs := []uint64{uid}
+	walletIDs := make([]uint64, 0, 16)
+
+	fnAddID := func(ids []uint64, id uint64) []uint64 {
+		if id == 0 || slices.Contains(ids, id) {
+			return ids
+		}
+
+		return append(ids, id)
+	}
+
+	fnAddBill := func(bill model.GroupBill) {
+		walletIDs = fnAddID(walletIDs, bill.FromSubWalletID)
+		walletIDs = fnAddID(walletIDs, bill.ToSubWalletID)
+		walletIDs = fnAddID(walletIDs, bill.LossWalletID)
+		personIDs = fnAddID(personIDs, bill.OperationPersonID)
+
+		if bill.Split != nil {
+			for _, share := range bill.Split.Shares {
+				personIDs = fnAddID(personIDs, share.PersonID)
+			}
+		}
+	}
+
+	for _, info := range s.storage.GetMerchantPersons() {
+		doc.Merchants = append(doc.Merchants, ExportMerchant{
+			PersonID: info.PersonID,
+			CostDir:  info.CostDir,
+		})
+
+		personIDs = fnAddID(personIDs, info.PersonID)
+	}
+
+	for idx, groupID := range groupIDs {
+		var group ExportGroup
+
+		group, err = s.exportGroup(groupID, groupNames[idx])
+		if err != nil {
+			return
+		}
+
+		for _, personID := range group.MemberPersonIDs {
+			personIDs = fnAddID(personIDs, personID)
+		}
+
+		for _, info := range s.storage.GetGroupMerchantPersons(groupID) {
+			doc.Merchants = append(doc.Merchants, ExportMerchant{
+				PersonID: info.PersonID,
+				GroupID:  groupID,
+				CostDir:  info.CostDir,
+			})
+
+			personIDs = fnAddID(personIDs, info.PersonID)
+		}
+
+		for _, bill := range group.Bills {
+			fnAddBill(bill)
+		}
+
+		for _, bill := range group.DeletedBills {
+			fnAddBill(bill.GroupBill)
+
+			personIDs = fnAddID(personIDs, bill.DeletedBy)
+		}
+
+		doc.Groups = append(doc.Groups, group)
+	}
+
+	for _, walletID := range walletIDs {
+		var wallet model.Wallet
+
+		wallet, err = s.storage.GetWallet(walletID)
+		if err != nil {
+			err = fmt.Errorf("wallet %d: %w", walletID, err)
+
+			return
+		}
+
+		personIDs = fnAddID(personIDs, wallet.PersonID)
+	}
+
+	for _, personID := range personIDs {
+		var person model.Person
+
+		person, err = s.exportPerson(personID, groupIDs)
+		if err != nil {
+			err = fmt.Errorf("person %d: %w", personID, err)
+
+			return
+		}
+
+		for _, walletID := range person.SubWalletIDs {
+			var wallet model.Wallet
+
+			wallet, err = s.storage.GetWallet(walletID)
+			if err != nil {
+				err = fmt.Errorf("wallet %d: %w", walletID, err)
+
+				return
+			}
+
+			doc.Wallets = append(doc.Wallets, wallet)
+		}
+
+		doc.Persons = append(doc.Persons, person)
+	}
+
+	doc.Labels, err = s.storage.GetLabels()
+	if err != nil {
+		return
+	}
+
+	slices.SortFunc(doc.Labels, func(a, b model.Label) int {
+		return compareID(a.ID, b.ID)
+	})
+
+	return
+}
+
+func (s *Server) exportGroup(groupID uint64, name string) (group ExportGroup, err error) {
+	group.ID = groupID
+	group.Name = name
+
+	group.MemberPersonIDs, group.AdminPersonIDs, err = s.storage.GetGroupPersonIDs(groupID)
+	if err != nil {
+		return
+	}
+
+	group.BaseCurrency, err = s.storage.GetGroupBaseCurrency(groupID)
+	if err != nil {
+		return
+	}
+
+	group.Labels, err = s.storage.GetGroupLabels(groupID)
+	if err != nil {
+		return
+	}
+
+	slices.SortFunc(group.Labels, func(a, b model.Label) int {
+		return compareID(a.ID, b.ID)
+	})
+
+	group.Bills, err = s.storage.GetBills(groupID)
+	if err != nil {
+		return
+	}
+
+	group.DeletedBills, err = s.storage.GetDeletedBills(groupID)
+
+	return
+}
+
+func (s *Server) exportPerson(personID uint64, groupIDs []uint64) (person model.Person, err error) {
+	person.ID = personID
+
+	person.Name, err = s.storage.GetPersonName(personID)
+	if err != nil {
+		return
+	}
+
+	person.SubWalletIDs, err = s.storage.GetPersonWalletIDs(personID)
+	if err != nil {
+		return
+	}
+
+	personGroupIDs, err := s.storage.GetPersonGroupsIDs(personID)
+	if err != nil {
+		return
+	}
+
+	// only the exported groups
+	for _, groupID := range personGroupIDs {
+		if slices.Contains(groupIDs, groupID) {
+			person.Groups = append(person.Groups, groupID)
+		}
+	}
+
+	return
+}
+
+func compareID(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+//
+//
+//
+
+// check makes sure all references of doc are in doc, so the import fails before it writes anything.
+func (doc *ExportDocument) check() error {
+	if doc.Version < 1 || doc.Version > exportDocumentVersion {
+		return fmt.Errorf("%w: unsupported export version %d", commerr.ErrInvalidArgument, doc.Version)
+	}
+
+	personIDs := make(map[uint64]bool, len(doc.Persons))
+	for _, person := range doc.Persons {
+		personIDs[person.ID] = true
+	}
+
+	walletIDs := make(map[uint64]bool, len(doc.Wallets))
+
+	for _, wallet := range doc.Wallets {
+		if !personIDs[wallet.PersonID] {
+			return fmt.Errorf("%w: unknown person %d of wallet %d", commerr.ErrInvalidArgument, wallet.PersonID, wallet.ID)
+		}
+
+		walletIDs[wallet.ID] = true
+	}
+
+	if !personIDs[doc.PersonID] {
+		return fmt.Errorf("%w: unknown exporting person %d", commerr.ErrInvalidArgument, doc.PersonID)
+	}
+
+	for _, merchant := range doc.Merchants {
+		if !personIDs[merchant.PersonID] {
+			return fmt.Errorf("%w: unknown merchant person %d", commerr.ErrInvalidArgument, merchant.PersonID)
+		}
+	}
+
+	labelIDs := make(map[uint64]bool, len(doc.Labels))
+	for _, label := range doc.Labels {
+		labelIDs[label.ID] = true
+	}
+
+	for _, group := range doc.Groups {
+		for _, personID := range append(slices.Clone(group.MemberPersonIDs), group.AdminPersonIDs...) {
+			if !personIDs[personID] {
+				return fmt.Errorf("%w: unknown person %d of group %s", commerr.ErrInvalidArgument, personID, group.Name)
+			}
+		}
+
+		groupLabelIDs := make(map[uint64]bool, len(group.Labels))
+		for _, label := range group.Labels {
+			groupLabelIDs[label.ID] = true
+		}
+
+		bills := slices.Clone(group.Bills)
+		for _, bill := range group.DeletedBills {
+			if bill.DeletedBy != 0 && !personIDs[bill.DeletedBy] {
+				return fmt.Errorf("%w: unknown deleting person of bill %s", commerr.ErrInvalidArgument, bill.ID)
+			}
+
+			bills = append(bills, bill.GroupBill)
+		}
+
+		for _, bill := range bills {
+			if !walletIDs[bill.FromSubWalletID] || !walletIDs[bill.ToSubWalletID] ||
+				(bill.LossWalletID != 0 && !walletIDs[bill.LossWalletID]) {
+				return fmt.Errorf("%w: unknown wallet of bill %s", commerr.ErrInvalidArgument, bill.ID)
+			}
+
+			if bill.OperationPersonID != 0 && !personIDs[bill.OperationPersonID] {
+				return fmt.Errorf("%w: unknown operation person of bill %s", commerr.ErrInvalidArgument, bill.ID)
+			}
+
+			for _, labelID := range bill.LabelIDs {
+				if !labelIDs[labelID] && !groupLabelIDs[labelID] {
+					return fmt.Errorf("%w: unknown label %d of bill %s", commerr.ErrInvalidArgument, labelID, bill.ID)
+				}
+			}
+
+			if bill.Split != nil {
+				for _, share := range bill.Split.Shares {
+					if !personIDs[share.PersonID] {
+						return fmt.Errorf("%w: unknown split person of bill %s", commerr.ErrInvalidArgument, bill.ID)
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// importIDs maps the IDs of the export document to the IDs of this server.
+type importIDs struct {
+	persons map[uint64]uint64
+	wallets map[uint64]uint64
+	labels  map[uint64]uint64 // labels and group labels
+
+	// created on this server, removed if the import fails
+	createdGroupIDs  []uint64
+	createdPersonIDs []uint64
+	createdWalletIDs []uint64 // of the importing person, the ones of the created persons go with them
+	createdLabelIDs  []uint64
+	merchantSet      bool // the importing person became a merchant
+}
+
+func (ids *importIDs) bill(bill model.GroupBill) model.GroupBill {
+	bill.ID = ""
+	bill.FromSubWalletID = ids.wallets[bill.FromSubWalletID]
+	bill.ToSubWalletID = ids.wallets[bill.ToSubWalletID]
+	bill.LossWalletID = ids.wallets[bill.LossWalletID]
+	bill.OperationPersonID = ids.persons[bill.OperationPersonID]
+	bill.Attachments = nil
+
+	labelIDs := make([]uint64, 0, len(bill.LabelIDs))
+	for _, labelID := range bill.LabelIDs {
+		labelIDs = append(labelIDs, ids.labels[labelID])
+	}
+
+	bill.LabelIDs = labelIDs
+
+	if bill.Split != nil {
+		split := &model.BillSplit{
+			Mode:   bill.Split.Mode,
+			Shares: slices.Clone(bill.Split.Shares),
+		}
+
+		for idx := range split.Shares {
+			split.Shares[idx].PersonID = ids.persons[split.Shares[idx].PersonID]
+		}
+
+		bill.Split = split
+	}
+
+	return bill
+}
+
+// importDocument recreates the entities of doc for the person uid and records the bills again, the created
+// entities are removed if it fails.
+func (s *Server) importDocument(uid uint64, doc ExportDocument) (report ImportReport, err error) {
+	if err = doc.check(); err != nil {
+		return
+	}
+
+	if err = s.checkImportGroupNames(doc.Groups); err != nil {
+		return
+	}
+
+	ids := &importIDs{
+		persons: map[uint64]uint64{0: 0},
+		wallets: map[uint64]uint64{0: 0},
+		labels:  make(map[uint64]uint64),
+	}
+
+	defer func() {
+		if err != nil {
+			s.rollBackImport(uid, ids)
+		}
+	}()
+
+	if err = s.importPersons(uid, doc, ids, &report); err != nil {
+		return
+	}
+
+	if err = s.importLabels(doc.Labels, ids, &report); err != nil {
+		return
+	}
+
+	for _, merchant := range doc.Merchants {
+		if merchant.GroupID != 0 {
+			continue
+		}
+
+		personID := ids.persons[merchant.PersonID]
+
+		if _, ok := s.storage.IsMerchantPerson(personID); !ok && personID == uid {
+			ids.merchantSet = true
+		}
+
+		if err = s.storage.SetPersonMerchant(personID, merchant.CostDir); err != nil {
+			return
+		}
+	}
+
+	var records []storage.GroupRecord // the statistics are added once all groups are imported
+
+	for _, group := range doc.Groups {
+		var (
+			groupID      uint64
+			groupRecords []storage.GroupRecord
+		)
+
+		groupID, err = s.storage.NewGroup(group.Name, uid)
+		if err == nil {
+			ids.createdGroupIDs = append(ids.createdGroupIDs, groupID)
+			report.Groups++
+
+			groupRecords, err = s.importGroup(uid, groupID, group, doc.Merchants, ids, &report)
+		}
+
+		if err != nil {
+			err = fmt.Errorf("group %s: %w", group.Name, err)
+
+			return
+		}
+
+		records = append(records, groupRecords...)
+	}
+
+	for _, record := range records {
+		s.statOnAddRecord(record.GroupID, record.Bill.LabelIDs, record.Bill)
+	}
+
+	return
+}
+
+// rollBackImport removes what a failed import created, the groups first as they refer to the rest.
+func (s *Server) rollBackImport(uid uint64, ids *importIDs) {
+	fnLog := func(err error, what string, id uint64) {
+		if err != nil {
+			s.logger.WithFields(l.ErrorField(err), l.StringField("what", what), l.UInt64Field("id", id)).
+				Error("remove imported entity failed")
+		}
+	}
+
+	for _, groupID := range ids.createdGroupIDs {
+		fnLog(s.storage.RemoveGroup(groupID), "group", groupID)
+	}
+
+	for _, personID := range ids.createdPersonIDs {
+		fnLog(s.storage.RemovePerson(personID), "person", personID)
+	}
+
+	for _, walletID := range ids.createdWalletIDs {
+		fnLog(s.storage.RemoveWallet(walletID), "wallet", walletID)
+	}
+
+	for _, labelID := range ids.createdLabelIDs {
+		fnLog(s.storage.RemoveLabel(labelID), "label", labelID)
+	}
+
+	if ids.merchantSet {
+		fnLog(s.storage.RemovePersonMerchant(uid), "merchant", uid)
+	}
+}
+
+func (s *Server) checkImportGroupNames(groups []ExportGroup) error {
+	groupIDs, err := s.storage.GetGroupIDs()
+	if err != nil {
+		return err
+	}
+
+	names, err := s.storage.GetGroupNames(groupIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		if slices.Contains(names, group.Name) {
+			return fmt.Errorf("%w: group %s", commerr.ErrAlreadyExists, group.Name)
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) importPersons(uid uint64, doc ExportDocument, ids *importIDs, report *ImportReport) (err error) {
+	for _, person := range doc.Persons {
+		if person.ID == doc.PersonID {
+			ids.persons[person.ID] = uid
+
+			continue
+		}
+
+		personID, e := s.newImportPerson(person.Name)
+		if e != nil {
+			return fmt.Errorf("person %s: %w", person.Name, e)
+		}
+
+		ids.persons[person.ID] = personID
+		ids.createdPersonIDs = append(ids.createdPersonIDs, personID)
+		report.Persons++
+	}
+
+	walletNames := make(map[uint64]map[string]uint64)
+
+	for _, wallet := range doc.Wallets {
+		personID := ids.persons[wallet.PersonID]
+
+		if walletNames[personID] == nil {
+			if walletNames[personID], err = s.personWalletNames(personID); err != nil {
+				return
+			}
+		}
+
+		walletID, ok := walletNames[personID][wallet.Name]
+		if !ok {
+			if walletID, err = s.storage.NewWallet(wallet.Name, personID); err != nil {
+				return fmt.Errorf("wallet %s: %w", wallet.Name, err)
+			}
+
+			if personID == uid {
+				ids.createdWalletIDs = append(ids.createdWalletIDs, walletID)
+			}
+
+			if wallet.Currency != "" {
+				if err = s.storage.SetWalletCurrency(walletID, wallet.Currency); err != nil {
+					return
+				}
+			}
+
+			walletNames[personID][wallet.Name] = walletID
+			report.Wallets++
+		}
+
+		ids.wallets[wallet.ID] = walletID
+	}
+
+	return
+}
+
+// newImportPerson creates the person name, or name#2, name#3 ... if the name is taken.
+func (s *Server) newImportPerson(name string) (personID uint64, err error) {
+	newName := name
+
+	for n := 2; ; n++ {
+		personID, _, err = s.storage.NewPerson(newName)
+		if !errors.Is(err, commerr.ErrAlreadyExists) {
+			return
+		}
+
+		newName = fmt.Sprintf("%s#%d", name, n)
+	}
+}
+
+func (s *Server) personWalletNames(personID uint64) (names map[string]uint64, err error) {
+	walletIDs, err := s.storage.GetPersonWalletIDs(personID)
+	if err != nil {
+		return
+	}
+
+	names = make(map[string]uint64, len(walletIDs))
+
+	for _, walletID := range walletIDs {
+		wallet, e := s.storage.GetWallet(walletID)
+		if e != nil {
+			continue
+		}
+
+		names[wallet.Name] = wallet.ID
+	}
+
+	return
+}
+
+func (s *Server) importLabels(labels []model.Label, ids *importIDs, report *ImportReport) error {
+	existingLabels, err := s.storage.GetLabels()
+	if err != nil {
+		return err
+	}
+
+	for _, label := range labels {
+		idx := slices.IndexFunc(existingLabels, func(existingLabel model.Label) bool {
+			return existingLabel.Name == label.Name
+		})
+		if idx >= 0 {
+			ids.labels[label.ID] = existingLabels[idx].ID
+
+			continue
+		}
+
+		labelID, err := s.storage.NewLabel(label.Name)
+		if err != nil {
+			return fmt.Errorf("label %s: %w", label.Name, err)
+		}
+
+		ids.labels[label.ID] = labelID
+		ids.createdLabelIDs = append(ids.createdLabelIDs, labelID)
+		report.Labels++
+	}
+
+	return nil
+}
+
+// importGroup fills the created group groupID and returns its recorded bills.
+func (s *Server) importGroup(uid, groupID uint64, group ExportGroup, merchants []ExportMerchant, ids *importIDs,
+	report *ImportReport) (records []storage.GroupRecord, err error) {
+	if group.BaseCurrency != "" {
+		if err = s.storage.SetGroupBaseCurrency(groupID, group.BaseCurrency); err != nil {
+			return
+		}
+	}
+
+	for _, personID := range group.MemberPersonIDs {
+		if ids.persons[personID] == uid {
+			continue
+		}
+
+		if err = s.storage.JoinGroup(groupID, ids.persons[personID]); err != nil {
+			return
+		}
+	}
+
+	for _, personID := range group.AdminPersonIDs {
+		if ids.persons[personID] == uid {
+			continue
+		}
+
+		if err = s.storage.SetGroupAdmin(groupID, ids.persons[personID], true); err != nil {
+			return
+		}
+	}
+
+	for _, label := range group.Labels {
+		var labelID uint64
+
+		if labelID, err = s.storage.NewGroupLabel(groupID, label.Name); err != nil {
+			return
+		}
+
+		ids.labels[label.ID] = labelID
+	}
+
+	for _, merchant := range merchants {
+		if merchant.GroupID != group.ID {
+			continue
+		}
+
+		err = s.storage.SetPersonGroupMerchant(ids.persons[merchant.PersonID], groupID, merchant.CostDir)
+		if err != nil {
+			return
+		}
+	}
+
+	records = make([]storage.GroupRecord, 0, len(group.Bills))
+
+	for _, bill := range group.Bills {
+		records = append(records, storage.GroupRecord{
+			GroupID: groupID,
+			Bill:    ids.bill(bill),
+		})
+	}
+
+	if len(records) > 0 {
+		var billIDs []string
+
+		if billIDs, err = s.storage.RecordBatch(records); err != nil {
+			return
+		}
+
+		for idx := range records {
+			records[idx].Bill.ID = billIDs[idx]
+		}
+
+		report.Bills += len(records)
+	}
+
+	for _, bill := range group.DeletedBills {
+		bill.GroupBill = ids.bill(bill.GroupBill)
+		bill.DeletedBy = ids.persons[bill.DeletedBy]
+
+		if _, err = s.storage.AddDeletedBill(groupID, bill); err != nil {
+			return
+		}
+
+		report.DeletedBills++
+	}
+
+	return
+}
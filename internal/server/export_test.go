@@ -0,0 +1,275 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/i/commerr"
+	"github.com/stretchr/testify/assert"
+)
+
+type utExportSource struct {
+	s        *Server
+	personID uint64
+	groupID  uint64
+	bill     model.GroupBill
+}
+
+// utNewExportSource returns a server with the group home of zjz and zym, a split bill to a merchant and
+// a bill deleted by zym.
+func utNewExportSource(t *testing.T, dir string) (src utExportSource) {
+	src.s = utNewServer(t, dir)
+
+	zjzID, zjzWalletID, err := src.s.storage.NewPersonEx("zjz", 1001)
+	assert.Nil(t, err)
+
+	zymID, _, err := src.s.storage.NewPersonEx("zym", 1002)
+	assert.Nil(t, err)
+
+	shopID, shopWalletID, err := src.s.storage.NewPerson("shop")
+	assert.Nil(t, err)
+	assert.Nil(t, src.s.storage.SetPersonMerchant(shopID, model.CostDirOut))
+
+	src.personID = zjzID
+
+	src.groupID, err = src.s.storage.NewGroup("home", zjzID)
+	assert.Nil(t, err)
+	assert.Nil(t, src.s.storage.JoinGroup(src.groupID, zymID))
+
+	labelID, err := src.s.storage.NewGroupLabel(src.groupID, "rent")
+	assert.Nil(t, err)
+
+	src.bill = utRecord(t, src.s, src.groupID, model.GroupBill{
+		FromSubWalletID:   zjzWalletID,
+		ToSubWalletID:     shopWalletID,
+		CostDir:           model.CostDirOut,
+		Amount:            90,
+		LabelIDs:          []uint64{labelID},
+		Remark:            "dinner",
+		At:                utAt(2024, 2, 29, 12),
+		OperationPersonID: zjzID,
+		Split: &model.BillSplit{
+			Mode: model.SplitModeAmount,
+			Shares: []model.SplitShare{
+				{PersonID: zjzID, Amount: 45},
+				{PersonID: zymID, Amount: 45},
+			},
+		},
+	})
+
+	deletedBillID, err := src.s.storage.Record(src.groupID, model.GroupBill{
+		FromSubWalletID: zjzWalletID,
+		ToSubWalletID:   shopWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          30,
+		At:              utAt(2024, 3, 1, 12),
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, src.s.storage.DeleteRecord(src.groupID, deletedBillID, zymID))
+
+	return
+}
+
+// utExportDocument exports the document of personID through JSON like the export handler.
+func utExportDocument(t *testing.T, s *Server, personID uint64) (doc ExportDocument) {
+	exported, err := s.exportDocument(personID)
+	assert.Nil(t, err)
+
+	d, err := json.Marshal(exported)
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(d, &doc))
+
+	return
+}
+
+func TestExportImport(t *testing.T) {
+	src := utNewExportSource(t, "export-src")
+
+	doc := utExportDocument(t, src.s, src.personID)
+
+	dst := utNewServer(t, "export-dst")
+
+	meID, _, err := dst.storage.NewPersonEx("me", 2001)
+	assert.Nil(t, err)
+
+	// users of the importing server with the names of the exported persons
+	zymID, _, err := dst.storage.NewPersonEx("zym", 2002)
+	assert.Nil(t, err)
+
+	_, _, err = dst.storage.NewPerson("shop")
+	assert.Nil(t, err)
+
+	report, err := dst.importDocument(meID, doc)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(doc.Persons)-1, report.Persons)
+	assert.EqualValues(t, 1, report.Groups)
+	assert.EqualValues(t, 1, report.Bills)
+	assert.EqualValues(t, 1, report.DeletedBills)
+
+	groupIDs, err := dst.storage.GetPersonGroupsIDs(meID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(groupIDs))
+
+	groupID := groupIDs[0]
+
+	// the existing persons are not matched by name
+	groupIDs, err = dst.storage.GetPersonGroupsIDs(zymID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(groupIDs))
+
+	importedZymID, err := dst.storage.GetPersonIDByName("zym#2")
+	assert.Nil(t, err)
+
+	importedShopID, err := dst.storage.GetPersonIDByName("shop#2")
+	assert.Nil(t, err)
+
+	_, ok := dst.storage.IsMerchantPerson(importedShopID)
+	assert.True(t, ok)
+
+	memberIDs, adminIDs, err := dst.storage.GetGroupPersonIDs(groupID)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []uint64{meID, importedZymID}, memberIDs)
+	assert.EqualValues(t, []uint64{meID}, adminIDs)
+
+	bills, err := dst.storage.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(bills))
+
+	bill := bills[0]
+	assert.EqualValues(t, src.bill.Amount, bill.Amount)
+	assert.EqualValues(t, src.bill.Remark, bill.Remark)
+	assert.EqualValues(t, src.bill.At, bill.At)
+	assert.EqualValues(t, meID, bill.OperationPersonID)
+	assert.EqualValues(t, []model.SplitShare{
+		{PersonID: meID, Amount: 45},
+		{PersonID: importedZymID, Amount: 45},
+	}, bill.Split.Shares)
+
+	fromWallet, err := dst.storage.GetWallet(bill.FromSubWalletID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, meID, fromWallet.PersonID)
+
+	toWallet, err := dst.storage.GetWallet(bill.ToSubWalletID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, importedShopID, toWallet.PersonID)
+
+	assert.EqualValues(t, 1, len(bill.LabelIDs))
+
+	labelName, err := dst.storage.GetGroupLabelName(bill.LabelIDs[0], groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "rent", labelName)
+
+	deletedBills, err := dst.storage.GetDeletedBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(deletedBills))
+	assert.EqualValues(t, importedZymID, deletedBills[0].DeletedBy)
+	assert.True(t, doc.Groups[0].DeletedBills[0].DeletedAt.Equal(deletedBills[0].DeletedAt))
+
+	at := time.Unix(src.bill.At, 0)
+	assert.EqualValues(t, src.s.statisticsResponseByKey(billStatKey(src.groupID, src.groupID), at),
+		dst.statisticsResponseByKey(billStatKey(groupID, groupID), at))
+
+	// and back
+	reexported := utExportDocument(t, dst, meID)
+	assert.EqualValues(t, len(doc.Groups), len(reexported.Groups))
+	assert.EqualValues(t, doc.Groups[0].Name, reexported.Groups[0].Name)
+	assert.EqualValues(t, len(doc.Groups[0].Bills), len(reexported.Groups[0].Bills))
+	assert.EqualValues(t, len(doc.Groups[0].DeletedBills), len(reexported.Groups[0].DeletedBills))
+	assert.EqualValues(t, doc.Groups[0].Bills[0].Amount, reexported.Groups[0].Bills[0].Amount)
+	assert.EqualValues(t, len(doc.Groups[0].MemberPersonIDs), len(reexported.Groups[0].MemberPersonIDs))
+}
+
+func TestImportRollBack(t *testing.T) {
+	src := utNewExportSource(t, "import-rollback-src")
+
+	workGroupID, err := src.s.storage.NewGroup("work", src.personID)
+	assert.Nil(t, err)
+
+	utRecord(t, src.s, workGroupID, model.GroupBill{
+		FromSubWalletID: src.bill.FromSubWalletID,
+		ToSubWalletID:   src.bill.ToSubWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          20,
+		At:              utAt(2024, 3, 2, 12),
+	})
+
+	_, err = src.s.storage.NewWallet("cash", src.personID)
+	assert.Nil(t, err)
+
+	_, err = src.s.storage.NewLabel("food")
+	assert.Nil(t, err)
+
+	doc := utExportDocument(t, src.s, src.personID)
+	assert.EqualValues(t, 2, len(doc.Groups))
+
+	// the bills of the last group are recorded after the other group is imported
+	lastGroup := &doc.Groups[len(doc.Groups)-1]
+	amount := lastGroup.Bills[0].Amount
+	lastGroup.Bills[0].Amount = 0
+
+	dst := utNewServer(t, "import-rollback-dst")
+
+	meID, _, err := dst.storage.NewPersonEx("me", 2001)
+	assert.Nil(t, err)
+
+	walletIDs, err := dst.storage.GetPersonWalletIDs(meID)
+	assert.Nil(t, err)
+
+	labels, err := dst.storage.GetLabels()
+	assert.Nil(t, err)
+
+	merchants := dst.storage.GetMerchantPersons()
+
+	_, err = dst.importDocument(meID, doc)
+	assert.NotNil(t, err)
+
+	groupIDs, err := dst.storage.GetGroupIDs()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(groupIDs))
+
+	groupIDs, err = dst.storage.GetPersonGroupsIDs(meID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(groupIDs))
+
+	// nothing created is left
+	for _, name := range []string{"zym", "shop"} {
+		_, err = dst.storage.GetPersonIDByName(name)
+		assert.ErrorIs(t, err, commerr.ErrNotFound, name)
+	}
+
+	assert.ElementsMatch(t, merchants, dst.storage.GetMerchantPersons())
+
+	rolledBackWalletIDs, err := dst.storage.GetPersonWalletIDs(meID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, walletIDs, rolledBackWalletIDs)
+
+	rolledBackLabels, err := dst.storage.GetLabels()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, labels, rolledBackLabels)
+
+	// the retry doesn't fail on the names of the removed groups nor duplicate the persons
+	lastGroup.Bills[0].Amount = amount
+
+	report, err := dst.importDocument(meID, doc)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, report.Groups)
+	assert.EqualValues(t, 2, report.Bills)
+
+	groupIDs, err = dst.storage.GetPersonGroupsIDs(meID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(groupIDs))
+
+	importedWalletIDs, err := dst.storage.GetPersonWalletIDs(meID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(walletIDs)+1, len(importedWalletIDs)) // cash
+
+	for _, name := range []string{"zym", "shop"} {
+		_, err = dst.storage.GetPersonIDByName(name)
+		assert.Nil(t, err, name)
+
+		_, err = dst.storage.GetPersonIDByName(name + "#2")
+		assert.ErrorIs(t, err, commerr.ErrNotFound, name)
+	}
+}
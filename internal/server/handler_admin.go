@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sgostarter/i/l"
+)
+
+func (s *Server) handleAdminBackup(c *gin.Context) {
+	snapshotDir, manifest, code, msg := s.handleAdminBackupInner(c)
+	if code != CodeSuccess {
+		respWrapper := &ResponseWrapper{}
+		respWrapper.Apply(code, msg)
+
+		c.JSON(http.StatusOK, respWrapper)
+
+		return
+	}
+
+	defer os.RemoveAll(snapshotDir)
+
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="lifecost-backup-%s.tar.gz"`,
+		time.Unix(manifest.CreatedAt, 0).Format("20060102150405")))
+	c.Status(http.StatusOK)
+
+	if err := writeBackupArchive(c.Writer, snapshotDir, manifest); err != nil {
+		s.logger.WithFields(l.ErrorField(err)).Error("write backup archive failed")
+	}
+}
+
+func (s *Server) handleAdminBackupInner(c *gin.Context) (snapshotDir string, manifest BackupManifest, code Code,
+	msg string) {
+	_, _, userName, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	if !s.cfg.IsAdmin(userName) {
+		code = CodeDisabled
+		msg = "无权限"
+
+		return
+	}
+
+	snapshotDir, manifest, err := snapshotData(s.cfg, func(fn func() error) error {
+		s.statLock.Lock()
+		defer s.statLock.Unlock()
+
+		return s.accountStorage.quiesce(func() error {
+			return s.storage.Quiesce(fn)
+		})
+	})
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	s.logger.WithFields(l.StringField("user", userName), l.IntField("files", len(manifest.Files))).
+		Info("backup snapshot")
+
+	code = CodeSuccess
+
+	return
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	maxAttachmentSize = 8 << 20
+	uploadReadTimeout = 2 * time.Minute
+)
+
+var allowedAttachmentContentTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"application/pdf",
+}
+
+func (s *Server) handleRecordAttachmentUpload(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	attachment, code, msg := s.handleRecordAttachmentUploadInner(c)
+	if code == CodeSuccess {
+		respWrapper.Resp = attachment
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleRecordAttachmentUploadInner(c *gin.Context) (attachment model.Attachment, code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	recordID := c.Param("id")
+	if recordID == "" {
+		code = CodeInternalError
+		msg = MsgNoRecordID
+
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	if fileHeader.Size > maxAttachmentSize {
+		code = CodeInvalidArgs
+		msg = "文件太大"
+
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	defer file.Close()
+
+	d, err := io.ReadAll(io.LimitReader(file, maxAttachmentSize+1))
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	if len(d) == 0 || len(d) > maxAttachmentSize {
+		code = CodeInvalidArgs
+		msg = "文件大小非法"
+
+		return
+	}
+
+	contentType := http.DetectContentType(d)
+	if !slices.Contains(allowedAttachmentContentTypes, contentType) {
+		code = CodeInvalidArgs
+		msg = "不支持的文件类型"
+
+		return
+	}
+
+	groupIDs, err := s.storage.GetPersonGroupsIDs(uid)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	billGroupIDs := make([]uint64, 0, len(groupIDs))
+
+	for _, groupID := range groupIDs {
+		if _, err = s.storage.GetBill(groupID, recordID); err == nil {
+			billGroupIDs = append(billGroupIDs, groupID)
+		}
+	}
+
+	if len(billGroupIDs) == 0 {
+		code = CodeInvalidArgs
+		msg = "记录不存在"
+
+		return
+	}
+
+	attachment, err = s.storage.SaveAttachment(fileHeader.Filename, contentType, d)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	defer s.storage.ReleaseAttachment(attachment.ID)
+
+	for _, groupID := range billGroupIDs {
+		err = s.storage.AddBillAttachment(groupID, recordID, attachment)
+		if err != nil && !errors.Is(err, commerr.ErrAlreadyExists) {
+			s.logger.WithFields(l.ErrorField(err), l.UInt64Field("groupID", groupID),
+				l.StringField("recordID", recordID)).Error("add bill attachment failed")
+
+			code = CodeInternalError
+			msg = err.Error()
+
+			return
+		}
+	}
+
+	code = CodeSuccess
+
+	return
+}
+
+func (s *Server) handleRecordAttachmentDelete(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	respWrapper.Apply(s.handleRecordAttachmentDeleteInner(c))
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleRecordAttachmentDeleteInner(c *gin.Context) (code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	recordID := c.Param("id")
+	if recordID == "" {
+		code = CodeInternalError
+		msg = MsgNoRecordID
+
+		return
+	}
+
+	attachmentID := c.Param("aid")
+
+	groupIDs, err := s.storage.GetPersonGroupsIDs(uid)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	for _, groupID := range groupIDs {
+		err = s.storage.RemoveBillAttachment(groupID, recordID, attachmentID)
+		if err != nil && !errors.Is(err, commerr.ErrNotFound) {
+			s.logger.WithFields(l.ErrorField(err), l.UInt64Field("groupID", groupID),
+				l.StringField("recordID", recordID)).Error("remove bill attachment failed")
+		}
+	}
+
+	code = CodeSuccess
+
+	return
+}
+
+func (s *Server) handleAttachmentDownload(c *gin.Context) {
+	d, code, msg := s.handleAttachmentDownloadInner(c)
+	if code != CodeSuccess {
+		respWrapper := &ResponseWrapper{}
+		respWrapper.Apply(code, msg)
+
+		c.JSON(http.StatusOK, respWrapper)
+
+		return
+	}
+
+	contentType := http.DetectContentType(d)
+
+	// c.Data keeps the json content type set by JSONMiddleware
+	c.Header("Content-Type", contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	c.Data(http.StatusOK, contentType, d)
+}
+
+func (s *Server) handleAttachmentDownloadInner(c *gin.Context) (d []byte, code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	recordID := c.Param("id")
+	if recordID == "" {
+		code = CodeInternalError
+		msg = MsgNoRecordID
+
+		return
+	}
+
+	attachmentID := c.Param("aid")
+
+	groupIDs, err := s.storage.GetPersonGroupsIDs(uid)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	var referenced bool
+
+	// only the named record is checked, live or deleted
+	for _, groupID := range groupIDs {
+		referenced, err = s.storage.HasBillAttachment(groupID, recordID, attachmentID)
+		if err != nil {
+			code = CodeInternalError
+			msg = err.Error()
+
+			return
+		}
+
+		if referenced {
+			break
+		}
+	}
+
+	if !referenced {
+		code = CodeDisabled
+		msg = "无权限"
+
+		return
+	}
+
+	d, err = s.storage.ReadAttachment(attachmentID)
+	if err != nil {
+		if errors.Is(err, commerr.ErrInvalidArgument) || errors.Is(err, commerr.ErrNotFound) {
+			code = CodeInvalidArgs
+		} else {
+			code = CodeInternalError
+		}
+
+		msg = err.Error()
+
+		return
+	}
+
+	code = CodeSuccess
+
+	return
+}
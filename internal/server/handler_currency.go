@@ -0,0 +1,153 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/i/commerr"
+)
+
+func (s *Server) handleGroupBaseCurrency(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	respWrapper.Apply(s.handleGroupBaseCurrencyInner(c))
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleGroupBaseCurrencyInner(c *gin.Context) (code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	var req GroupBaseCurrencyRequest
+
+	err := c.BindJSON(&req)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	if !req.Valid() {
+		code = CodeInvalidArgs
+
+		return
+	}
+
+	groupID, ok := s.getGroupID4Person(uid, req.GroupID)
+	if !ok {
+		code = CodeInvalidArgs
+		msg = "invalid group id"
+
+		return
+	}
+
+	if f, _ := s.storage.IsGroupAdmin(groupID, uid); !f {
+		code = CodeDisabled
+		msg = "无权限"
+
+		return
+	}
+
+	err = s.storage.SetGroupBaseCurrency(groupID, req.Currency)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	code = CodeSuccess
+
+	return
+}
+
+func (s *Server) handleGetExchangeRates(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	rates, code, msg := s.handleGetExchangeRatesInner(c)
+	if code == CodeSuccess {
+		respWrapper.Resp = GetExchangeRatesResponse{
+			Rates: rates,
+		}
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleGetExchangeRatesInner(c *gin.Context) (rates []model.ExchangeRate, code Code, msg string) {
+	_, _, _, code, msg = s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	rates, err := s.storage.GetExchangeRates()
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	return
+}
+
+func (s *Server) handleExchangeRateSet(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	respWrapper.Apply(s.handleExchangeRateSetInner(c))
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleExchangeRateSetInner(c *gin.Context) (code Code, msg string) {
+	_, _, _, code, msg = s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	var req ExchangeRateSetRequest
+
+	err := c.BindJSON(&req)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	if !req.Valid() {
+		code = CodeMissArgs
+
+		return
+	}
+
+	err = s.storage.SetExchangeRate(model.ExchangeRate{
+		From: req.From,
+		To:   req.To,
+		Date: req.Date,
+		Rate: req.Rate,
+	})
+	if err != nil {
+		if errors.Is(err, commerr.ErrInvalidArgument) {
+			code = CodeInvalidArgs
+		} else {
+			code = CodeInternalError
+		}
+
+		msg = err.Error()
+
+		return
+	}
+
+	code = CodeSuccess
+
+	return
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+)
+
+func (s *Server) handleExport(c *gin.Context) {
+	doc, code, msg := s.handleExportInner(c)
+	if code != CodeSuccess {
+		respWrapper := &ResponseWrapper{}
+		respWrapper.Apply(code, msg)
+
+		c.JSON(http.StatusOK, respWrapper)
+
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="lifecost-export-%s.json"`,
+		time.Unix(doc.ExportedAt, 0).Format("20060102150405")))
+	c.JSON(http.StatusOK, doc)
+}
+
+func (s *Server) handleExportInner(c *gin.Context) (doc ExportDocument, code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	doc, err := s.exportDocument(uid)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	code = CodeSuccess
+
+	return
+}
+
+func (s *Server) handleImport(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	report, code, msg := s.handleImportInner(c)
+	if code == CodeSuccess {
+		respWrapper.Resp = report
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleImportInner(c *gin.Context) (report ImportReport, code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	var doc ExportDocument
+
+	err := c.BindJSON(&doc)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	report, err = s.importDocument(uid, doc)
+	if err != nil {
+		s.logger.WithFields(l.ErrorField(err), l.UInt64Field("uid", uid)).Error("import failed")
+
+		switch {
+		case errors.Is(err, commerr.ErrAlreadyExists):
+			code = CodeGroupNameExists
+		case errors.Is(err, commerr.ErrInvalidArgument):
+			code = CodeInvalidArgs
+		default:
+			code = CodeInternalError
+		}
+
+		msg = err.Error()
+
+		return
+	}
+
+	code = CodeSuccess
+
+	return
+}
@@ -1,12 +1,16 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/s-min-sys/lifecostbe/internal/storage"
+	"github.com/sgostarter/i/commerr"
 	"github.com/sgostarter/i/l"
 	"github.com/sgostarter/libcomponents/statistic/memdate/ex"
 	"golang.org/x/exp/slices"
@@ -76,7 +80,7 @@ func (s *Server) handleDeleteRecordInner(c *gin.Context) (dayStatistics, weekSta
 			continue
 		}
 
-		err = s.storage.DeleteRecord(groupID, recordID)
+		err = s.storage.DeleteRecord(groupID, recordID, uid)
 		if err != nil {
 			s.logger.WithFields(l.ErrorField(err)).Error("delete record failed")
 
@@ -150,10 +154,35 @@ func (s *Server) handleRecordInner(c *gin.Context) (code Code, msg string) {
 		return
 	}
 
-	return s.recordSingle(uid, req)
+	_, code, msg = s.recordSingleIdempotent(uid, req)
+
+	return
+}
+
+type recordWallets struct {
+	fromPersonGroupIDs []uint64
+	toPersonGroupIDs   []uint64
+	meInFrom           bool
+	meInTo             bool
+	currency           string // currency of the own wallet
 }
 
-func (s *Server) recordSingle(uid uint64, req RecordRequest) (code Code, msg string) {
+func (rw *recordWallets) costDir(groupID uint64) model.CostDir {
+	inFromGroup := slices.Contains(rw.fromPersonGroupIDs, groupID)
+	inToGroup := slices.Contains(rw.toPersonGroupIDs, groupID)
+
+	if (inFromGroup && inToGroup) || (rw.meInFrom && rw.meInTo) {
+		return model.CostDirInGroup
+	}
+
+	if rw.meInFrom {
+		return model.CostDirOut
+	}
+
+	return model.CostDirIn
+}
+
+func (s *Server) checkRecordWallets(uid uint64, req RecordRequest) (rw recordWallets, code Code, msg string) {
 	fromWallet, err := s.storage.GetWallet(req.DFromSubWalletID)
 	if err != nil {
 		code = CodeInvalidArgs
@@ -162,7 +191,7 @@ func (s *Server) recordSingle(uid uint64, req RecordRequest) (code Code, msg str
 		return
 	}
 
-	fromPersonGroupIDs, err := s.storage.GetPersonGroupsIDs(fromWallet.PersonID)
+	rw.fromPersonGroupIDs, err = s.storage.GetPersonGroupsIDs(fromWallet.PersonID)
 	if err != nil {
 		code = CodeInvalidArgs
 		msg = err.Error()
@@ -178,7 +207,7 @@ func (s *Server) recordSingle(uid uint64, req RecordRequest) (code Code, msg str
 		return
 	}
 
-	toPersonGroupIDs, err := s.storage.GetPersonGroupsIDs(toWallet.PersonID)
+	rw.toPersonGroupIDs, err = s.storage.GetPersonGroupsIDs(toWallet.PersonID)
 	if err != nil {
 		code = CodeInvalidArgs
 		msg = err.Error()
@@ -186,10 +215,8 @@ func (s *Server) recordSingle(uid uint64, req RecordRequest) (code Code, msg str
 		return
 	}
 
-	var meInFrom, meInTo bool
-
 	if fromWallet.PersonID == uid {
-		meInFrom = true
+		rw.meInFrom = true
 	} else {
 		if dir := s.checkPersonCostDir(toWallet.PersonID); dir == model.CostDirIn {
 			code = CodeInvalidArgs
@@ -200,7 +227,7 @@ func (s *Server) recordSingle(uid uint64, req RecordRequest) (code Code, msg str
 	}
 
 	if toWallet.PersonID == uid {
-		meInTo = true
+		rw.meInTo = true
 	} else {
 		if dir := s.checkPersonCostDir(fromWallet.PersonID); dir == model.CostDirIn {
 			code = CodeInvalidArgs
@@ -210,24 +237,94 @@ func (s *Server) recordSingle(uid uint64, req RecordRequest) (code Code, msg str
 		}
 	}
 
-	if !meInFrom && !meInTo {
+	if !rw.meInFrom && !rw.meInTo {
 		code = CodeInvalidArgs
 		msg = "not your wallet"
 
 		return
 	}
 
-	groupBill := model.GroupBill{
-		FromSubWalletID:   req.DFromSubWalletID,
-		ToSubWalletID:     req.DToSubWalletID,
-		CostDir:           0,
-		Amount:            req.Amount,
-		LabelIDs:          req.DLabelIDs,
-		Remark:            req.Remark,
-		LossAmount:        req.LossAmount,
-		LossWalletID:      req.DLossWalletID,
-		At:                req.At,
-		OperationPersonID: uid,
+	if rw.meInFrom {
+		rw.currency = fromWallet.Currency
+	} else {
+		rw.currency = toWallet.Currency
+	}
+
+	if req.DSplit != nil && !(rw.meInFrom && !rw.meInTo) {
+		code = CodeInvalidArgs
+		msg = "only spending of your wallet can be split"
+
+		return
+	}
+
+	code = CodeSuccess
+
+	return
+}
+
+// fillBillBaseAmount converts the bill amount into the group base currency for statistics.
+func (s *Server) fillBillBaseAmount(groupID uint64, groupBill *model.GroupBill) {
+	groupBill.BaseAmount = 0
+
+	baseCurrency, err := s.storage.GetGroupBaseCurrency(groupID)
+	if err != nil {
+		return
+	}
+
+	if model.CurrencyOrDefault(groupBill.Currency) == baseCurrency {
+		return
+	}
+
+	rate, err := s.storage.GetExchangeRate(groupBill.Currency, baseCurrency, time.Unix(groupBill.At, 0))
+	if err != nil {
+		s.logger.WithFields(l.ErrorField(err), l.StringField("from", groupBill.Currency),
+			l.StringField("to", baseCurrency)).Warn("no exchange rate, amount is not converted")
+
+		return
+	}
+
+	groupBill.BaseAmount = int(math.Round(float64(groupBill.Amount) * rate))
+}
+
+// checkBillSplit4Group checks that every person sharing the bill is a member of the group.
+func (s *Server) checkBillSplit4Group(groupID uint64, split *model.BillSplit) (code Code, msg string) {
+	if split == nil {
+		code = CodeSuccess
+
+		return
+	}
+
+	memberIDs, _, err := s.storage.GetGroupPersonIDs(groupID)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	for _, share := range split.Shares {
+		if !slices.Contains(memberIDs, share.PersonID) {
+			code = CodeInvalidArgs
+			msg = "分摊人不在组内"
+
+			return
+		}
+	}
+
+	code = CodeSuccess
+
+	return
+}
+
+// prepareRecord builds the bill of req for each group of the operator, nothing is written.
+func (s *Server) prepareRecord(uid uint64, req RecordRequest) (records []storage.GroupRecord, code Code, msg string) {
+	rw, code, msg := s.checkRecordWallets(uid, req)
+	if code != CodeSuccess {
+		return
+	}
+
+	if req.Currency == "" {
+		req.Currency = rw.currency
 	}
 
 	groupIDs, err := s.storage.GetPersonGroupsIDs(uid)
@@ -238,25 +335,197 @@ func (s *Server) recordSingle(uid uint64, req RecordRequest) (code Code, msg str
 		return
 	}
 
+	records = make([]storage.GroupRecord, 0, len(groupIDs))
+
 	for _, groupID := range groupIDs {
-		inFromGroup := slices.Contains(fromPersonGroupIDs, groupID)
-		inToGroup := slices.Contains(toPersonGroupIDs, groupID)
+		if code, msg = s.checkBillSplit4Group(groupID, req.DSplit); code != CodeSuccess {
+			return
+		}
 
-		if (inFromGroup && inToGroup) || (meInFrom && meInTo) {
-			groupBill.CostDir = model.CostDirInGroup
-		} else {
-			if meInFrom {
-				groupBill.CostDir = model.CostDirOut
-			} else {
-				groupBill.CostDir = model.CostDirIn
-			}
+		groupBill := model.GroupBill{
+			FromSubWalletID:   req.DFromSubWalletID,
+			ToSubWalletID:     req.DToSubWalletID,
+			CostDir:           rw.costDir(groupID),
+			Amount:            req.Amount,
+			Currency:          req.Currency,
+			LabelIDs:          req.DLabelIDs,
+			Remark:            req.Remark,
+			LossAmount:        req.LossAmount,
+			LossWalletID:      req.DLossWalletID,
+			At:                req.At,
+			OperationPersonID: uid,
+			Split:             req.DSplit,
+		}
+
+		s.fillBillBaseAmount(groupID, &groupBill)
+
+		records = append(records, storage.GroupRecord{
+			GroupID: groupID,
+			Bill:    groupBill,
+		})
+	}
+
+	code = CodeSuccess
+
+	return
+}
+
+func (s *Server) recordSingle(uid uint64, req RecordRequest) (billIDs []string, code Code, msg string) {
+	return s.recordGroups(uid, req, make(map[uint64]string))
+}
+
+// recordGroups records req in the groups of the operator missing from groupRecordIDs, and adds the new
+// record IDs to it. billIDs includes the records of all the groups.
+func (s *Server) recordGroups(uid uint64, req RecordRequest, groupRecordIDs map[uint64]string) (billIDs []string,
+	code Code, msg string) {
+	records, code, msg := s.prepareRecord(uid, req)
+	if code != CodeSuccess {
+		return
+	}
+
+	for _, record := range records {
+		if billID, ok := groupRecordIDs[record.GroupID]; ok {
+			billIDs = append(billIDs, billID)
+
+			continue
+		}
+
+		billID, err := s.storage.Record(record.GroupID, record.Bill)
+		if err != nil {
+			s.logger.WithFields(l.ErrorField(err), l.UInt64Field("groupID", record.GroupID)).Error("record failed")
+
+			code = CodeInternalError
+			msg = err.Error()
+
+			continue
+		}
+
+		billIDs = append(billIDs, billID)
+		groupRecordIDs[record.GroupID] = billID
+
+		record.Bill.ID = billID
+		s.statOnAddRecord(record.GroupID, record.Bill.LabelIDs, record.Bill)
+	}
+
+	return
+}
+
+func (s *Server) handleUpdateRecord(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	respWrapper.Apply(s.handleUpdateRecordInner(c))
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleUpdateRecordInner(c *gin.Context) (code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	recordID := c.Param("id")
+	if recordID == "" {
+		code = CodeInternalError
+		msg = MsgNoRecordID
+
+		return
+	}
+
+	var req RecordRequest
+
+	err := c.BindJSON(&req)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	if !req.Valid() {
+		code = CodeMissArgs
+
+		return
+	}
+
+	rw, code, msg := s.checkRecordWallets(uid, req)
+	if code != CodeSuccess {
+		return
+	}
+
+	if req.Currency == "" {
+		req.Currency = rw.currency
+	}
+
+	groupIDs, err := s.storage.GetPersonGroupsIDs(uid)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	// the updated groups, restored if a later group fails
+	updatedOldBills := make(map[uint64]model.GroupBill)
+
+	for _, groupID := range groupIDs {
+		if _, err = s.storage.GetBill(groupID, recordID); err != nil {
+			continue
+		}
+
+		if code, msg = s.checkBillSplit4Group(groupID, req.DSplit); code != CodeSuccess {
+			s.restoreUpdatedRecords(updatedOldBills)
+
+			return
 		}
 
-		if e := s.storage.Record(groupID, groupBill); e != nil {
-			s.logger.WithFields(l.ErrorField(e)).Error("record failed")
+		groupBill := model.GroupBill{
+			ID:              recordID,
+			FromSubWalletID: req.DFromSubWalletID,
+			ToSubWalletID:   req.DToSubWalletID,
+			CostDir:         rw.costDir(groupID),
+			Amount:          req.Amount,
+			Currency:        req.Currency,
+			LabelIDs:        req.DLabelIDs,
+			Remark:          req.Remark,
+			LossAmount:      req.LossAmount,
+			LossWalletID:    req.DLossWalletID,
+			At:              req.At,
+			Split:           req.DSplit,
 		}
 
-		s.statOnAddRecord(groupID, req.DLabelIDs, groupBill)
+		s.fillBillBaseAmount(groupID, &groupBill)
+
+		var oldBill model.GroupBill
+
+		// the storage keeps the attachments, operation person and settlement mark of the stored bill
+		oldBill, err = s.storage.UpdateRecord(groupID, groupBill)
+		if err != nil {
+			s.logger.WithFields(l.ErrorField(err), l.UInt64Field("groupID", groupID),
+				l.StringField("recordID", recordID)).Error("update record failed")
+
+			s.restoreUpdatedRecords(updatedOldBills)
+
+			code = CodeInternalError
+			msg = err.Error()
+
+			return
+		}
+
+		// the operator statistics need the operation person kept by the storage
+		groupBill.OperationPersonID = oldBill.OperationPersonID
+
+		s.statOnRemoveRecord(groupID, oldBill)
+		s.statOnAddRecord(groupID, groupBill.LabelIDs, groupBill)
+
+		updatedOldBills[groupID] = oldBill
+	}
+
+	if len(updatedOldBills) == 0 {
+		code = CodeInvalidArgs
+		msg = "记录不存在"
+
+		return
 	}
 
 	code = CodeSuccess
@@ -264,6 +533,22 @@ func (s *Server) recordSingle(uid uint64, req RecordRequest) (code Code, msg str
 	return
 }
 
+// restoreUpdatedRecords writes back the old bills of the groups updated before a failed update.
+func (s *Server) restoreUpdatedRecords(oldBills map[uint64]model.GroupBill) {
+	for groupID, oldBill := range oldBills {
+		newBill, err := s.storage.UpdateRecord(groupID, oldBill)
+		if err != nil {
+			s.logger.WithFields(l.ErrorField(err), l.UInt64Field("groupID", groupID),
+				l.StringField("recordID", oldBill.ID)).Error("restore updated record failed")
+
+			continue
+		}
+
+		s.statOnRemoveRecord(groupID, newBill)
+		s.statOnAddRecord(groupID, oldBill.LabelIDs, oldBill)
+	}
+}
+
 func (s *Server) handleGetRecords(c *gin.Context) {
 	respWrapper := &ResponseWrapper{}
 
@@ -344,29 +629,7 @@ func (s *Server) handleGetRecordsInner(c *gin.Context) (voBills []Bill, hasMore
 		return
 	}
 
-	for _, bill := range bills {
-		voBills = append(voBills, Bill{
-			ID:                bill.ID,
-			FromSubWalletID:   idN2S(bill.FromSubWalletID),
-			FromSubWalletName: s.helperGetWalletName(bill.FromSubWalletID),
-			ToSubWalletID:     idN2S(bill.ToSubWalletID),
-			ToSubWalletName:   s.helperGetWalletName(bill.ToSubWalletID),
-			CostDir:           bill.CostDir,
-			Amount:            bill.Amount,
-			LabelIDs:          idN2Ss(bill.LabelIDs),
-			LabelIDNames:      s.helperGetLabelNames(bill.LabelIDs, uid),
-			Remark:            bill.Remark,
-			LossAmount:        bill.LossAmount,
-			LossWalletID:      idN2S(bill.LossWalletID),
-			LossWalletName:    s.helperGetWalletName(bill.LossWalletID),
-			At:                bill.At,
-			AtS:               time.Unix(bill.At, 0).Format("01/02 15:04"),
-			FromPersonName:    s.helperGetWalletPersonName(bill.FromSubWalletID),
-			ToPersonName:      s.helperGetWalletPersonName(bill.ToSubWalletID),
-			OperationID:       idN2S(bill.OperationPersonID),
-			OperationName:     s.helperPersonName(bill.OperationPersonID),
-		})
-	}
+	voBills = s.billsDo2Po(uid, bills)
 
 	if withStatistics {
 		dayStatistics, weekStatistics, monthStatistics, seasonStatistics,
@@ -379,12 +642,19 @@ func (s *Server) handleGetRecordsInner(c *gin.Context) (voBills []Bill, hasMore
 func (s *Server) handleBatchRecord(c *gin.Context) {
 	respWrapper := &ResponseWrapper{}
 
-	respWrapper.Apply(s.handleBatchRecordInner(c))
+	results, code, msg := s.handleBatchRecordInner(c)
+	if results != nil {
+		respWrapper.Resp = BatchRecordResponse{
+			Results: results,
+		}
+	}
+
+	respWrapper.Apply(code, msg)
 
 	c.JSON(http.StatusOK, respWrapper)
 }
 
-func (s *Server) handleBatchRecordInner(c *gin.Context) (code Code, msg string) {
+func (s *Server) handleBatchRecordInner(c *gin.Context) (results []BatchRecordResult, code Code, msg string) {
 	_, uid, _, code, msg := s.getAndCheckToken(c)
 	if code != CodeSuccess {
 		return
@@ -406,19 +676,155 @@ func (s *Server) handleBatchRecordInner(c *gin.Context) (code Code, msg string)
 		return
 	}
 
-	var allMsg string
+	if req.Atomic {
+		return s.recordBatchAtomic(uid, req.Records)
+	}
+
+	results = make([]BatchRecordResult, len(req.Records))
 
-	for _, r := range req.Records {
-		code, msg = s.recordSingle(uid, r)
-		if code != CodeSuccess {
-			s.logger.WithFields(l.ErrorField(err), l.StringField("msg", msg)).Error("record failed")
+	for idx, r := range req.Records {
+		results[idx].Index = idx
 
-			allMsg += msg + "\n"
+		if !r.Valid() {
+			results[idx].Code = CodeMissArgs
+			results[idx].Message = CodeToMessage(CodeMissArgs, "")
+
+			continue
+		}
+
+		var itemMsg string
+
+		results[idx].RecordIDs, results[idx].Code, itemMsg = s.recordSingleIdempotent(uid, r)
+		results[idx].Message = CodeToMessage(results[idx].Code, itemMsg)
+
+		if results[idx].Code != CodeSuccess {
+			s.logger.WithFields(l.IntField("index", idx), l.StringField("msg", results[idx].Message)).Error("record failed")
 		}
 	}
 
 	code = CodeSuccess
-	msg = allMsg
+
+	return
+}
+
+// recordBatchAtomic writes all the records or none of them, the statistics are only updated after all are written.
+func (s *Server) recordBatchAtomic(uid uint64, reqs []RecordRequest) (results []BatchRecordResult, code Code, msg string) {
+	keys := make([]string, 0, len(reqs))
+	for _, r := range reqs {
+		keys = append(keys, r.IdempotencyKey)
+	}
+
+	defer s.idempotencyLocks.lockKeys(uid, keys...)()
+
+	results = make([]BatchRecordResult, len(reqs))
+
+	var records []storage.GroupRecord
+
+	var recordOwners []int // index of the request for each of records
+
+	var newResultIdxes []int
+
+	keyIdxes := make(map[string]int) // idempotency key - index of its first request
+
+	for idx, r := range reqs {
+		results[idx].Index = idx
+
+		if r.IdempotencyKey != "" {
+			if firstIdx, ok := keyIdxes[r.IdempotencyKey]; ok {
+				itemMsg := fmt.Sprintf("与第%d条记录的幂等键重复", firstIdx+1)
+
+				results[idx].Code = CodeInvalidArgs
+				results[idx].Message = CodeToMessage(CodeInvalidArgs, itemMsg)
+
+				if code == CodeSuccess {
+					code = CodeInvalidArgs
+					msg = fmt.Sprintf("第%d条记录: %s", idx+1, itemMsg)
+				}
+
+				continue
+			}
+
+			keyIdxes[r.IdempotencyKey] = idx
+		}
+
+		result, ok := s.getIdempotencyResult(uid, r.IdempotencyKey)
+		if ok && result.Code == CodeSuccess {
+			results[idx].RecordIDs = result.RecordIDs
+			results[idx].Code = result.Code
+			results[idx].Message = CodeToMessage(result.Code, result.Msg)
+
+			continue
+		}
+
+		var itemRecords []storage.GroupRecord
+
+		var itemCode Code = CodeMissArgs
+
+		var itemMsg string
+
+		if r.Valid() {
+			itemRecords, itemCode, itemMsg = s.prepareRecord(uid, r)
+		}
+
+		results[idx].Code = itemCode
+		results[idx].Message = CodeToMessage(itemCode, itemMsg)
+
+		if itemCode != CodeSuccess {
+			if code == CodeSuccess {
+				code = itemCode
+				msg = fmt.Sprintf("第%d条记录: %s", idx+1, CodeToMessage(itemCode, itemMsg))
+			}
+
+			continue
+		}
+
+		newResultIdxes = append(newResultIdxes, idx)
+
+		for _, record := range itemRecords {
+			// recorded by a failed attempt with the same key
+			if billID, recorded := result.GroupRecordIDs[record.GroupID]; recorded {
+				results[idx].RecordIDs = append(results[idx].RecordIDs, billID)
+
+				continue
+			}
+
+			recordOwners = append(recordOwners, idx)
+			records = append(records, record)
+		}
+	}
+
+	if code == CodeSuccess {
+		billIDs, err := s.storage.RecordBatch(records)
+		if err != nil {
+			s.logger.WithFields(l.ErrorField(err), l.UInt64Field("uid", uid)).Error("record batch failed")
+
+			code = CodeInternalError
+			msg = err.Error()
+		} else {
+			for idx, billID := range billIDs {
+				records[idx].Bill.ID = billID
+				s.statOnAddRecord(records[idx].GroupID, records[idx].Bill.LabelIDs, records[idx].Bill)
+
+				results[recordOwners[idx]].RecordIDs = append(results[recordOwners[idx]].RecordIDs, billID)
+			}
+
+			for _, idx := range newResultIdxes {
+				if reqs[idx].IdempotencyKey != "" {
+					s.saveIdempotencyResult(uid, reqs[idx].IdempotencyKey, idempotencyResult{
+						RecordIDs: results[idx].RecordIDs,
+						Code:      CodeSuccess,
+					})
+				}
+			}
+
+			return
+		}
+	}
+
+	for _, idx := range newResultIdxes {
+		results[idx].Code = CodeBatchAborted
+		results[idx].Message = CodeToMessage(CodeBatchAborted, "")
+	}
 
 	return
 }
@@ -464,27 +870,7 @@ func (s *Server) handleGetDeletedRecordsInner(c *gin.Context) (bills []DeletedBi
 
 	for _, bill := range deletedBills {
 		bills = append(bills, DeletedBill{
-			Bill: Bill{
-				ID:                bill.ID,
-				FromSubWalletID:   idN2S(bill.FromSubWalletID),
-				FromSubWalletName: s.helperGetWalletName(bill.FromSubWalletID),
-				ToSubWalletID:     idN2S(bill.ToSubWalletID),
-				ToSubWalletName:   s.helperGetWalletName(bill.ToSubWalletID),
-				CostDir:           bill.CostDir,
-				Amount:            bill.Amount,
-				LabelIDs:          idN2Ss(bill.LabelIDs),
-				LabelIDNames:      s.helperGetLabelNames(bill.LabelIDs, uid),
-				Remark:            bill.Remark,
-				LossAmount:        bill.LossAmount,
-				LossWalletID:      idN2S(bill.LossWalletID),
-				LossWalletName:    s.helperGetWalletName(bill.LossWalletID),
-				At:                bill.At,
-				AtS:               time.Unix(bill.At, 0).Format("01/02 15:04"),
-				FromPersonName:    s.helperGetWalletPersonName(bill.FromSubWalletID),
-				ToPersonName:      s.helperGetWalletPersonName(bill.ToSubWalletID),
-				OperationID:       idN2S(bill.OperationPersonID),
-				OperationName:     s.helperPersonName(bill.OperationPersonID),
-			},
+			Bill:      s.billDo2Po(uid, bill.GroupBill),
 			DeletedAt: bill.DeletedAt.Format("01/02 15:04"),
 		})
 	}
@@ -514,24 +900,7 @@ func (s *Server) handleRemoveDeleteRecordInner(c *gin.Context) (code Code, msg s
 		return
 	}
 
-	groupIDs, err := s.storage.GetPersonGroupsIDs(uid)
-	if err != nil {
-		code = CodeInternalError
-		msg = err.Error()
-
-		return
-	}
-
-	for _, groupID := range groupIDs {
-		err = s.storage.CleanDeletedBill(groupID, recordID)
-		if err != nil {
-			s.logger.WithFields(l.ErrorField(err)).Error("remove deleted record failed")
-
-			continue
-		}
-	}
-
-	code = CodeSuccess
+	_, code, msg = s.cleanDeletedRecords(uid, []string{recordID})
 
 	return
 }
@@ -558,6 +927,14 @@ func (s *Server) handleRestoreDeleteRecordInner(c *gin.Context) (code Code, msg
 		return
 	}
 
+	_, code, msg = s.restoreDeletedRecords(uid, []string{recordID})
+
+	return
+}
+
+// cleanDeletedRecords removes the records from the deleted history of all groups of uid,
+// count is the number of records removed from at least one group.
+func (s *Server) cleanDeletedRecords(uid uint64, recordIDs []string) (count int, code Code, msg string) {
 	groupIDs, err := s.storage.GetPersonGroupsIDs(uid)
 	if err != nil {
 		code = CodeInternalError
@@ -566,24 +943,75 @@ func (s *Server) handleRestoreDeleteRecordInner(c *gin.Context) (code Code, msg
 		return
 	}
 
-	for _, groupID := range groupIDs {
-		var bill model.DeletedGroupBill
+	for _, recordID := range recordIDs {
+		var cleaned bool
 
-		bill, err = s.storage.GetDeletedBill(groupID, recordID)
-		if err != nil {
-			s.logger.WithFields(l.ErrorField(err)).Error("get deleted record failed")
+		for _, groupID := range groupIDs {
+			err = s.storage.CleanDeletedBill(groupID, recordID)
+			if errors.Is(err, commerr.ErrNotFound) {
+				// the record is not in the trash of this group
+				continue
+			}
 
-			continue
+			if err != nil {
+				s.logger.WithFields(l.ErrorField(err), l.UInt64Field("groupID", groupID),
+					l.StringField("recordID", recordID)).Error("remove deleted record failed")
+
+				continue
+			}
+
+			cleaned = true
 		}
 
-		err = s.storage.RestoreDeletedBill(groupID, recordID)
-		if err != nil {
-			s.logger.WithFields(l.ErrorField(err)).Error("restore deleted record failed")
+		if cleaned {
+			count++
+		}
+	}
 
-			continue
+	code = CodeSuccess
+
+	return
+}
+
+// restoreDeletedRecords restores the records in all groups of uid,
+// count is the number of records restored in at least one group.
+func (s *Server) restoreDeletedRecords(uid uint64, recordIDs []string) (count int, code Code, msg string) {
+	groupIDs, err := s.storage.GetPersonGroupsIDs(uid)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	for _, recordID := range recordIDs {
+		var restored bool
+
+		for _, groupID := range groupIDs {
+			var bill model.DeletedGroupBill
+
+			bill, err = s.storage.GetDeletedBill(groupID, recordID)
+			if err != nil {
+				s.logger.WithFields(l.ErrorField(err)).Error("get deleted record failed")
+
+				continue
+			}
+
+			err = s.storage.RestoreDeletedBill(groupID, recordID)
+			if err != nil {
+				s.logger.WithFields(l.ErrorField(err)).Error("restore deleted record failed")
+
+				continue
+			}
+
+			s.statOnAddRecord(groupID, bill.LabelIDs, bill.GroupBill)
+
+			restored = true
 		}
 
-		s.statOnAddRecord(groupID, bill.LabelIDs, bill.GroupBill)
+		if restored {
+			count++
+		}
 	}
 
 	code = CodeSuccess
@@ -668,6 +1096,8 @@ func (s *Server) billDo2Po(uid uint64, bill model.GroupBill) Bill {
 		ToSubWalletName:   s.helperGetWalletName(bill.ToSubWalletID),
 		CostDir:           bill.CostDir,
 		Amount:            bill.Amount,
+		Currency:          model.CurrencyOrDefault(bill.Currency),
+		BaseAmount:        bill.StatAmount(),
 		LabelIDs:          idN2Ss(bill.LabelIDs),
 		LabelIDNames:      s.helperGetLabelNames(bill.LabelIDs, uid),
 		Remark:            bill.Remark,
@@ -680,5 +1110,30 @@ func (s *Server) billDo2Po(uid uint64, bill model.GroupBill) Bill {
 		ToPersonName:      s.helperGetWalletPersonName(bill.ToSubWalletID),
 		OperationID:       idN2S(bill.OperationPersonID),
 		OperationName:     s.helperPersonName(bill.OperationPersonID),
+		Attachments:       bill.Attachments,
+		Split:             s.billSplitDo2Po(bill.Split),
+		Settlement:        bill.Settlement,
+	}
+}
+
+func (s *Server) billSplitDo2Po(split *model.BillSplit) *BillSplit {
+	if split == nil {
+		return nil
+	}
+
+	voSplit := &BillSplit{
+		Mode:   split.Mode,
+		Shares: make([]BillSplitShare, 0, len(split.Shares)),
 	}
+
+	for _, share := range split.Shares {
+		voSplit.Shares = append(voSplit.Shares, BillSplitShare{
+			PersonID:   idN2S(share.PersonID),
+			PersonName: s.helperPersonName(share.PersonID),
+			Share:      share.Share,
+			Amount:     share.Amount,
+		})
+	}
+
+	return voSplit
 }
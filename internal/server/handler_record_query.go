@@ -0,0 +1,355 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"golang.org/x/exp/slices"
+)
+
+func (s *Server) handleQueryRecords(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	bills, hasMore, statistics, code, msg := s.handleQueryRecordsInner(c)
+	if code == CodeSuccess {
+		respWrapper.Resp = QueryRecordsResponse{
+			Bills:      bills,
+			HasMore:    hasMore,
+			Statistics: statistics,
+		}
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleQueryRecordsInner(c *gin.Context) (voBills []Bill, hasMore bool, statistics Statistics,
+	code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	var req QueryRecordsRequest
+
+	err := c.BindJSON(&req)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	if !req.Valid() {
+		code = CodeInvalidArgs
+
+		return
+	}
+
+	groupID, ok := s.getGroupID4Person(uid, req.GroupID)
+	if !ok {
+		code = CodeInvalidArgs
+		msg = "非法的组ID"
+
+		return
+	}
+
+	var matchedBills []model.GroupBill
+
+	if req.RecordID == "" {
+		matchedBills, statistics, err = s.queryRecords(groupID, req)
+	} else {
+		matchedBills, err = s.queryRecordsAfter(groupID, req)
+	}
+
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	if req.PageCount > 0 && len(matchedBills) > req.PageCount {
+		matchedBills = matchedBills[:req.PageCount]
+		hasMore = true
+	}
+
+	voBills = s.billsDo2Po(uid, matchedBills)
+
+	code = CodeSuccess
+
+	return
+}
+
+// compareQueryRecords orders the records by at and id, the newest first.
+func compareQueryRecords(a, b model.GroupBill) int {
+	if a.At != b.At {
+		if a.At > b.At {
+			return -1
+		}
+
+		return 1
+	}
+
+	return -strings.Compare(a.ID, b.ID)
+}
+
+// queryRecords returns all the matched bills of the first page and their statistics.
+func (s *Server) queryRecords(groupID uint64, req QueryRecordsRequest) (matchedBills []model.GroupBill,
+	statistics Statistics, err error) {
+	bills, err := s.getBillsBetween(groupID, req.StartAt, req.FinishAt)
+	if err != nil {
+		return
+	}
+
+	matchedBills = make([]model.GroupBill, 0, len(bills))
+
+	for _, bill := range bills {
+		if !req.Match(bill) {
+			continue
+		}
+
+		matchedBills = append(matchedBills, bill)
+
+		switch bill.CostDir {
+		case model.CostDirIn:
+			statistics.IncomingCount++
+			statistics.IncomingAmount += bill.StatAmount()
+		case model.CostDirOut:
+			statistics.OutgoingCount++
+			statistics.OutgoingAmount += bill.StatAmount()
+		case model.CostDirInGroup:
+			statistics.GroupTransCount++
+		}
+	}
+
+	slices.SortFunc(matchedBills, compareQueryRecords)
+
+	return
+}
+
+// queryRecordsAfter returns the matched bills after the cursor (RecordAt, RecordID), the cursor record may be
+// deleted. The day files are read backward a month at a time until the page is filled.
+func (s *Server) queryRecordsAfter(groupID uint64, req QueryRecordsRequest) (matchedBills []model.GroupBill,
+	err error) {
+	oldestBills, _, err := s.storage.GetBillsByID(groupID, "", 1, true)
+	if err != nil || len(oldestBills) == 0 {
+		return
+	}
+
+	lowerAt := oldestBills[0].At
+	if req.StartAt > lowerAt {
+		lowerAt = req.StartAt
+	}
+
+	finishAt := req.RecordAt
+	if req.FinishAt > 0 && req.FinishAt < finishAt {
+		finishAt = req.FinishAt
+	}
+
+	cursor := model.GroupBill{
+		ID: req.RecordID,
+		At: req.RecordAt,
+	}
+
+	for finishAt >= lowerAt && (req.PageCount == 0 || len(matchedBills) <= req.PageCount) {
+		startAt := time.Unix(finishAt, 0).AddDate(0, -1, 0).Unix() + 1
+		if startAt < lowerAt {
+			startAt = lowerAt
+		}
+
+		var bills []model.GroupBill
+
+		bills, err = s.getBillsBetween(groupID, startAt, finishAt)
+		if err != nil {
+			return
+		}
+
+		monthBills := make([]model.GroupBill, 0, len(bills))
+
+		for _, bill := range bills {
+			if compareQueryRecords(cursor, bill) < 0 && req.Match(bill) {
+				monthBills = append(monthBills, bill)
+			}
+		}
+
+		slices.SortFunc(monthBills, compareQueryRecords)
+
+		matchedBills = append(matchedBills, monthBills...)
+
+		finishAt = startAt - 1
+	}
+
+	return
+}
+
+// compareDeletedRecords orders the deleted records by deleted time and id, the same way for both of them.
+func compareDeletedRecords(a, b model.DeletedGroupBill, asc bool) (c int) {
+	switch {
+	case a.DeletedAt.Before(b.DeletedAt):
+		c = -1
+	case a.DeletedAt.After(b.DeletedAt):
+		c = 1
+	default:
+		c = strings.Compare(a.ID, b.ID)
+	}
+
+	if !asc {
+		c = -c
+	}
+
+	return
+}
+
+func (s *Server) handleQueryDeletedRecords(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	bills, hasMore, code, msg := s.handleQueryDeletedRecordsInner(c)
+	if code == CodeSuccess {
+		respWrapper.Resp = QueryDeletedRecordsResponse{
+			Bills:   bills,
+			HasMore: hasMore,
+		}
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleQueryDeletedRecordsInner(c *gin.Context) (voBills []DeletedBill, hasMore bool,
+	code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	var req QueryDeletedRecordsRequest
+
+	err := c.BindJSON(&req)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	if !req.Valid() {
+		code = CodeInvalidArgs
+
+		return
+	}
+
+	var groupIDs []uint64
+
+	if req.AllGroups {
+		groupIDs, err = s.storage.GetPersonGroupsIDs(uid)
+		if err != nil {
+			code = CodeInternalError
+			msg = err.Error()
+
+			return
+		}
+	} else {
+		groupID, ok := s.getGroupID4Person(uid, req.GroupID)
+		if !ok {
+			code = CodeInvalidArgs
+			msg = "非法的组ID"
+
+			return
+		}
+
+		groupIDs = []uint64{groupID}
+	}
+
+	type groupDeletedBill struct {
+		groupID uint64
+		bill    model.DeletedGroupBill
+	}
+
+	var matchedBills []groupDeletedBill
+
+	for _, groupID := range groupIDs {
+		deletedBills, e := s.storage.GetDeletedBills(groupID)
+		if e != nil {
+			code = CodeInternalError
+			msg = e.Error()
+
+			return
+		}
+
+		for _, bill := range deletedBills {
+			if req.Match(bill) {
+				matchedBills = append(matchedBills, groupDeletedBill{
+					groupID: groupID,
+					bill:    bill,
+				})
+			}
+		}
+	}
+
+	slices.SortFunc(matchedBills, func(a, b groupDeletedBill) int {
+		if c := compareDeletedRecords(a.bill, b.bill, req.Asc); c != 0 {
+			return c
+		}
+
+		if a.groupID < b.groupID {
+			return -1
+		}
+
+		if a.groupID > b.groupID {
+			return 1
+		}
+
+		return 0
+	})
+
+	if req.RecordID != "" {
+		idx := slices.IndexFunc(matchedBills, func(bill groupDeletedBill) bool {
+			return bill.bill.ID == req.RecordID
+		})
+		if idx < 0 {
+			code = CodeInvalidArgs
+			msg = "非法的记录ID"
+
+			return
+		}
+
+		matchedBills = matchedBills[idx+1:]
+	}
+
+	if req.PageCount > 0 && len(matchedBills) > req.PageCount {
+		matchedBills = matchedBills[:req.PageCount]
+		hasMore = true
+	}
+
+	groupNames := make(map[uint64]string)
+
+	voBills = make([]DeletedBill, 0, len(matchedBills))
+
+	for _, bill := range matchedBills {
+		groupName, ok := groupNames[bill.groupID]
+		if !ok {
+			if names, e := s.storage.GetGroupNames([]uint64{bill.groupID}); e == nil {
+				groupName = names[0]
+			}
+
+			groupNames[bill.groupID] = groupName
+		}
+
+		voBills = append(voBills, DeletedBill{
+			Bill:      s.billDo2Po(uid, bill.bill.GroupBill),
+			DeletedAt: bill.bill.DeletedAt.Format("01/02 15:04"),
+			GroupID:   idN2S(bill.groupID),
+			GroupName: groupName,
+		})
+	}
+
+	code = CodeSuccess
+
+	return
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/slices"
+)
+
+func TestQueryRecordsRequestValid(t *testing.T) {
+	req := QueryRecordsRequest{LabelIDs: []string{"zz"}}
+	assert.False(t, req.Valid())
+
+	req = QueryRecordsRequest{LabelIDs: []string{"0", "a"}}
+	assert.True(t, req.Valid())
+	assert.EqualValues(t, []uint64{0, 10}, req.DLabelIDs)
+
+	req = QueryRecordsRequest{RecordID: "20231110x"}
+	assert.False(t, req.Valid())
+}
+
+func TestQueryRecordsPaging(t *testing.T) {
+	s := utNewServer(t, "query")
+
+	personID, walletID, err := s.storage.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := s.storage.NewPerson("shop")
+	assert.Nil(t, err)
+
+	groupID, err := s.storage.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	// 3 bills a week over 3 months, two of them at the same time
+	var bills []model.GroupBill
+
+	for at := utAt(2023, 9, 1, 12); at < utAt(2023, 12, 1, 0); at += int64(7 * 24 * time.Hour / time.Second) {
+		for _, offset := range []int64{0, 0, 3600} {
+			bills = append(bills, utRecord(t, s, groupID, model.GroupBill{
+				FromSubWalletID: walletID,
+				ToSubWalletID:   shopWalletID,
+				CostDir:         model.CostDirOut,
+				Amount:          1,
+				At:              at + offset,
+			}))
+		}
+	}
+
+	req := QueryRecordsRequest{PageCount: 4}
+	assert.True(t, req.Valid())
+
+	allBills, statistics, err := s.queryRecords(groupID, req)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(bills), len(allBills))
+	assert.EqualValues(t, len(bills), statistics.OutgoingCount)
+
+	var pagedIDs []string
+
+	for page := allBills[:req.PageCount]; len(page) > 0; {
+		for _, bill := range page {
+			pagedIDs = append(pagedIDs, bill.ID)
+		}
+
+		cursor := page[len(page)-1]
+
+		// the cursor record is deleted before the next page
+		assert.Nil(t, s.storage.DeleteRecord(groupID, cursor.ID, 0))
+
+		req.RecordID, req.RecordAt = cursor.ID, cursor.At
+
+		page, err = s.queryRecordsAfter(groupID, req)
+		assert.Nil(t, err)
+
+		if len(page) > req.PageCount {
+			page = page[:req.PageCount]
+		}
+	}
+
+	expectedIDs := make([]string, 0, len(allBills))
+	for _, bill := range allBills {
+		expectedIDs = append(expectedIDs, bill.ID)
+	}
+
+	assert.EqualValues(t, expectedIDs, pagedIDs)
+}
+
+func TestQueryRecordsStatisticsBaseAmount(t *testing.T) {
+	s := utNewServer(t, "query-base-amount")
+
+	personID, walletID, err := s.storage.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := s.storage.NewPerson("shop")
+	assert.Nil(t, err)
+
+	groupID, err := s.storage.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	utRecord(t, s, groupID, model.GroupBill{
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          100,
+		Currency:        "USD",
+		BaseAmount:      720,
+		At:              utAt(2023, 11, 10, 12),
+	})
+
+	utRecord(t, s, groupID, model.GroupBill{
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          30,
+		At:              utAt(2023, 11, 11, 12),
+	})
+
+	_, statistics, err := s.queryRecords(groupID, QueryRecordsRequest{})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, statistics.OutgoingCount)
+	assert.EqualValues(t, 750, statistics.OutgoingAmount)
+}
+
+func TestQueryDeletedRecordsRequestMatch(t *testing.T) {
+	req := QueryDeletedRecordsRequest{OperationID: idN2S(2)}
+	assert.True(t, req.Valid())
+
+	bill := model.DeletedGroupBill{
+		GroupBill: model.GroupBill{OperationPersonID: 1},
+		DeletedBy: 2,
+	}
+	assert.True(t, req.Match(bill))
+
+	bill.DeletedBy = 1
+	assert.False(t, req.Match(bill))
+}
+
+func TestCompareDeletedRecords(t *testing.T) {
+	at := time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local)
+
+	bills := []model.DeletedGroupBill{
+		{GroupBill: model.GroupBill{ID: "b"}, DeletedAt: at},
+		{GroupBill: model.GroupBill{ID: "c"}, DeletedAt: at.Add(-time.Second)},
+		{GroupBill: model.GroupBill{ID: "a"}, DeletedAt: at},
+		{GroupBill: model.GroupBill{ID: "d"}, DeletedAt: at},
+	}
+
+	fnIDs := func(asc bool) (ids []string) {
+		sorted := slices.Clone(bills)
+		slices.SortFunc(sorted, func(a, b model.DeletedGroupBill) int {
+			return compareDeletedRecords(a, b, asc)
+		})
+
+		for _, bill := range sorted {
+			ids = append(ids, bill.ID)
+		}
+
+		return
+	}
+
+	assert.EqualValues(t, []string{"c", "a", "b", "d"}, fnIDs(true))
+	assert.EqualValues(t, []string{"d", "b", "a", "c"}, fnIDs(false))
+}
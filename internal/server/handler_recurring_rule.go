@@ -0,0 +1,254 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/i/commerr"
+)
+
+func (s *Server) recurringRuleDo2Po(uid uint64, rule model.RecurringRule) RecurringRule {
+	r := RecurringRule{
+		ID:                idN2S(rule.ID),
+		Name:              rule.Name,
+		FromSubWalletID:   idN2S(rule.FromSubWalletID),
+		FromSubWalletName: s.helperGetWalletName(rule.FromSubWalletID),
+		ToSubWalletID:     idN2S(rule.ToSubWalletID),
+		ToSubWalletName:   s.helperGetWalletName(rule.ToSubWalletID),
+		Amount:            rule.Amount,
+		Currency:          model.CurrencyOrDefault(rule.Currency),
+		LabelIDs:          idN2Ss(rule.LabelIDs),
+		LabelIDNames:      s.helperGetLabelNames(rule.LabelIDs, uid),
+		Remark:            rule.Remark,
+		LossAmount:        rule.LossAmount,
+		LossWalletID:      idN2S(rule.LossWalletID),
+		Schedule:          rule.Schedule,
+		Month:             rule.Month,
+		Day:               rule.Day,
+		Hour:              rule.Hour,
+		Minute:            rule.Minute,
+		Paused:            rule.Paused,
+		StartAt:           rule.StartAt,
+		LastRunAt:         rule.LastRunAt,
+	}
+
+	after := time.Unix(rule.LastRunAt, 0)
+	if rule.LastRunAt < rule.StartAt {
+		after = time.Unix(rule.StartAt-1, 0)
+	}
+
+	if nextAt := rule.NextAt(after); !nextAt.IsZero() {
+		r.NextAt = nextAt.Unix()
+		r.NextAtS = nextAt.Format("2006/01/02 15:04")
+	}
+
+	return r
+}
+
+func (s *Server) getRecurringRule4Person(uid uint64, ruleIDS string) (rule model.RecurringRule, code Code, msg string) {
+	ruleID, err := idS2N(ruleIDS)
+	if err != nil {
+		code = CodeInvalidArgs
+		msg = "非法的规则ID"
+
+		return
+	}
+
+	rule, err = s.storage.GetRecurringRule(ruleID)
+	if err != nil || rule.PersonID != uid {
+		code = CodeInvalidArgs
+		msg = "规则不存在"
+
+		return
+	}
+
+	code = CodeSuccess
+
+	return
+}
+
+func (s *Server) handleGetRecurringRules(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	rules, code, msg := s.handleGetRecurringRulesInner(c)
+	if code == CodeSuccess {
+		respWrapper.Resp = GetRecurringRulesResponse{
+			Rules: rules,
+		}
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleGetRecurringRulesInner(c *gin.Context) (rules []RecurringRule, code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	dbRules, err := s.storage.GetRecurringRules(uid)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	rules = make([]RecurringRule, 0, len(dbRules))
+
+	for _, rule := range dbRules {
+		rules = append(rules, s.recurringRuleDo2Po(uid, rule))
+	}
+
+	return
+}
+
+func (s *Server) handleRecurringRuleNew(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	ruleID, code, msg := s.handleRecurringRuleNewInner(c)
+	if code == CodeSuccess {
+		respWrapper.Resp = RecurringRuleNewResponse{
+			ID: idN2S(ruleID),
+		}
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleRecurringRuleNewInner(c *gin.Context) (ruleID uint64, code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	var req RecurringRuleNewRequest
+
+	err := c.BindJSON(&req)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	if !req.Valid() {
+		code = CodeMissArgs
+
+		return
+	}
+
+	_, code, msg = s.checkRecordWallets(uid, req.Record)
+	if code != CodeSuccess {
+		return
+	}
+
+	ruleID, err = s.storage.NewRecurringRule(model.RecurringRule{
+		PersonID:        uid,
+		Name:            req.Name,
+		FromSubWalletID: req.Record.DFromSubWalletID,
+		ToSubWalletID:   req.Record.DToSubWalletID,
+		Amount:          req.Record.Amount,
+		Currency:        req.Record.Currency,
+		LabelIDs:        req.Record.DLabelIDs,
+		Remark:          req.Record.Remark,
+		LossAmount:      req.Record.LossAmount,
+		LossWalletID:    req.Record.DLossWalletID,
+		Schedule:        req.Schedule,
+		Month:           req.Month,
+		Day:             req.Day,
+		Hour:            req.Hour,
+		Minute:          req.Minute,
+		StartAt:         req.StartAt,
+	})
+	if err != nil {
+		if errors.Is(err, commerr.ErrInvalidArgument) {
+			code = CodeInvalidArgs
+		} else {
+			code = CodeInternalError
+		}
+
+		msg = err.Error()
+
+		return
+	}
+
+	code = CodeSuccess
+
+	return
+}
+
+func (s *Server) handleRecurringRulePause(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	respWrapper.Apply(s.handleRecurringRulePauseInner(c, true))
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleRecurringRuleResume(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	respWrapper.Apply(s.handleRecurringRulePauseInner(c, false))
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleRecurringRulePauseInner(c *gin.Context, paused bool) (code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	rule, code, msg := s.getRecurringRule4Person(uid, c.Param("id"))
+	if code != CodeSuccess {
+		return
+	}
+
+	err := s.storage.PauseRecurringRule(rule.ID, paused)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	return
+}
+
+func (s *Server) handleRecurringRuleDelete(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	respWrapper.Apply(s.handleRecurringRuleDeleteInner(c))
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleRecurringRuleDeleteInner(c *gin.Context) (code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	rule, code, msg := s.getRecurringRule4Person(uid, c.Param("id"))
+	if code != CodeSuccess {
+		return
+	}
+
+	err := s.storage.DeleteRecurringRule(rule.ID)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	return
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/i/l"
+	"golang.org/x/exp/slices"
+)
+
+func (s *Server) handleSettlement(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	resp, code, msg := s.handleSettlementInner(c)
+	if code == CodeSuccess {
+		respWrapper.Resp = resp
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleSettlementInner(c *gin.Context) (resp SettlementResponse, code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	var req SettlementRequest
+
+	err := c.BindJSON(&req)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	groupID, ok := s.getGroupID4Person(uid, req.GroupID)
+	if !ok {
+		code = CodeInvalidArgs
+		msg = "非法的组ID"
+
+		return
+	}
+
+	resp.Currency, err = s.storage.GetGroupBaseCurrency(groupID)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	bills, err := s.storage.GetBills(groupID)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	walletPersonIDs := make(map[uint64]uint64)
+
+	balances := settlementBalances(bills, func(walletID uint64) (uint64, bool) {
+		if personID, exists := walletPersonIDs[walletID]; exists {
+			return personID, personID != 0
+		}
+
+		wallet, e := s.storage.GetWallet(walletID)
+		if e != nil {
+			walletPersonIDs[walletID] = 0
+
+			return 0, false
+		}
+
+		walletPersonIDs[walletID] = wallet.PersonID
+
+		return wallet.PersonID, true
+	})
+
+	personIDs := make([]uint64, 0, len(balances))
+	for personID := range balances {
+		personIDs = append(personIDs, personID)
+	}
+
+	slices.Sort(personIDs)
+
+	resp.Balances = make([]SettlementBalance, 0, len(personIDs))
+
+	for _, personID := range personIDs {
+		resp.Balances = append(resp.Balances, SettlementBalance{
+			PersonID:   idN2S(personID),
+			PersonName: s.helperPersonName(personID),
+			Balance:    balances[personID],
+		})
+	}
+
+	transfers := settlementTransfers(balances)
+
+	resp.Transfers = make([]SettlementTransfer, 0, len(transfers))
+
+	for _, transfer := range transfers {
+		resp.Transfers = append(resp.Transfers, SettlementTransfer{
+			FromPersonID:   idN2S(transfer.fromPersonID),
+			FromPersonName: s.helperPersonName(transfer.fromPersonID),
+			ToPersonID:     idN2S(transfer.toPersonID),
+			ToPersonName:   s.helperPersonName(transfer.toPersonID),
+			Amount:         transfer.amount,
+		})
+	}
+
+	code = CodeSuccess
+
+	return
+}
+
+func (s *Server) handleSettlementRecord(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	respWrapper.Apply(s.handleSettlementRecordInner(c))
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleSettlementRecordInner(c *gin.Context) (code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	var req SettlementRecordRequest
+
+	err := c.BindJSON(&req)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	if !req.Valid() {
+		code = CodeInvalidArgs
+
+		return
+	}
+
+	groupID, ok := s.getGroupID4Person(uid, req.GroupID)
+	if !ok {
+		code = CodeInvalidArgs
+		msg = "非法的组ID"
+
+		return
+	}
+
+	fromWallet, err := s.storage.GetWallet(req.DFromSubWalletID)
+	if err != nil {
+		code = CodeInvalidArgs
+		msg = "非法的付款钱包"
+
+		return
+	}
+
+	toWallet, err := s.storage.GetWallet(req.DToSubWalletID)
+	if err != nil {
+		code = CodeInvalidArgs
+		msg = "非法的收款钱包"
+
+		return
+	}
+
+	if fromWallet.PersonID != uid && toWallet.PersonID != uid {
+		code = CodeDisabled
+		msg = "无权限"
+
+		return
+	}
+
+	if fromWallet.PersonID == toWallet.PersonID {
+		code = CodeInvalidArgs
+		msg = "付款人与收款人相同"
+
+		return
+	}
+
+	memberIDs, _, err := s.storage.GetGroupPersonIDs(groupID)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	if !slices.Contains(memberIDs, fromWallet.PersonID) || !slices.Contains(memberIDs, toWallet.PersonID) {
+		code = CodeInvalidArgs
+		msg = "付款人或收款人不在组内"
+
+		return
+	}
+
+	groupBill := model.GroupBill{
+		FromSubWalletID:   req.DFromSubWalletID,
+		ToSubWalletID:     req.DToSubWalletID,
+		CostDir:           model.CostDirInGroup,
+		Amount:            req.Amount,
+		Currency:          model.CurrencyOrDefault(fromWallet.Currency),
+		Remark:            req.Remark,
+		At:                req.At,
+		OperationPersonID: uid,
+		Settlement:        true,
+	}
+
+	s.fillBillBaseAmount(groupID, &groupBill)
+
+	groupBill.ID, err = s.storage.Record(groupID, groupBill)
+	if err != nil {
+		s.logger.WithFields(l.ErrorField(err), l.UInt64Field("groupID", groupID)).Error("record settlement failed")
+
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	s.statOnAddRecord(groupID, nil, groupBill)
+
+	code = CodeSuccess
+
+	return
+}
@@ -22,6 +22,10 @@ func (s *Server) statOnAddRecord(groupID uint64, labelIDs []uint64, groupBill mo
 	}
 
 	s.stat.SetDayData(billStatKey(groupID, groupID), time.Unix(groupBill.At, 0), curD)
+
+	for _, key := range s.billDimensionStatKeys(groupID, groupBill) {
+		s.stat.SetDayData(key, time.Unix(groupBill.At, 0), curD)
+	}
 }
 
 func (s *Server) statOnRemoveRecord(groupID uint64, groupBill model.GroupBill) {
@@ -39,6 +43,23 @@ func (s *Server) statOnRemoveRecord(groupID uint64, groupBill model.GroupBill) {
 	}
 
 	s.stat.SetDayData(billStatKey(groupID, groupID), time.Unix(groupBill.At, 0), curD)
+
+	for _, key := range s.billDimensionStatKeys(groupID, groupBill) {
+		s.stat.SetDayData(key, time.Unix(groupBill.At, 0), curD)
+	}
+}
+
+// billDimensionStatKeys returns the wallet and person keys of the bill.
+func (s *Server) billDimensionStatKeys(groupID uint64, groupBill model.GroupBill) []string {
+	return append(billWalletStatKeys(groupID, groupBill), billPersonStatKeys(groupID, groupBill,
+		func(walletID uint64) uint64 {
+			wallet, err := s.storage.GetWallet(walletID)
+			if err != nil {
+				return 0
+			}
+
+			return wallet.PersonID
+		})...)
 }
 
 func (s *Server) getStats(groupID uint64, labelIDs []uint64) (
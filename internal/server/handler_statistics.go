@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/s-min-sys/lifecostbe/internal/model"
 	"github.com/sgostarter/libcomponents/statistic/memdate"
 	"github.com/sgostarter/libcomponents/statistic/memdate/ex"
 	"golang.org/x/exp/slices"
@@ -189,7 +190,12 @@ func (s *Server) handleStatisticsAllInner(c *gin.Context) (years []StatYear, cod
 		return
 	}
 
-	daM, err := s.stat.Export(billStatKey(groupID, groupID))
+	key, code, msg := s.statKey4Request(c, groupID)
+	if code != CodeSuccess {
+		return
+	}
+
+	daM, err := s.stat.Export(key)
 	if err != nil {
 		code = CodeInternalError
 		msg = err.Error()
@@ -240,47 +246,203 @@ func (s *Server) handleStatisticsNowInner(c *gin.Context) (dayStatistics, weekSt
 
 	groupID := groupIDs[0]
 
-	dayStatistics, weekStatistics, monthStatistics, seasonStatistics, yearStatistics = s.doStatistics(groupID, groupID)
+	key, code, msg := s.statKey4Request(c, groupID)
+	if code != CodeSuccess {
+		return
+	}
+
+	dayStatistics, weekStatistics, monthStatistics, seasonStatistics, yearStatistics = s.doStatisticsByKey(key, time.Now())
+
+	return
+}
+
+// statKey4Request returns the statistics key of the group, or of its wallet in the walletID query.
+func (s *Server) statKey4Request(c *gin.Context, groupID uint64) (key string, code Code, msg string) {
+	walletIDS := c.Query("walletID")
+	if walletIDS == "" {
+		key = billStatKey(groupID, groupID)
+		code = CodeSuccess
+
+		return
+	}
+
+	walletID, err := idS2N(walletIDS)
+	if err != nil || walletID == 0 {
+		code = CodeInvalidArgs
+		msg = "invalid walletID"
+
+		return
+	}
+
+	if _, err = s.storage.GetWallet(walletID); err != nil {
+		code = CodeInvalidArgs
+		msg = err.Error()
+
+		return
+	}
+
+	key = billWalletStatKey(groupID, walletID)
+	code = CodeSuccess
 
 	return
 }
 
 func (s *Server) doStatistics(groupID uint64, labelID uint64) (dayStatistics, weekStatistics, monthStatistics, seasonStatistics, yearStatistics Statistics) {
-	timeNow := time.Now()
-
-	fnTotalD2Statistic := func(totalD ex.LifeCostTotalData) Statistics {
-		return Statistics{
-			IncomingCount:  totalD.EarnCount,
-			OutgoingCount:  totalD.ConsumeCount,
-			IncomingAmount: totalD.EarnAmount,
-			OutgoingAmount: totalD.ConsumeAmount,
-		}
+	return s.doStatisticsByKey(billStatKey(groupID, labelID), time.Now())
+}
+
+func totalD2Statistics(totalD ex.LifeCostTotalData) Statistics {
+	return Statistics{
+		IncomingCount:  totalD.EarnCount,
+		OutgoingCount:  totalD.ConsumeCount,
+		IncomingAmount: totalD.EarnAmount,
+		OutgoingAmount: totalD.ConsumeAmount,
 	}
+}
 
-	totalD, exists := s.stat.GetYearOn(billStatKey(groupID, labelID), timeNow)
+// doStatisticsByKey returns the statistics of the day, week, month, season and year containing timeNow.
+func (s *Server) doStatisticsByKey(key string, timeNow time.Time) (dayStatistics, weekStatistics, monthStatistics,
+	seasonStatistics, yearStatistics Statistics) {
+	totalD, exists := s.stat.GetYearOn(key, timeNow)
 	if exists {
-		yearStatistics = fnTotalD2Statistic(totalD)
+		yearStatistics = totalD2Statistics(totalD)
 	}
 
-	totalD, exists = s.stat.GetSeasonOn(billStatKey(groupID, labelID), timeNow)
+	totalD, exists = s.stat.GetSeasonOn(key, timeNow)
 	if exists {
-		seasonStatistics = fnTotalD2Statistic(totalD)
+		seasonStatistics = totalD2Statistics(totalD)
 	}
 
-	totalD, exists = s.stat.GetMonthOn(billStatKey(groupID, labelID), timeNow)
+	totalD, exists = s.stat.GetMonthOn(key, timeNow)
 	if exists {
-		monthStatistics = fnTotalD2Statistic(totalD)
+		monthStatistics = totalD2Statistics(totalD)
 	}
 
-	totalD, exists = s.stat.GetWeekOn(billStatKey(groupID, labelID), timeNow)
+	totalD, exists = s.stat.GetWeekOn(key, timeNow)
 	if exists {
-		weekStatistics = fnTotalD2Statistic(totalD)
+		weekStatistics = totalD2Statistics(totalD)
 	}
 
-	totalD, exists = s.stat.GetDayOn(billStatKey(groupID, labelID), timeNow)
+	totalD, exists = s.stat.GetDayOn(key, timeNow)
 	if exists {
-		dayStatistics = fnTotalD2Statistic(totalD)
+		dayStatistics = totalD2Statistics(totalD)
+	}
+
+	return
+}
+
+func (s *Server) handleStatisticsMembers(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	resp, code, msg := s.handleStatisticsMembersInner(c)
+	if code == CodeSuccess {
+		respWrapper.Resp = resp
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleStatisticsMembersInner(c *gin.Context) (resp MemberStatisticsResponse, code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	var req MemberStatisticsRequest
+
+	err := c.BindJSON(&req)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	if !req.Valid() {
+		code = CodeInvalidArgs
+
+		return
+	}
+
+	groupID, ok := s.getGroupID4Person(uid, req.GroupID)
+	if !ok {
+		code = CodeInvalidArgs
+		msg = "非法的组ID"
+
+		return
+	}
+
+	personIDs, _, err := s.storage.GetGroupPersonIDs(groupID)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	resp.At = req.At
+	resp.Members = make([]MemberStatistics, 0, len(personIDs))
+
+	at := time.Unix(req.At, 0)
+
+	for _, personID := range personIDs {
+		resp.Members = append(resp.Members, MemberStatistics{
+			PersonID:   idN2S(personID),
+			PersonName: s.helperPersonName(personID),
+			Member:     s.statisticsResponseByKey(billMemberStatKey(groupID, personID), at),
+			Operator:   s.statisticsResponseByKey(billOperatorStatKey(groupID, personID), at),
+		})
+	}
+
+	if req.StartAt == 0 {
+		return
 	}
 
+	resp.StartAt = req.StartAt
+	resp.FinishAt = req.FinishAt
+
+	err = s.memberRangeStatistics(groupID, personIDs, req.StartAt, req.FinishAt, resp.Members)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	return
+}
+
+// memberRangeStatistics fills the range statistics of the members, in the order of personIDs.
+func (s *Server) memberRangeStatistics(groupID uint64, personIDs []uint64, startAt, finishAt int64,
+	members []MemberStatistics) error {
+	keys := make([]string, 0, len(personIDs)*2)
+	for _, personID := range personIDs {
+		keys = append(keys, billMemberStatKey(groupID, personID), billOperatorStatKey(groupID, personID))
+	}
+
+	totals, err := s.rangeTotals(groupID, keys, startAt, finishAt, func(bill model.GroupBill) []string {
+		return s.billDimensionStatKeys(groupID, bill)
+	})
+	if err != nil {
+		return err
+	}
+
+	for idx, personID := range personIDs {
+		memberStatistics := totalD2Statistics(totals[billMemberStatKey(groupID, personID)])
+		operatorStatistics := totalD2Statistics(totals[billOperatorStatKey(groupID, personID)])
+
+		members[idx].MemberRange = &memberStatistics
+		members[idx].OperatorRange = &operatorStatistics
+	}
+
+	return nil
+}
+
+func (s *Server) statisticsResponseByKey(key string, at time.Time) (resp StatisticsResponse) {
+	resp.DayStatistics, resp.WeekStatistics, resp.MonthStatistics, resp.SeasonStatistics,
+		resp.YearStatistics = s.doStatisticsByKey(key, at)
+
 	return
 }
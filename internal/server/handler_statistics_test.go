@@ -0,0 +1,328 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/libcomponents/statistic/memdate/ex"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalletStatistics(t *testing.T) {
+	s := utNewServer(t, "wallet-statistics")
+
+	zjzID, zjzWalletID, err := s.storage.NewPersonEx("zjz", 1001)
+	assert.Nil(t, err)
+
+	zymID, zymWalletID, err := s.storage.NewPersonEx("zym", 1002)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := s.storage.NewPerson("shop")
+	assert.Nil(t, err)
+
+	groupID, err := s.storage.NewGroup("home", zjzID)
+	assert.Nil(t, err)
+	assert.Nil(t, s.storage.JoinGroup(groupID, zymID))
+
+	at := utAt(2024, 3, 10, 12)
+
+	fnRecord := func(from, to uint64, costDir model.CostDir, amount int) model.GroupBill {
+		return utRecord(t, s, groupID, model.GroupBill{
+			FromSubWalletID: from,
+			ToSubWalletID:   to,
+			CostDir:         costDir,
+			Amount:          amount,
+			At:              at,
+		})
+	}
+
+	zjzToShop := fnRecord(zjzWalletID, shopWalletID, model.CostDirOut, 100)
+	fnRecord(zymWalletID, shopWalletID, model.CostDirOut, 40)
+	fnRecord(shopWalletID, zjzWalletID, model.CostDirIn, 30)
+	fnRecord(zjzWalletID, zymWalletID, model.CostDirInGroup, 20)
+	fnRecord(zjzWalletID, zjzWalletID, model.CostDirOut, 10)
+
+	fnTotalD := func(consumeCount, consumeAmount, earnCount, earnAmount int) ex.LifeCostTotalData {
+		return ex.LifeCostTotalData{
+			ConsumeCount:  consumeCount,
+			ConsumeAmount: consumeAmount,
+			EarnCount:     earnCount,
+			EarnAmount:    earnAmount,
+		}
+	}
+
+	cases := []struct {
+		name   string
+		query  string
+		code   Code
+		totalD ex.LifeCostTotalData
+		// after the bill from zjz to shop is removed
+		removedTotalD ex.LifeCostTotalData
+	}{
+		{
+			name:          "group",
+			query:         "",
+			code:          CodeSuccess,
+			totalD:        fnTotalD(3, 150, 1, 30),
+			removedTotalD: fnTotalD(2, 50, 1, 30),
+		},
+		{
+			name:          "from and to wallet, the same wallet counts once",
+			query:         idN2S(zjzWalletID),
+			code:          CodeSuccess,
+			totalD:        fnTotalD(2, 110, 1, 30),
+			removedTotalD: fnTotalD(1, 10, 1, 30),
+		},
+		{
+			name:          "in group bills are not accumulated",
+			query:         idN2S(zymWalletID),
+			code:          CodeSuccess,
+			totalD:        fnTotalD(1, 40, 0, 0),
+			removedTotalD: fnTotalD(1, 40, 0, 0),
+		},
+		{
+			name:          "the other party wallet",
+			query:         idN2S(shopWalletID),
+			code:          CodeSuccess,
+			totalD:        fnTotalD(2, 140, 1, 30),
+			removedTotalD: fnTotalD(1, 40, 1, 30),
+		},
+		{
+			name:  "bad wallet ID",
+			query: "abc",
+			code:  CodeInvalidArgs,
+		},
+		{
+			name:  "zero wallet ID",
+			query: "0",
+			code:  CodeInvalidArgs,
+		},
+		{
+			name:  "unknown wallet",
+			query: idN2S(zjzWalletID + zymWalletID + shopWalletID),
+			code:  CodeInvalidArgs,
+		},
+	}
+
+	fnCheck := func(t *testing.T, query string, code Code, totalD ex.LifeCostTotalData) {
+		target := "/statistics"
+		if query != "" {
+			target += "?walletID=" + query
+		}
+
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+
+		key, rCode, _ := s.statKey4Request(c, groupID)
+		assert.EqualValues(t, code, rCode)
+
+		if code != CodeSuccess {
+			return
+		}
+
+		dayD, _ := s.stat.GetDayOn(key, time.Unix(at, 0))
+		assert.EqualValues(t, totalD, dayD)
+
+		yearD, _ := s.stat.GetYearOn(key, time.Unix(at, 0))
+		assert.EqualValues(t, totalD, yearD)
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fnCheck(t, c.query, c.code, c.totalD)
+		})
+	}
+
+	s.statOnRemoveRecord(groupID, zjzToShop)
+
+	for _, c := range cases {
+		t.Run(c.name+" after remove", func(t *testing.T) {
+			fnCheck(t, c.query, c.code, c.removedTotalD)
+		})
+	}
+}
+
+func TestBillPersonStatKeys(t *testing.T) {
+	// wallet ID = person ID * 10, wallet 990 belongs to nobody
+	fnWalletPersonID := func(walletID uint64) uint64 {
+		if walletID == 990 {
+			return 0
+		}
+
+		return walletID / 10
+	}
+
+	cases := []struct {
+		name string
+		bill model.GroupBill
+		keys []string
+	}{
+		{
+			name: "outgoing bill is paid by the from wallet",
+			bill: model.GroupBill{FromSubWalletID: 10, ToSubWalletID: 990, CostDir: model.CostDirOut, OperationPersonID: 2},
+			keys: []string{"7-o2", "7-m1"},
+		},
+		{
+			name: "incoming bill is received by the to wallet",
+			bill: model.GroupBill{FromSubWalletID: 990, ToSubWalletID: 20, CostDir: model.CostDirIn, OperationPersonID: 2},
+			keys: []string{"7-o2", "7-m2"},
+		},
+		{
+			name: "no operation person",
+			bill: model.GroupBill{FromSubWalletID: 10, ToSubWalletID: 990, CostDir: model.CostDirOut},
+			keys: []string{"7-m1"},
+		},
+		{
+			name: "wallet of nobody",
+			bill: model.GroupBill{FromSubWalletID: 990, ToSubWalletID: 10, CostDir: model.CostDirOut, OperationPersonID: 1},
+			keys: []string{"7-o1"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.EqualValues(t, c.keys, billPersonStatKeys(7, c.bill, fnWalletPersonID))
+		})
+	}
+}
+
+func TestMemberStatistics(t *testing.T) {
+	s := utNewServer(t, "member-statistics")
+
+	zjzID, zjzWalletID, err := s.storage.NewPersonEx("zjz", 1001)
+	assert.Nil(t, err)
+
+	zymID, zymWalletID, err := s.storage.NewPersonEx("zym", 1002)
+	assert.Nil(t, err)
+
+	shopID, shopWalletID, err := s.storage.NewPerson("shop")
+	assert.Nil(t, err)
+
+	groupID, err := s.storage.NewGroup("home", zjzID)
+	assert.Nil(t, err)
+	assert.Nil(t, s.storage.JoinGroup(groupID, zymID))
+
+	at := utAt(2024, 3, 10, 12)
+
+	fnRecord := func(from, to uint64, costDir model.CostDir, amount int, operationPersonID uint64) {
+		utRecord(t, s, groupID, model.GroupBill{
+			FromSubWalletID:   from,
+			ToSubWalletID:     to,
+			CostDir:           costDir,
+			Amount:            amount,
+			At:                at,
+			OperationPersonID: operationPersonID,
+		})
+	}
+
+	// zym records the bill zjz paid
+	fnRecord(zjzWalletID, shopWalletID, model.CostDirOut, 100, zymID)
+	fnRecord(zymWalletID, shopWalletID, model.CostDirOut, 40, zymID)
+	fnRecord(shopWalletID, zjzWalletID, model.CostDirIn, 30, zjzID)
+	fnRecord(zjzWalletID, zymWalletID, model.CostDirInGroup, 20, zjzID)
+
+	cases := []struct {
+		name     string
+		key      string
+		expected Statistics
+	}{
+		{"zjz paid and received", billMemberStatKey(groupID, zjzID),
+			Statistics{OutgoingCount: 1, OutgoingAmount: 100, IncomingCount: 1, IncomingAmount: 30}},
+		{"zym paid", billMemberStatKey(groupID, zymID),
+			Statistics{OutgoingCount: 1, OutgoingAmount: 40}},
+		{"zjz recorded", billOperatorStatKey(groupID, zjzID),
+			Statistics{IncomingCount: 1, IncomingAmount: 30}},
+		{"zym recorded", billOperatorStatKey(groupID, zymID),
+			Statistics{OutgoingCount: 2, OutgoingAmount: 140}},
+		{"the other party is no member", billMemberStatKey(groupID, shopID), Statistics{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp := s.statisticsResponseByKey(c.key, time.Unix(at, 0))
+			assert.EqualValues(t, c.expected, resp.DayStatistics)
+			assert.EqualValues(t, c.expected, resp.MonthStatistics)
+		})
+	}
+}
+
+func TestMemberRangeStatistics(t *testing.T) {
+	s := utNewServer(t, "member-range-statistics")
+
+	zjzID, zjzWalletID, err := s.storage.NewPersonEx("zjz", 1001)
+	assert.Nil(t, err)
+
+	zymID, zymWalletID, err := s.storage.NewPersonEx("zym", 1002)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := s.storage.NewPerson("shop")
+	assert.Nil(t, err)
+
+	groupID, err := s.storage.NewGroup("home", zjzID)
+	assert.Nil(t, err)
+	assert.Nil(t, s.storage.JoinGroup(groupID, zymID))
+
+	startAt := utAt(2024, 3, 10, 12)
+	finishAt := utAt(2024, 3, 12, 12)
+
+	fnRecord := func(from uint64, amount int, at int64, operationPersonID uint64) {
+		utRecord(t, s, groupID, model.GroupBill{
+			FromSubWalletID:   from,
+			ToSubWalletID:     shopWalletID,
+			CostDir:           model.CostDirOut,
+			Amount:            amount,
+			At:                at,
+			OperationPersonID: operationPersonID,
+		})
+	}
+
+	// the amounts are powers of 2, so each sum tells the bills in it; the 11th is a whole day, the others partial
+	fnRecord(zjzWalletID, 1, startAt-1, zjzID)
+	fnRecord(zymWalletID, 2, startAt, zjzID)
+	fnRecord(zjzWalletID, 4, utAt(2024, 3, 11, 8), zymID)
+	fnRecord(zymWalletID, 8, utAt(2024, 3, 11, 20), zymID)
+	fnRecord(zjzWalletID, 16, finishAt, zjzID)
+	fnRecord(zjzWalletID, 32, finishAt+1, zymID)
+
+	personIDs := []uint64{zjzID, zymID}
+	members := make([]MemberStatistics, len(personIDs))
+
+	assert.Nil(t, s.memberRangeStatistics(groupID, personIDs, startAt, finishAt, members))
+
+	cases := []struct {
+		name     string
+		actual   *Statistics
+		expected Statistics
+	}{
+		{"zjz paid", members[0].MemberRange, Statistics{OutgoingCount: 2, OutgoingAmount: 4 + 16}},
+		{"zym paid", members[1].MemberRange, Statistics{OutgoingCount: 2, OutgoingAmount: 2 + 8}},
+		{"zjz recorded", members[0].OperatorRange, Statistics{OutgoingCount: 2, OutgoingAmount: 2 + 16}},
+		{"zym recorded", members[1].OperatorRange, Statistics{OutgoingCount: 2, OutgoingAmount: 4 + 8}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.NotNil(t, c.actual)
+			assert.EqualValues(t, c.expected, *c.actual)
+		})
+	}
+
+	reqs := []struct {
+		req   MemberStatisticsRequest
+		valid bool
+	}{
+		{MemberStatisticsRequest{}, true},
+		{MemberStatisticsRequest{StartAt: startAt}, true},
+		{MemberStatisticsRequest{StartAt: startAt, FinishAt: finishAt}, true},
+		{MemberStatisticsRequest{StartAt: finishAt, FinishAt: startAt}, false},
+		{MemberStatisticsRequest{FinishAt: finishAt}, false},
+	}
+
+	for _, r := range reqs {
+		assert.EqualValues(t, r.valid, r.req.Valid(), r.req)
+	}
+}
@@ -60,6 +60,16 @@ func (s *Server) handleWalletNewInner(c *gin.Context) (walletID uint64, code Cod
 		return
 	}
 
+	if req.Currency != "" {
+		err = s.storage.SetWalletCurrency(walletID, req.Currency)
+		if err != nil {
+			code = CodeInternalError
+			msg = err.Error()
+
+			return
+		}
+	}
+
 	code = CodeSuccess
 
 	return
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sgostarter/i/l"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	maxIdempotencyKeyLength   = 128
+	recordIdempotencyDuration = time.Hour * 24
+)
+
+type idempotencyResult struct {
+	RecordIDs      []string          `json:"recordIDs"`
+	Code           Code              `json:"code"`
+	Msg            string            `json:"msg"`
+	GroupRecordIDs map[uint64]string `json:"groupRecordIDs,omitempty"` // group ID - record ID, of a failed attempt
+}
+
+// idempotencyLocks serializes the requests with the same idempotency key, a retry may arrive while the first
+// request is still recording.
+type idempotencyLocks struct {
+	lock  sync.Mutex
+	locks map[string]*idempotencyKeyLock
+}
+
+type idempotencyKeyLock struct {
+	sync.Mutex
+	refs int
+}
+
+func idempotencyLockKey(uid uint64, key string) string {
+	return strconv.FormatUint(uid, 10) + ":" + key
+}
+
+// lockKeys locks the keys in sorted order so that two batches can't deadlock, the empty keys are skipped.
+func (locks *idempotencyLocks) lockKeys(uid uint64, keys ...string) (unlock func()) {
+	lockKeys := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+
+		lockKey := idempotencyLockKey(uid, key)
+		if !slices.Contains(lockKeys, lockKey) {
+			lockKeys = append(lockKeys, lockKey)
+		}
+	}
+
+	slices.Sort(lockKeys)
+
+	keyLocks := make([]*idempotencyKeyLock, 0, len(lockKeys))
+
+	locks.lock.Lock()
+
+	if locks.locks == nil {
+		locks.locks = make(map[string]*idempotencyKeyLock)
+	}
+
+	for _, lockKey := range lockKeys {
+		keyLock, ok := locks.locks[lockKey]
+		if !ok {
+			keyLock = &idempotencyKeyLock{}
+			locks.locks[lockKey] = keyLock
+		}
+
+		keyLock.refs++
+
+		keyLocks = append(keyLocks, keyLock)
+	}
+
+	locks.lock.Unlock()
+
+	for _, keyLock := range keyLocks {
+		keyLock.Lock()
+	}
+
+	return func() {
+		for _, keyLock := range keyLocks {
+			keyLock.Unlock()
+		}
+
+		locks.lock.Lock()
+		defer locks.lock.Unlock()
+
+		for idx, lockKey := range lockKeys {
+			keyLocks[idx].refs--
+
+			if keyLocks[idx].refs == 0 {
+				delete(locks.locks, lockKey)
+			}
+		}
+	}
+}
+
+// recordSingleIdempotent records req once per idempotency key, retries get the result of the first success.
+// A failed attempt remembers the groups it recorded, so the retry only records the others.
+func (s *Server) recordSingleIdempotent(uid uint64, req RecordRequest) (billIDs []string, code Code, msg string) {
+	if req.IdempotencyKey == "" {
+		return s.recordSingle(uid, req)
+	}
+
+	defer s.idempotencyLocks.lockKeys(uid, req.IdempotencyKey)()
+
+	result, ok := s.getIdempotencyResult(uid, req.IdempotencyKey)
+	if ok && result.Code == CodeSuccess {
+		return result.RecordIDs, result.Code, result.Msg
+	}
+
+	groupRecordIDs := result.GroupRecordIDs
+	if groupRecordIDs == nil {
+		groupRecordIDs = make(map[uint64]string)
+	}
+
+	recordedCount := len(groupRecordIDs)
+
+	billIDs, code, msg = s.recordGroups(uid, req, groupRecordIDs)
+	if code != CodeSuccess {
+		if len(groupRecordIDs) > recordedCount {
+			s.saveIdempotencyResult(uid, req.IdempotencyKey, idempotencyResult{
+				Code:           code,
+				Msg:            msg,
+				GroupRecordIDs: groupRecordIDs,
+			})
+		}
+
+		return
+	}
+
+	s.saveIdempotencyResult(uid, req.IdempotencyKey, idempotencyResult{
+		RecordIDs: billIDs,
+		Code:      code,
+		Msg:       msg,
+	})
+
+	return
+}
+
+func (s *Server) getIdempotencyResult(uid uint64, key string) (result idempotencyResult, ok bool) {
+	if key == "" {
+		return
+	}
+
+	d, ok := s.storage.GetIdempotencyResult(uid, key)
+	if !ok {
+		return
+	}
+
+	ok = json.Unmarshal(d, &result) == nil
+
+	return
+}
+
+func (s *Server) saveIdempotencyResult(uid uint64, key string, result idempotencyResult) {
+	d, _ := json.Marshal(result)
+
+	if err := s.storage.SetIdempotencyResult(uid, key, d, recordIdempotencyDuration); err != nil {
+		s.logger.WithFields(l.ErrorField(err), l.UInt64Field("uid", uid),
+			l.StringField("key", key)).Warn("save idempotency result failed")
+	}
+}
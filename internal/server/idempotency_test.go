@@ -0,0 +1,148 @@
+package server
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordSingleIdempotentRetry(t *testing.T) {
+	s := utNewServer(t, "idempotency")
+
+	personID, walletID, err := s.storage.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := s.storage.NewPerson("shop")
+	assert.Nil(t, err)
+
+	homeGroupID, err := s.storage.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	workGroupID, err := s.storage.NewGroup("work", personID)
+	assert.Nil(t, err)
+
+	req := RecordRequest{
+		FromSubWalletID: idN2S(walletID),
+		ToSubWalletID:   idN2S(shopWalletID),
+		Amount:          100,
+		At:              utAt(2023, 11, 10, 12),
+		IdempotencyKey:  "k1",
+	}
+	assert.True(t, req.Valid())
+
+	// a failed attempt recorded the home group only
+	groupRecordIDs := map[uint64]string{workGroupID: "x"}
+
+	_, code, _ := s.recordGroups(personID, req, groupRecordIDs)
+	assert.EqualValues(t, CodeSuccess, code)
+
+	delete(groupRecordIDs, workGroupID)
+
+	s.saveIdempotencyResult(personID, req.IdempotencyKey, idempotencyResult{
+		Code:           CodeInternalError,
+		GroupRecordIDs: groupRecordIDs,
+	})
+
+	billIDs, code, _ := s.recordSingleIdempotent(personID, req)
+	assert.EqualValues(t, CodeSuccess, code)
+	assert.EqualValues(t, 2, len(billIDs))
+	assert.Contains(t, billIDs, groupRecordIDs[homeGroupID])
+
+	retryBillIDs, code, _ := s.recordSingleIdempotent(personID, req)
+	assert.EqualValues(t, CodeSuccess, code)
+	assert.EqualValues(t, billIDs, retryBillIDs)
+
+	for _, groupID := range []uint64{homeGroupID, workGroupID} {
+		bills, e := s.storage.GetBills(groupID)
+		assert.Nil(t, e)
+		assert.EqualValues(t, 1, len(bills))
+	}
+}
+
+func TestIdempotencyLocks(t *testing.T) {
+	var locks idempotencyLocks
+
+	unlock := locks.lockKeys(1, "a", "b", "a", "")
+
+	locked := make(chan struct{})
+
+	go func() {
+		defer locks.lockKeys(1, "b")()
+
+		close(locked)
+	}()
+
+	// other keys and other persons are not blocked
+	locks.lockKeys(1, "c")()
+	locks.lockKeys(2, "a")()
+
+	select {
+	case <-locked:
+		t.Fatal("the same key is locked twice")
+	default:
+	}
+
+	unlock()
+
+	<-locked
+
+	var wg sync.WaitGroup
+
+	for idx := 0; idx < 10; idx++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			locks.lockKeys(1, "a", "b")()
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Empty(t, locks.locks)
+}
+
+func TestRecordBatchAtomicDuplicateKeys(t *testing.T) {
+	s := utNewServer(t, "idempotency-batch")
+
+	personID, walletID, err := s.storage.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := s.storage.NewPerson("shop")
+	assert.Nil(t, err)
+
+	groupID, err := s.storage.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	fnReq := func(key string) RecordRequest {
+		return RecordRequest{
+			FromSubWalletID: idN2S(walletID),
+			ToSubWalletID:   idN2S(shopWalletID),
+			Amount:          100,
+			At:              utAt(2023, 11, 10, 12),
+			IdempotencyKey:  key,
+		}
+	}
+
+	results, code, _ := s.recordBatchAtomic(personID, []RecordRequest{fnReq("k1"), fnReq("k2"), fnReq("k1")})
+	assert.EqualValues(t, CodeInvalidArgs, code)
+	assert.EqualValues(t, CodeBatchAborted, results[0].Code)
+	assert.EqualValues(t, CodeInvalidArgs, results[2].Code)
+
+	bills, err := s.storage.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(bills))
+
+	results, code, _ = s.recordBatchAtomic(personID, []RecordRequest{fnReq("k1"), fnReq("k2"), fnReq("")})
+	assert.EqualValues(t, CodeSuccess, code)
+
+	for _, result := range results {
+		assert.EqualValues(t, CodeSuccess, result.Code)
+	}
+
+	bills, err = s.storage.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, len(bills))
+}
@@ -1,10 +1,12 @@
 package server
 
 import (
+	"strings"
 	"time"
 
 	"github.com/s-min-sys/lifecostbe/internal/model"
 	"github.com/sgostarter/libcomponents/statistic/memdate/ex"
+	"golang.org/x/exp/slices"
 )
 
 type ResponseWrapper struct {
@@ -47,8 +49,9 @@ type LoginResponse struct {
 }
 
 type WalletWithInfo struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
 }
 
 type MerchantWallets struct {
@@ -80,16 +83,57 @@ type RecordRequest struct {
 	FromSubWalletID string   `json:"fromSubWalletID"`
 	ToSubWalletID   string   `json:"toSubWalletID"`
 	Amount          int      `json:"amount"`
+	Currency        string   `json:"currency"` // empty: currency of the own wallet
 	LabelIDs        []string `json:"labelIDs"`
 	Remark          string   `json:"remark"`
 	LossAmount      int      `json:"lossAmount"`
 	LossWalletID    string   `json:"lossWalletID"`
 	At              int64    `json:"at"`
 
-	DFromSubWalletID uint64   `json:"-"`
-	DToSubWalletID   uint64   `json:"-"`
-	DLabelIDs        []uint64 `json:"-"`
-	DLossWalletID    uint64   `json:"-"`
+	Split *RecordSplit `json:"split,omitempty"` // share the amount with group members, only for spending of own wallet
+
+	IdempotencyKey string `json:"idempotencyKey,omitempty"` // retries with the same key get the first result
+
+	DFromSubWalletID uint64           `json:"-"`
+	DToSubWalletID   uint64           `json:"-"`
+	DLabelIDs        []uint64         `json:"-"`
+	DLossWalletID    uint64           `json:"-"`
+	DSplit           *model.BillSplit `json:"-"`
+}
+
+type RecordSplitShare struct {
+	PersonID string `json:"personID"`
+	Share    int    `json:"share"`  // SplitModeShare
+	Amount   int    `json:"amount"` // SplitModeAmount
+}
+
+type RecordSplit struct {
+	Mode   model.SplitMode    `json:"mode"`
+	Shares []RecordSplitShare `json:"shares"`
+}
+
+func (split *RecordSplit) toBillSplit(amount int) (billSplit *model.BillSplit, ok bool) {
+	billSplit = &model.BillSplit{
+		Mode:   split.Mode,
+		Shares: make([]model.SplitShare, 0, len(split.Shares)),
+	}
+
+	for _, share := range split.Shares {
+		personID, err := idS2N(share.PersonID)
+		if err != nil {
+			return
+		}
+
+		billSplit.Shares = append(billSplit.Shares, model.SplitShare{
+			PersonID: personID,
+			Share:    share.Share,
+			Amount:   share.Amount,
+		})
+	}
+
+	ok = billSplit.Resolve(amount)
+
+	return
 }
 
 func (req *RecordRequest) Valid() (ok bool) {
@@ -133,21 +177,45 @@ func (req *RecordRequest) Valid() (ok bool) {
 		return
 	}
 
+	if req.Currency != "" {
+		req.Currency = strings.ToUpper(req.Currency)
+
+		if !model.ValidCurrency(req.Currency) {
+			return
+		}
+	}
+
+	if len(req.IdempotencyKey) > maxIdempotencyKeyLength {
+		return
+	}
+
 	if req.At == 0 {
 		req.At = time.Now().Unix()
 	}
 
+	req.DSplit = nil
+
+	if req.Split != nil {
+		req.DSplit, ok = req.Split.toBillSplit(req.Amount)
+		if !ok {
+			return
+		}
+	}
+
 	ok = true
 
 	return
 }
 
 type WalletNewRequest struct {
-	Name string `json:"name"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
 }
 
 func (req *WalletNewRequest) Valid() bool {
-	return req.Name != ""
+	req.Currency = strings.ToUpper(req.Currency)
+
+	return req.Name != "" && (req.Currency == "" || model.ValidCurrency(req.Currency))
 }
 
 type WalletNewResponse struct {
@@ -197,6 +265,8 @@ type Bill struct {
 	ToSubWalletName   string        `json:"toSubWalletName"`
 	CostDir           model.CostDir `json:"costDir"`
 	Amount            int           `json:"amount"`
+	Currency          string        `json:"currency"`
+	BaseAmount        int           `json:"baseAmount"`
 	LabelIDs          []string      `json:"labelIDs"`
 	LabelIDNames      []string      `json:"labelIDNames"`
 	Remark            string        `json:"remark"`
@@ -210,6 +280,22 @@ type Bill struct {
 	ToPersonName   string `json:"toPersonName"`
 	OperationID    string `json:"operationID"`
 	OperationName  string `json:"operationName"`
+
+	Attachments []model.Attachment `json:"attachments"`
+	Split       *BillSplit         `json:"split,omitempty"`
+	Settlement  bool               `json:"settlement"`
+}
+
+type BillSplitShare struct {
+	PersonID   string `json:"personID"`
+	PersonName string `json:"personName"`
+	Share      int    `json:"share"`
+	Amount     int    `json:"amount"`
+}
+
+type BillSplit struct {
+	Mode   model.SplitMode  `json:"mode"`
+	Shares []BillSplitShare `json:"shares"`
 }
 
 type GetRecordsResponse struct {
@@ -267,27 +353,103 @@ func (req *WalletNewByDirRequest) Valid() bool {
 
 type BatchRecordRequest struct {
 	Records []RecordRequest `json:"records"`
+	Atomic  bool            `json:"atomic"` // true: all records are written or none
 }
 
 func (req *BatchRecordRequest) Valid() bool {
-	for idx := range req.Records {
-		if !req.Records[idx].Valid() {
-			return false
-		}
-	}
+	return len(req.Records) > 0
+}
 
-	return true
+type BatchRecordResult struct {
+	Index     int      `json:"index"`
+	RecordIDs []string `json:"recordIDs"` // one per group the record is written to
+	Code      Code     `json:"code"`
+	Message   string   `json:"message"`
+}
+
+type BatchRecordResponse struct {
+	Results []BatchRecordResult `json:"results"`
 }
 
 type DeletedBill struct {
 	Bill      `json:",inline"`
 	DeletedAt string `json:"deletedAt"`
+	GroupID   string `json:"groupID,omitempty"`
+	GroupName string `json:"groupName,omitempty"`
 }
 
 type GetDeletedRecordsResponse struct {
 	Bills []DeletedBill `json:"bills"`
 }
 
+type QueryDeletedRecordsRequest struct {
+	GroupID         string `json:"groupID"`         // empty: the default group
+	AllGroups       bool   `json:"allGroups"`       // true: all my groups, GroupID is ignored
+	DeletedStartAt  int64  `json:"deletedStartAt"`  // 0: no lower bound
+	DeletedFinishAt int64  `json:"deletedFinishAt"` // 0: no upper bound
+	OperationID     string `json:"operationID"`     // the person who deleted the records
+	Asc             bool   `json:"asc"`             // sort by deleted time, false: newest first
+
+	RecordID  string `json:"recordID"` // cursor: the last record id of previous page
+	PageCount int    `json:"pageCount"`
+
+	DOperationID uint64 `json:"-"`
+}
+
+func (req *QueryDeletedRecordsRequest) Valid() bool {
+	var err error
+
+	if req.OperationID != "" {
+		req.DOperationID, err = idS2N(req.OperationID)
+		if err != nil {
+			return false
+		}
+	}
+
+	if req.DeletedFinishAt > 0 && req.DeletedStartAt > req.DeletedFinishAt {
+		return false
+	}
+
+	return req.PageCount >= 0
+}
+
+func (req *QueryDeletedRecordsRequest) Match(bill model.DeletedGroupBill) bool {
+	if req.DeletedStartAt > 0 && bill.DeletedAt.Unix() < req.DeletedStartAt {
+		return false
+	}
+
+	if req.DeletedFinishAt > 0 && bill.DeletedAt.Unix() > req.DeletedFinishAt {
+		return false
+	}
+
+	if req.DOperationID != 0 && bill.DeletedBy != req.DOperationID {
+		return false
+	}
+
+	return true
+}
+
+type QueryDeletedRecordsResponse struct {
+	Bills   []DeletedBill `json:"bills"`
+	HasMore bool          `json:"hasMore"`
+}
+
+type DeletedRecordsRequest struct {
+	RecordIDs []string `json:"recordIDs"`
+}
+
+func (req *DeletedRecordsRequest) Valid() bool {
+	return len(req.RecordIDs) > 0
+}
+
+type EmptyTrashRequest struct {
+	GroupID string `json:"groupID"` // empty: all my groups
+}
+
+type DeletedRecordsCountResponse struct {
+	Count int `json:"count"`
+}
+
 type DeleteRecordRequest struct {
 	RequestStat  bool     `json:"requestStat"`
 	StatLabelIDs []string `json:"statLabelIDs"` // empty: all; [] 0: no label record; labelID: label id record
@@ -348,6 +510,219 @@ type StatAllResponse struct {
 	Years []StatYear `json:"years"`
 }
 
+type BreakdownRequest struct {
+	GroupID  string        `json:"groupID"`  // empty: the default group
+	StartAt  int64         `json:"startAt"`  // 0: the first day of this month
+	FinishAt int64         `json:"finishAt"` // 0: now
+	CostDir  model.CostDir `json:"costDir"`  // CostDirOut or CostDirIn, 0: CostDirOut
+	TopN     int           `json:"topN"`     // items after the top N are merged into 其他, 0: all
+}
+
+func (req *BreakdownRequest) Valid() bool {
+	timeNow := time.Now()
+
+	if req.StartAt == 0 {
+		req.StartAt = time.Date(timeNow.Year(), timeNow.Month(), 1, 0, 0, 0, 0, time.Local).Unix()
+	}
+
+	if req.FinishAt == 0 {
+		req.FinishAt = timeNow.Unix()
+	}
+
+	if req.CostDir == 0 {
+		req.CostDir = model.CostDirOut
+	}
+
+	return req.StartAt <= req.FinishAt && req.TopN >= 0 &&
+		(req.CostDir == model.CostDirOut || req.CostDir == model.CostDirIn)
+}
+
+type BreakdownItem struct {
+	ID      string  `json:"id"` // wallet or label id, 0: no label, empty: 其他
+	Name    string  `json:"name"`
+	Count   int     `json:"count"`
+	Amount  int     `json:"amount"`
+	Percent float64 `json:"percent"` // of TotalAmount, labels overlap for bills with several labels
+}
+
+type BreakdownResponse struct {
+	Currency    string          `json:"currency"` // the group base currency of the amounts
+	CostDir     model.CostDir   `json:"costDir"`
+	StartAt     int64           `json:"startAt"`
+	FinishAt    int64           `json:"finishAt"`
+	TotalCount  int             `json:"totalCount"`
+	TotalAmount int             `json:"totalAmount"`
+	Wallets     []BreakdownItem `json:"wallets"` // merchant wallets
+	Labels      []BreakdownItem `json:"labels"`
+}
+
+type RangeStatisticsRequest struct {
+	GroupID  string `json:"groupID"`  // empty: the default group
+	StartAt  int64  `json:"startAt"`  // 0: the first day of this month
+	FinishAt int64  `json:"finishAt"` // 0: now
+	LabelID  string `json:"labelID"`  // empty: all; 0: no label record; labelID: label id record
+	WalletID string `json:"walletID"` // empty: all; walletID: the records from or to the wallet
+
+	DLabelID  uint64 `json:"-"`
+	DHasLabel bool   `json:"-"`
+	DWalletID uint64 `json:"-"`
+}
+
+func (req *RangeStatisticsRequest) Valid() bool {
+	var err error
+
+	if req.LabelID != "" {
+		req.DLabelID, err = idS2N(req.LabelID)
+		if err != nil {
+			return false
+		}
+
+		req.DHasLabel = true
+	}
+
+	if req.WalletID != "" {
+		req.DWalletID, err = idS2N(req.WalletID)
+		if err != nil || req.DWalletID == 0 {
+			return false
+		}
+	}
+
+	timeNow := time.Now()
+
+	if req.StartAt == 0 {
+		req.StartAt = time.Date(timeNow.Year(), timeNow.Month(), 1, 0, 0, 0, 0, time.Local).Unix()
+	}
+
+	if req.FinishAt == 0 {
+		req.FinishAt = timeNow.Unix()
+	}
+
+	return req.StartAt <= req.FinishAt
+}
+
+func (req *RangeStatisticsRequest) Match(bill model.GroupBill) bool {
+	if req.DWalletID != 0 && bill.FromSubWalletID != req.DWalletID && bill.ToSubWalletID != req.DWalletID {
+		return false
+	}
+
+	if !req.DHasLabel {
+		return true
+	}
+
+	if req.DLabelID == 0 {
+		return len(bill.LabelIDs) == 0
+	}
+
+	return slices.Contains(bill.LabelIDs, req.DLabelID)
+}
+
+type RangeStatisticsResponse struct {
+	StartAt    int64      `json:"startAt"`
+	FinishAt   int64      `json:"finishAt"`
+	Statistics Statistics `json:"statistics"`
+}
+
+type CompareStatisticsRequest struct {
+	GroupID string `json:"groupID"` // empty: the default group
+	LabelID string `json:"labelID"` // empty: all; 0: no label record; labelID: label id record
+	At      int64  `json:"at"`      // the periods containing at, 0: now
+
+	DLabelID  uint64 `json:"-"`
+	DHasLabel bool   `json:"-"`
+}
+
+func (req *CompareStatisticsRequest) Valid() bool {
+	if req.LabelID != "" {
+		var err error
+
+		req.DLabelID, err = idS2N(req.LabelID)
+		if err != nil {
+			return false
+		}
+
+		req.DHasLabel = true
+	}
+
+	if req.At == 0 {
+		req.At = time.Now().Unix()
+	}
+
+	return req.At > 0
+}
+
+type StatisticsDelta struct {
+	IncomingCount  int `json:"incomingCount"`
+	OutgoingCount  int `json:"outgoingCount"`
+	IncomingAmount int `json:"incomingAmount"`
+	OutgoingAmount int `json:"outgoingAmount"`
+
+	// percent of the compared statistics, 0: the compared one is 0
+	IncomingCountPercent  float64 `json:"incomingCountPercent"`
+	OutgoingCountPercent  float64 `json:"outgoingCountPercent"`
+	IncomingAmountPercent float64 `json:"incomingAmountPercent"`
+	OutgoingAmountPercent float64 `json:"outgoingAmountPercent"`
+}
+
+type StatisticsComparison struct {
+	Current       Statistics      `json:"current"`
+	LastYear      Statistics      `json:"lastYear"`      // the same period last year
+	Previous      Statistics      `json:"previous"`      // the period before the current one
+	LastYearDelta StatisticsDelta `json:"lastYearDelta"` // current - lastYear
+	PreviousDelta StatisticsDelta `json:"previousDelta"` // current - previous
+}
+
+type CompareStatisticsResponse struct {
+	At     int64                `json:"at"`
+	Day    StatisticsComparison `json:"day"`
+	Week   StatisticsComparison `json:"week"`
+	Month  StatisticsComparison `json:"month"`
+	Season StatisticsComparison `json:"season"`
+	Year   StatisticsComparison `json:"year"`
+}
+
+type MemberStatisticsRequest struct {
+	GroupID  string `json:"groupID"`  // empty: the default group
+	At       int64  `json:"at"`       // the periods containing at, 0: now
+	StartAt  int64  `json:"startAt"`  // also the statistics between startAt and finishAt, 0: no range
+	FinishAt int64  `json:"finishAt"` // 0: now if startAt is set
+}
+
+func (req *MemberStatisticsRequest) Valid() bool {
+	timeNow := time.Now()
+
+	if req.At == 0 {
+		req.At = timeNow.Unix()
+	}
+
+	if req.StartAt == 0 {
+		return req.At > 0 && req.FinishAt == 0
+	}
+
+	if req.FinishAt == 0 {
+		req.FinishAt = timeNow.Unix()
+	}
+
+	return req.At > 0 && req.StartAt <= req.FinishAt
+}
+
+type MemberStatistics struct {
+	PersonID   string             `json:"personID"`
+	PersonName string             `json:"personName"`
+	Member     StatisticsResponse `json:"member"`   // the bills paid or received by the wallets of the person
+	Operator   StatisticsResponse `json:"operator"` // the bills recorded by the person
+
+	// between startAt and finishAt, only if the range is requested
+	MemberRange   *Statistics `json:"memberRange,omitempty"`
+	OperatorRange *Statistics `json:"operatorRange,omitempty"`
+}
+
+type MemberStatisticsResponse struct {
+	At       int64              `json:"at"`
+	StartAt  int64              `json:"startAt,omitempty"`
+	FinishAt int64              `json:"finishAt,omitempty"`
+	Members  []MemberStatistics `json:"members"`
+}
+
 type GetDayRecordsRequest struct {
 	Year  int `json:"year"`
 	Month int `json:"month"`
@@ -361,3 +736,275 @@ func (req *GetDayRecordsRequest) Valid() bool {
 type GetDayRecordsResponse struct {
 	Bills []Bill `json:"bills"`
 }
+
+type QueryRecordsRequest struct {
+	GroupID         string        `json:"groupID"`
+	StartAt         int64         `json:"startAt"`  // 0: no lower bound
+	FinishAt        int64         `json:"finishAt"` // 0: no upper bound
+	FromSubWalletID string        `json:"fromSubWalletID"`
+	ToSubWalletID   string        `json:"toSubWalletID"`
+	LabelIDs        []string      `json:"labelIDs"` // empty: all; [] 0: no label record; labelID: label id record
+	CostDir         model.CostDir `json:"costDir"`  // 0: all
+	MinAmount       int           `json:"minAmount"`
+	MaxAmount       int           `json:"maxAmount"` // 0: no upper bound
+	OperationID     string        `json:"operationID"`
+	Remark          string        `json:"remark"` // sub string of remark
+
+	RecordID  string `json:"recordID"` // cursor: the last record id of previous page
+	RecordAt  int64  `json:"recordAt"` // cursor: the at of the last record of previous page
+	PageCount int    `json:"pageCount"`
+
+	DFromSubWalletID uint64   `json:"-"`
+	DToSubWalletID   uint64   `json:"-"`
+	DLabelIDs        []uint64 `json:"-"`
+	DOperationID     uint64   `json:"-"`
+}
+
+func (req *QueryRecordsRequest) Valid() bool {
+	var err error
+
+	if req.FromSubWalletID != "" {
+		req.DFromSubWalletID, err = idS2N(req.FromSubWalletID)
+		if err != nil {
+			return false
+		}
+	}
+
+	if req.ToSubWalletID != "" {
+		req.DToSubWalletID, err = idS2N(req.ToSubWalletID)
+		if err != nil {
+			return false
+		}
+	}
+
+	if req.OperationID != "" {
+		req.DOperationID, err = idS2N(req.OperationID)
+		if err != nil {
+			return false
+		}
+	}
+
+	req.DLabelIDs = make([]uint64, 0, len(req.LabelIDs))
+
+	for _, labelID := range req.LabelIDs {
+		dLabelID, e := idS2N(labelID)
+		if e != nil {
+			return false
+		}
+
+		req.DLabelIDs = append(req.DLabelIDs, dLabelID)
+	}
+
+	if req.RecordID != "" && req.RecordAt <= 0 {
+		return false
+	}
+
+	if req.CostDir != 0 && (req.CostDir < model.CostDirInGroup || req.CostDir > model.CostDirOut) {
+		return false
+	}
+
+	if req.FinishAt > 0 && req.StartAt > req.FinishAt {
+		return false
+	}
+
+	if req.MaxAmount > 0 && req.MinAmount > req.MaxAmount {
+		return false
+	}
+
+	return req.PageCount >= 0
+}
+
+func (req *QueryRecordsRequest) Match(bill model.GroupBill) bool {
+	if req.StartAt > 0 && bill.At < req.StartAt {
+		return false
+	}
+
+	if req.FinishAt > 0 && bill.At > req.FinishAt {
+		return false
+	}
+
+	if req.DFromSubWalletID != 0 && bill.FromSubWalletID != req.DFromSubWalletID {
+		return false
+	}
+
+	if req.DToSubWalletID != 0 && bill.ToSubWalletID != req.DToSubWalletID {
+		return false
+	}
+
+	if req.CostDir != 0 && bill.CostDir != req.CostDir {
+		return false
+	}
+
+	if bill.Amount < req.MinAmount {
+		return false
+	}
+
+	if req.MaxAmount > 0 && bill.Amount > req.MaxAmount {
+		return false
+	}
+
+	if req.DOperationID != 0 && bill.OperationPersonID != req.DOperationID {
+		return false
+	}
+
+	if req.Remark != "" && !strings.Contains(bill.Remark, req.Remark) {
+		return false
+	}
+
+	if len(req.DLabelIDs) == 0 {
+		return true
+	}
+
+	for _, labelID := range req.DLabelIDs {
+		if labelID == 0 && len(bill.LabelIDs) == 0 {
+			return true
+		}
+
+		if labelID != 0 && slices.Contains(bill.LabelIDs, labelID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type QueryRecordsResponse struct {
+	Bills      []Bill     `json:"bills"`
+	HasMore    bool       `json:"hasMore"`
+	Statistics Statistics `json:"statistics"` // of all the matched records, on the first page only
+}
+
+type RecurringRule struct {
+	ID                string                  `json:"id"`
+	Name              string                  `json:"name"`
+	FromSubWalletID   string                  `json:"fromSubWalletID"`
+	FromSubWalletName string                  `json:"fromSubWalletName"`
+	ToSubWalletID     string                  `json:"toSubWalletID"`
+	ToSubWalletName   string                  `json:"toSubWalletName"`
+	Amount            int                     `json:"amount"`
+	Currency          string                  `json:"currency"`
+	LabelIDs          []string                `json:"labelIDs"`
+	LabelIDNames      []string                `json:"labelIDNames"`
+	Remark            string                  `json:"remark"`
+	LossAmount        int                     `json:"lossAmount"`
+	LossWalletID      string                  `json:"lossWalletID"`
+	Schedule          model.RecurringSchedule `json:"schedule"`
+	Month             int                     `json:"month"`
+	Day               int                     `json:"day"`
+	Hour              int                     `json:"hour"`
+	Minute            int                     `json:"minute"`
+	Paused            bool                    `json:"paused"`
+	StartAt           int64                   `json:"startAt"`
+	LastRunAt         int64                   `json:"lastRunAt"`
+	NextAt            int64                   `json:"nextAt"`
+	NextAtS           string                  `json:"nextAtS"`
+}
+
+type GetRecurringRulesResponse struct {
+	Rules []RecurringRule `json:"rules"`
+}
+
+type RecurringRuleNewRequest struct {
+	Name     string                  `json:"name"`
+	Record   RecordRequest           `json:"record"` // at is ignored
+	Schedule model.RecurringSchedule `json:"schedule"`
+	Month    int                     `json:"month"` // yearly: 1-12
+	Day      int                     `json:"day"`   // weekly: 0(Sunday)-6; monthly/yearly: 1-31
+	Hour     int                     `json:"hour"`
+	Minute   int                     `json:"minute"`
+	StartAt  int64                   `json:"startAt"` // 0: now
+}
+
+func (req *RecurringRuleNewRequest) Valid() bool {
+	return req.Record.Valid()
+}
+
+type RecurringRuleNewResponse struct {
+	ID string `json:"id"`
+}
+
+type GroupBaseCurrencyRequest struct {
+	GroupID  string `json:"groupID"`
+	Currency string `json:"currency"`
+}
+
+func (req *GroupBaseCurrencyRequest) Valid() bool {
+	req.Currency = strings.ToUpper(req.Currency)
+
+	return model.ValidCurrency(req.Currency)
+}
+
+type ExchangeRateSetRequest struct {
+	From string  `json:"from"`
+	To   string  `json:"to"`
+	Date string  `json:"date"` // YYYYMMDD, empty: today
+	Rate float64 `json:"rate"` // 1 From = Rate To
+}
+
+func (req *ExchangeRateSetRequest) Valid() bool {
+	if req.Date == "" {
+		req.Date = time.Now().Format("20060102")
+	}
+
+	return req.From != "" && req.To != "" && req.Rate > 0
+}
+
+type GetExchangeRatesResponse struct {
+	Rates []model.ExchangeRate `json:"rates"`
+}
+
+type SettlementRequest struct {
+	GroupID string `json:"groupID"`
+}
+
+type SettlementBalance struct {
+	PersonID   string `json:"personID"`
+	PersonName string `json:"personName"`
+	Balance    int    `json:"balance"` // > 0: others owe the person; < 0: the person owes others
+}
+
+type SettlementTransfer struct {
+	FromPersonID   string `json:"fromPersonID"`
+	FromPersonName string `json:"fromPersonName"`
+	ToPersonID     string `json:"toPersonID"`
+	ToPersonName   string `json:"toPersonName"`
+	Amount         int    `json:"amount"`
+}
+
+type SettlementResponse struct {
+	Currency  string               `json:"currency"`
+	Balances  []SettlementBalance  `json:"balances"`
+	Transfers []SettlementTransfer `json:"transfers"` // the fewest transfers, greedy over 16 persons with balances
+}
+
+type SettlementRecordRequest struct {
+	GroupID         string `json:"groupID"`
+	FromSubWalletID string `json:"fromSubWalletID"`
+	ToSubWalletID   string `json:"toSubWalletID"`
+	Amount          int    `json:"amount"`
+	Remark          string `json:"remark"`
+	At              int64  `json:"at"`
+
+	DFromSubWalletID uint64 `json:"-"`
+	DToSubWalletID   uint64 `json:"-"`
+}
+
+func (req *SettlementRecordRequest) Valid() bool {
+	var err error
+
+	req.DFromSubWalletID, err = idS2N(req.FromSubWalletID)
+	if err != nil || req.DFromSubWalletID == 0 {
+		return false
+	}
+
+	req.DToSubWalletID, err = idS2N(req.ToSubWalletID)
+	if err != nil || req.DToSubWalletID == 0 {
+		return false
+	}
+
+	if req.At == 0 {
+		req.At = time.Now().Unix()
+	}
+
+	return req.Amount > 0
+}
@@ -1,67 +1,69 @@
 package server
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
+	"github.com/s-min-sys/lifecostbe/internal/config"
 	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/s-min-sys/lifecostbe/internal/storage"
+	"github.com/sgostarter/i/l"
 	"github.com/sgostarter/libcomponents/statistic/memdate"
 	"github.com/sgostarter/libcomponents/statistic/memdate/ex"
 	"github.com/sgostarter/libeasygo/stg/fs/rawfs"
 	"github.com/sgostarter/libeasygo/stg/mwf"
-	"github.com/spf13/cast"
 )
 
 /*
 group-id:label-id:
 group-id:group-id
+group-id:w wallet-id: the from and to wallets of the bills
+group-id:o person-id: the operation persons of the bills
+group-id:m person-id: the members whose wallets pay the outgoing bills or receive the incoming ones
 */
 
 func billStatKey(groupID, labelID uint64) string {
 	return fmt.Sprintf("%d-%d", groupID, labelID)
 }
 
-func readFileBills(path string) (bills []model.GroupBill, err error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return
-	}
-
-	defer file.Close()
-
-	reader := bufio.NewReader(file)
+func billWalletStatKey(groupID, walletID uint64) string {
+	return fmt.Sprintf("%d-w%d", groupID, walletID)
+}
 
-	for {
-		var line []byte
+func billOperatorStatKey(groupID, personID uint64) string {
+	return fmt.Sprintf("%d-o%d", groupID, personID)
+}
 
-		line, err = reader.ReadBytes('\n')
-		if err == io.EOF {
-			err = nil
+func billMemberStatKey(groupID, personID uint64) string {
+	return fmt.Sprintf("%d-m%d", groupID, personID)
+}
 
-			break
-		}
+func billPersonStatKeys(groupID uint64, bill model.GroupBill, walletPersonID func(walletID uint64) uint64) (
+	keys []string) {
+	if bill.OperationPersonID != 0 {
+		keys = append(keys, billOperatorStatKey(groupID, bill.OperationPersonID))
+	}
 
-		if err != nil {
-			return
-		}
+	walletID := bill.FromSubWalletID
+	if bill.CostDir == model.CostDirIn {
+		walletID = bill.ToSubWalletID
+	}
 
-		var bill model.GroupBill
+	if personID := walletPersonID(walletID); personID != 0 {
+		keys = append(keys, billMemberStatKey(groupID, personID))
+	}
 
-		err = json.Unmarshal(line, &bill)
-		if err != nil {
-			return
-		}
+	return
+}
 
-		bills = append(bills, bill)
+func billWalletStatKeys(groupID uint64, bill model.GroupBill) []string {
+	if bill.FromSubWalletID == bill.ToSubWalletID {
+		return []string{billWalletStatKey(groupID, bill.FromSubWalletID)}
 	}
 
-	return
+	return []string{billWalletStatKey(groupID, bill.FromSubWalletID), billWalletStatKey(groupID, bill.ToSubWalletID)}
 }
 
 func bill2LifeCostData4Delete(bill model.GroupBill) ex.LifeCostData {
@@ -71,10 +73,10 @@ func bill2LifeCostData4Delete(bill model.GroupBill) ex.LifeCostData {
 
 	if bill.CostDir == model.CostDirIn {
 		curD.EarnCount = 1
-		curD.EarnAmount = bill.Amount
+		curD.EarnAmount = bill.StatAmount()
 	} else if bill.CostDir == model.CostDirOut {
 		curD.ConsumeCount = 1
-		curD.ConsumeAmount = bill.Amount
+		curD.ConsumeAmount = bill.StatAmount()
 	} else {
 		curD.T = ex.ListCostDataNon
 	}
@@ -89,10 +91,10 @@ func bill2LifeCostData4Add(bill model.GroupBill) ex.LifeCostData {
 
 	if bill.CostDir == model.CostDirIn {
 		curD.EarnCount = 1
-		curD.EarnAmount = bill.Amount
+		curD.EarnAmount = bill.StatAmount()
 	} else if bill.CostDir == model.CostDirOut {
 		curD.ConsumeCount = 1
-		curD.ConsumeAmount = bill.Amount
+		curD.ConsumeAmount = bill.StatAmount()
 	} else {
 		curD.T = ex.ListCostDataNon
 	}
@@ -100,52 +102,45 @@ func bill2LifeCostData4Add(bill model.GroupBill) ex.LifeCostData {
 	return curD
 }
 
-func RebuildBills() (err error) {
-	_ = os.RemoveAll(filepath.Join(dataRoot, statFileName))
-
-	stat := memdate.NewMemDateStatistics[string, ex.LifeCostTotalData, ex.LifeCostData,
-		ex.LifeCostDataTrans, mwf.Serial, mwf.Lock](&mwf.JSONSerial{}, &mwf.NoLock{}, time.Local,
-		statFileName, rawfs.NewFSStorage(dataRoot))
-
-	files, err := os.ReadDir(filepath.Join(dataRoot, "bills"))
+// RebuildBills rebuilds the statistics from the bills of every group, read through the configured storage.
+func RebuildBills(cfg *config.Config) (err error) {
+	crypter, err := dataCrypter(cfg)
 	if err != nil {
 		return
 	}
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-
-		ps := strings.Split(file.Name(), "-")
-		if len(ps) != 2 {
-			continue
-		}
+	stg, err := newStorage(cfg, crypter, l.NewNopLoggerWrapper())
+	if err != nil {
+		return
+	}
 
-		if len(ps[1]) != 8 {
-			continue
-		}
+	defer stg.Close()
 
-		groupID := cast.ToUint64(ps[0])
+	groupIDs, err := stg.GetGroupIDs()
+	if err != nil {
+		return
+	}
 
-		bills, _ := readFileBills(filepath.Join(dataRoot, "bills", file.Name()))
+	_ = os.RemoveAll(filepath.Join(dataRoot, statFileName))
 
-		for _, bill := range bills {
-			if bill.CostDir == model.CostDirInGroup {
-				continue
-			}
+	s := &Server{
+		logger:  l.NewNopLoggerWrapper(),
+		storage: stg,
+		stat: memdate.NewMemDateStatistics[string, ex.LifeCostTotalData, ex.LifeCostData,
+			ex.LifeCostDataTrans, mwf.Serial, mwf.Lock](&mwf.JSONSerial{}, &mwf.NoLock{}, time.Local,
+			statFileName, storage.NewEncryptedFileStorage(rawfs.NewFSStorage(dataRoot), crypter)),
+	}
 
-			curD := bill2LifeCostData4Add(bill)
+	for _, groupID := range groupIDs {
+		var bills []model.GroupBill
 
-			if len(bill.LabelIDs) > 0 {
-				for _, labelID := range bill.LabelIDs {
-					stat.SetDayData(billStatKey(groupID, labelID), time.Unix(bill.At, 0), curD)
-				}
-			} else {
-				stat.SetDayData(billStatKey(groupID, 0), time.Unix(bill.At, 0), curD)
-			}
+		bills, err = stg.GetBills(groupID)
+		if err != nil {
+			return
+		}
 
-			stat.SetDayData(billStatKey(groupID, groupID), time.Unix(bill.At, 0), curD)
+		for _, bill := range bills {
+			s.statOnAddRecord(groupID, bill.LabelIDs, bill)
 		}
 	}
 
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/s-min-sys/lifecostbe/internal/config"
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/s-min-sys/lifecostbe/internal/storage"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libcomponents/statistic/memdate"
+	"github.com/sgostarter/libcomponents/statistic/memdate/ex"
+	"github.com/sgostarter/libeasygo/stg/fs/rawfs"
+	"github.com/sgostarter/libeasygo/stg/mwf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebuildBills(t *testing.T) {
+	for _, storageName := range []string{config.StorageFile, config.StorageSQLite} {
+		t.Run(storageName, func(t *testing.T) {
+			_ = os.RemoveAll(dataRoot)
+
+			cfg := &config.Config{
+				Storage:    storageName,
+				SQLiteFile: filepath.Join(dataRoot, "lifecost.db"),
+			}
+
+			stg, err := newStorage(cfg, nil, l.NewNopLoggerWrapper())
+			assert.Nil(t, err)
+
+			personID, walletID, err := stg.NewPerson("zjz")
+			assert.Nil(t, err)
+
+			_, shopWalletID, err := stg.NewPerson("shop")
+			assert.Nil(t, err)
+
+			groupID, err := stg.NewGroup("home", personID)
+			assert.Nil(t, err)
+
+			at := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+
+			for _, bill := range []model.GroupBill{
+				{FromSubWalletID: walletID, ToSubWalletID: shopWalletID, CostDir: model.CostDirOut, Amount: 100},
+				{FromSubWalletID: walletID, ToSubWalletID: shopWalletID, CostDir: model.CostDirOut, Amount: 50,
+					LabelIDs: []uint64{7}},
+				{FromSubWalletID: shopWalletID, ToSubWalletID: walletID, CostDir: model.CostDirIn, Amount: 30},
+			} {
+				bill.At = at.Unix()
+
+				_, err = stg.Record(groupID, bill)
+				assert.Nil(t, err)
+			}
+
+			stg.Close()
+
+			assert.Nil(t, RebuildBills(cfg))
+
+			stat := memdate.NewMemDateStatistics[string, ex.LifeCostTotalData, ex.LifeCostData,
+				ex.LifeCostDataTrans, mwf.Serial, mwf.Lock](&mwf.JSONSerial{}, &mwf.NoLock{}, time.Local,
+				statFileName, storage.NewEncryptedFileStorage(rawfs.NewFSStorage(dataRoot), nil))
+
+			cases := []struct {
+				key    string
+				totalD ex.LifeCostTotalData
+			}{
+				{billStatKey(groupID, groupID),
+					ex.LifeCostTotalData{ConsumeCount: 2, ConsumeAmount: 150, EarnCount: 1, EarnAmount: 30}},
+				{billStatKey(groupID, 7), ex.LifeCostTotalData{ConsumeCount: 1, ConsumeAmount: 50}},
+				{billWalletStatKey(groupID, walletID),
+					ex.LifeCostTotalData{ConsumeCount: 2, ConsumeAmount: 150, EarnCount: 1, EarnAmount: 30}},
+				{billMemberStatKey(groupID, personID),
+					ex.LifeCostTotalData{ConsumeCount: 2, ConsumeAmount: 150, EarnCount: 1, EarnAmount: 30}},
+			}
+
+			for _, c := range cases {
+				totalD, exists := stat.GetYearOn(c.key, at)
+				assert.True(t, exists, c.key)
+				assert.EqualValues(t, c.totalD, totalD, c.key)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/i/l"
+)
+
+const (
+	recurringRuleCheckInterval = time.Minute
+	maxRecurringRuleCatchUp    = 400
+)
+
+func (s *Server) recurringRuleRoutine(ctx context.Context, _ func() bool) {
+	logger := s.logger.WithFields(l.StringField(l.RoutineKey, "recurringRuleRoutine"))
+
+	logger.Debug("enter")
+
+	defer logger.Debug("leave")
+
+	s.runDueRecurringRules(logger)
+
+	ticker := time.NewTicker(recurringRuleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runDueRecurringRules(logger)
+		}
+	}
+}
+
+func (s *Server) runDueRecurringRules(logger l.Wrapper) {
+	rules, err := s.storage.GetRecurringRules(0)
+	if err != nil {
+		logger.WithFields(l.ErrorField(err)).Error("get recurring rules failed")
+
+		return
+	}
+
+	timeNow := time.Now()
+
+	for _, rule := range rules {
+		if rule.Paused {
+			continue
+		}
+
+		s.runRecurringRule(logger, rule, timeNow)
+	}
+}
+
+// runRecurringRule records every occurrence of rule due up to timeNow, catching up on occurrences
+// missed while the server was down.
+func (s *Server) runRecurringRule(logger l.Wrapper, rule model.RecurringRule, timeNow time.Time) {
+	logger = logger.WithFields(l.UInt64Field("ruleID", rule.ID))
+
+	lastRunAt := time.Unix(rule.LastRunAt, 0)
+	if rule.LastRunAt < rule.StartAt {
+		lastRunAt = time.Unix(rule.StartAt-1, 0)
+	}
+
+	for idx := 0; idx < maxRecurringRuleCatchUp; idx++ {
+		at := rule.NextAt(lastRunAt)
+		if at.IsZero() || at.After(timeNow) {
+			return
+		}
+
+		req := recurringRule2RecordRequest(rule, at)
+		if !req.Valid() {
+			logger.Error("invalid recurring rule")
+
+			return
+		}
+
+		// advanced before recording: a failed record is logged and skipped, never recorded twice
+		err := s.storage.SetRecurringRuleLastRunAt(rule.ID, at.Unix())
+		if err != nil {
+			logger.WithFields(l.ErrorField(err)).Error("save recurring rule last run at failed")
+
+			return
+		}
+
+		_, code, msg := s.recordSingle(rule.PersonID, req)
+		if code != CodeSuccess {
+			logger.WithFields(l.StringField("msg", CodeToMessage(code, msg)), l.Int64Field("at", at.Unix())).
+				Error("record recurring rule failed")
+		}
+
+		lastRunAt = at
+	}
+}
+
+func recurringRule2RecordRequest(rule model.RecurringRule, at time.Time) RecordRequest {
+	req := RecordRequest{
+		FromSubWalletID: idN2S(rule.FromSubWalletID),
+		ToSubWalletID:   idN2S(rule.ToSubWalletID),
+		Amount:          rule.Amount,
+		Currency:        rule.Currency,
+		LabelIDs:        idN2Ss(rule.LabelIDs),
+		Remark:          rule.Remark,
+		LossAmount:      rule.LossAmount,
+		At:              at.Unix(),
+	}
+
+	if rule.LossWalletID != 0 {
+		req.LossWalletID = idN2S(rule.LossWalletID)
+	}
+
+	return req
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunRecurringRule(t *testing.T) {
+	s := utNewServer(t, "recurring")
+
+	personID, walletID, err := s.storage.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := s.storage.NewPerson("shop")
+	assert.Nil(t, err)
+
+	groupID, err := s.storage.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	ruleID, err := s.storage.NewRecurringRule(model.RecurringRule{
+		PersonID:        personID,
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		Amount:          100,
+		Schedule:        model.RecurringScheduleMonthly,
+		Day:             31,
+		StartAt:         utAt(2023, 1, 1, 0),
+	})
+	assert.Nil(t, err)
+
+	timeNow := time.Unix(utAt(2023, 5, 1, 0), 0)
+
+	for idx := 0; idx < 2; idx++ {
+		rule, e := s.storage.GetRecurringRule(ruleID)
+		assert.Nil(t, e)
+
+		// the second run finds nothing due
+		s.runRecurringRule(s.logger, rule, timeNow)
+	}
+
+	bills, err := s.storage.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 4, len(bills))
+
+	for idx, day := range []int{31, 28, 31, 30} {
+		assert.EqualValues(t, time.Date(2023, time.Month(idx+1), day, 0, 0, 0, 0, time.Local).Unix(), bills[idx].At)
+	}
+
+	rule, err := s.storage.GetRecurringRule(ruleID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, bills[3].At, rule.LastRunAt)
+
+	// a failed record is skipped, the rule still moves on
+	rule.FromSubWalletID = shopWalletID + 1000
+
+	s.runRecurringRule(s.logger, rule, time.Unix(utAt(2023, 6, 1, 0), 0))
+
+	rule, err = s.storage.GetRecurringRule(ruleID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, utAt(2023, 5, 31, 0), rule.LastRunAt)
+
+	bills, err = s.storage.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 4, len(bills))
+}
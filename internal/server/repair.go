@@ -0,0 +1,19 @@
+package server
+
+import (
+	"path/filepath"
+
+	"github.com/s-min-sys/lifecostbe/internal/config"
+	"github.com/s-min-sys/lifecostbe/internal/storage"
+	"github.com/sgostarter/i/l"
+)
+
+// RepairBills checks the bill day files, with dryRun the problems are only reported.
+func RepairBills(cfg *config.Config, dryRun bool, logger l.Wrapper) (report storage.RepairBillFilesReport, err error) {
+	crypter, err := dataCrypter(cfg)
+	if err != nil {
+		return
+	}
+
+	return storage.RepairBillFiles(filepath.Join(dataRoot, "bills"), crypter, !dryRun, logger)
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"github.com/s-min-sys/lifecostbe/internal/config"
+	"github.com/s-min-sys/lifecostbe/internal/storage"
+	"github.com/sgostarter/i/l"
+)
+
+// MigrateSchema upgrades the data of the configured storage to the current schema version,
+// with dryRun the pending steps are only reported.
+func MigrateSchema(cfg *config.Config, dryRun bool, logger l.Wrapper) (report storage.SchemaMigrationReport, err error) {
+	if cfg.Storage == config.StorageSQLite {
+		return storage.MigrateSQLiteSchema(cfg.SQLiteFile, dryRun, logger)
+	}
+
+	crypter, err := dataCrypter(cfg)
+	if err != nil {
+		return
+	}
+
+	return storage.MigrateSchema(dataRoot, crypter, dryRun, logger)
+}
@@ -37,6 +37,10 @@ type Server struct {
 	accounts account.Account
 	storage  storage.Storage
 	stat     *memdate.Statistics[string, ex.LifeCostTotalData, ex.LifeCostData, ex.LifeCostDataTrans, mwf.Serial, mwf.Lock]
+	statLock *sync.RWMutex // the lock of stat, held by the backup
+
+	accountStorage   *quiescedAccountStorage // the storage of accounts, quiesced by the backup
+	idempotencyLocks idempotencyLocks
 }
 
 func NewServer(ctx context.Context, routineMan routineman.RoutineMan, cfg *config.Config, logger l.Wrapper) *Server {
@@ -54,17 +58,36 @@ func NewServer(ctx context.Context, routineMan routineman.RoutineMan, cfg *confi
 		return nil
 	}
 
+	crypter, err := dataCrypter(cfg)
+	if err != nil {
+		logger.WithFields(l.ErrorField(err)).Error("check data encryption failed")
+
+		return nil
+	}
+
+	stg, err := newStorage(cfg, crypter, logger)
+	if err != nil {
+		logger.WithFields(l.ErrorField(err), l.StringField("storage", cfg.Storage)).Error("open storage failed")
+
+		return nil
+	}
+
+	statLock := &sync.RWMutex{}
+
+	accountStorage := newQuiescedAccountStorage(fmaccountstorage.NewFMAccountStorageEx(dataRoot, nil, cfg.Debug))
+
 	s := &Server{
-		routineMan: routineMan,
-		cfg:        cfg,
-		logger:     logger.WithFields(l.StringField(l.ClsKey, "Server")),
-		accounts: account.NewAccount(fmaccountstorage.NewFMAccountStorageEx(dataRoot, nil, cfg.Debug),
-			&cfg.AccountConfig, logger),
-		storage: storage.NewStorage(dataRoot, cfg.Debug, logger),
+		routineMan:     routineMan,
+		cfg:            cfg,
+		logger:         logger.WithFields(l.StringField(l.ClsKey, "Server")),
+		accounts:       account.NewAccount(accountStorage, &cfg.AccountConfig, logger),
+		accountStorage: accountStorage,
+		storage:        stg,
 		stat: memdate.NewMemDateStatistics[string, ex.LifeCostTotalData, ex.LifeCostData,
-			ex.LifeCostDataTrans, mwf.Serial, mwf.Lock](&mwf.JSONSerial{}, &sync.RWMutex{}, time.Local,
+			ex.LifeCostDataTrans, mwf.Serial, mwf.Lock](&mwf.JSONSerial{}, statLock, time.Local,
 			statFileName,
-			rawfs.NewFSStorage(dataRoot)),
+			storage.NewEncryptedFileStorage(rawfs.NewFSStorage(dataRoot), crypter)),
+		statLock: statLock,
 	}
 
 	s.init()
@@ -72,12 +95,31 @@ func NewServer(ctx context.Context, routineMan routineman.RoutineMan, cfg *confi
 	return s
 }
 
+func newStorage(cfg *config.Config, crypter *storage.Crypter, logger l.Wrapper) (storage.Storage, error) {
+	if _, err := MigrateSchema(cfg, false, logger); err != nil {
+		return nil, err
+	}
+
+	if cfg.Storage == config.StorageSQLite {
+		return storage.NewSQLiteStorage(dataRoot, cfg.SQLiteFile, cfg.Debug, logger)
+	}
+
+	return storage.NewStorageEx(dataRoot, cfg.Debug, storage.Options{
+		MaxOpenBillFiles: cfg.MaxOpenBillFiles,
+		Crypter:          crypter,
+	}, logger), nil
+}
+
 func (s *Server) Wait() {
 	s.routineMan.Wait()
+
+	s.storage.Close()
 }
 
 func (s *Server) init() {
 	s.routineMan.StartRoutine(s.httpRoutine, "httpRoutine")
+	s.routineMan.StartRoutine(s.recurringRuleRoutine, "recurringRuleRoutine")
+	s.routineMan.StartRoutine(s.trashRetentionRoutine, "trashRetentionRoutine")
 }
 
 func JSONMiddleware() gin.HandlerFunc {
@@ -116,27 +158,59 @@ func (s *Server) httpRoutine(_ context.Context, _ func() bool) {
 	r.GET("/base-infos", s.handleGetBaseInfos)
 	r.POST("/record", s.handleRecord)
 	r.POST("/record/delete/:id", s.handleDeleteRecord)
+	r.POST("/record/update/:id", s.handleUpdateRecord)
 	r.POST("/record/batch", s.handleBatchRecord)
+	r.POST("/record/attachment/:id", s.handleRecordAttachmentUpload)
+	r.POST("/record/attachment/delete/:id/:aid", s.handleRecordAttachmentDelete)
+	r.GET("/record/attachment/:id/:aid", s.handleAttachmentDownload)
 	r.POST("/records", s.handleGetRecords)
 	r.POST("/records/day", s.handleGetDayRecords)
+	r.POST("/records/query", s.handleQueryRecords)
 	r.GET("/statistics/now", s.handleStatisticsNow)
 	r.GET("/statistics/all", s.handleStatisticsAll)
+	r.POST("/statistics/members", s.handleStatisticsMembers)
+	r.POST("/statistics/breakdown", s.handleStatisticsBreakdown)
+	r.POST("/statistics/range", s.handleStatisticsRange)
+	r.POST("/statistics/compare", s.handleStatisticsCompare)
 
 	r.GET("/deleted-records", s.handleGetDeletedRecords)
+	r.POST("/deleted-records/query", s.handleQueryDeletedRecords)
 	r.POST("/deleted-records/delete/:id", s.handleRemoveDeleteRecord)
 	r.POST("/deleted-records/restore/:id", s.handleRestoreDeleteRecord)
+	r.POST("/deleted-records/delete-batch", s.handleRemoveDeleteRecords)
+	r.POST("/deleted-records/restore-batch", s.handleRestoreDeleteRecords)
+	r.POST("/deleted-records/empty", s.handleEmptyTrash)
+
+	r.GET("/recurring-rules", s.handleGetRecurringRules)
+	r.POST("/recurring-rules/new", s.handleRecurringRuleNew)
+	r.POST("/recurring-rules/pause/:id", s.handleRecurringRulePause)
+	r.POST("/recurring-rules/resume/:id", s.handleRecurringRuleResume)
+	r.POST("/recurring-rules/delete/:id", s.handleRecurringRuleDelete)
 
 	r.POST("/manager/wallet/new", s.handleWalletNew)
 	r.POST("/manager/group/new", s.handleGroupNew)
 	r.POST("/manager/group/enter-codes", s.handleGroupEnterCodes)
 	r.POST("/manager/group/join/:code", s.handleGroupJoin)
 	r.POST("/manager/wallet/new-by-dir", s.handleWalletNewByDir)
+	r.POST("/manager/group/base-currency", s.handleGroupBaseCurrency)
+
+	r.GET("/exchange-rates", s.handleGetExchangeRates)
+	r.POST("/exchange-rates/set", s.handleExchangeRateSet)
+
+	r.POST("/settlement", s.handleSettlement)
+	r.POST("/settlement/record", s.handleSettlementRecord)
+
+	r.GET("/export", s.handleExport)
+	r.POST("/import", s.handleImport)
+
+	r.GET("/admin/backup", s.handleAdminBackup)
 
 	fnListen := func(listen string) {
 		srv := &http.Server{
-			Addr:        listen,
-			ReadTimeout: time.Second,
-			Handler:     r,
+			Addr:              listen,
+			ReadHeaderTimeout: time.Second,
+			ReadTimeout:       uploadReadTimeout, // the body of an attachment upload takes a while
+			Handler:           r,
 		}
 
 		logger.WithFields(l.StringField("listen", listen)).Debug("start listen")
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/s-min-sys/lifecostbe/internal/storage"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libcomponents/statistic/memdate"
+	"github.com/sgostarter/libcomponents/statistic/memdate/ex"
+	"github.com/sgostarter/libeasygo/stg/mwf"
+	"github.com/stretchr/testify/assert"
+)
+
+var utWorkDir = "../../uts-server/"
+
+func TestMain(m *testing.M) {
+	_ = os.MkdirAll(utWorkDir, os.ModePerm)
+	_ = os.Chdir(utWorkDir)
+
+	code := m.Run()
+
+	_ = os.Chdir("..")
+
+	_ = os.RemoveAll("uts-server")
+
+	os.Exit(code)
+}
+
+// utNewServer returns a server on a new storage in dir with the statistics kept in memory only.
+func utNewServer(t *testing.T, dir string) *Server {
+	_ = os.RemoveAll(dir)
+
+	stg := storage.NewStorage(dir, false, nil)
+	t.Cleanup(stg.Close)
+
+	statLock := &sync.RWMutex{}
+
+	return &Server{
+		logger:  l.NewNopLoggerWrapper(),
+		storage: stg,
+		stat: memdate.NewMemDateStatistics[string, ex.LifeCostTotalData, ex.LifeCostData,
+			ex.LifeCostDataTrans, mwf.Serial, mwf.Lock](&mwf.JSONSerial{}, statLock, time.Local, "", nil),
+		statLock: statLock,
+	}
+}
+
+// utRecord records the bill in the group and accumulates its statistics like the record handler.
+func utRecord(t *testing.T, s *Server, groupID uint64, bill model.GroupBill) model.GroupBill {
+	billID, err := s.storage.Record(groupID, bill)
+	assert.Nil(t, err)
+
+	bill.ID = billID
+
+	s.statOnAddRecord(groupID, bill.LabelIDs, bill)
+
+	return bill
+}
+
+func utAt(year int, month time.Month, day, hour int) int64 {
+	return time.Date(year, month, day, hour, 0, 0, 0, time.Local).Unix()
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"math/bits"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"golang.org/x/exp/slices"
+)
+
+type settlementTransfer struct {
+	fromPersonID uint64
+	toPersonID   uint64
+	amount       int
+}
+
+// settlementBalances sums up split bills and settlement transfers of a group in its base currency:
+// > 0 others owe the person, < 0 the person owes others.
+func settlementBalances(bills []model.GroupBill, walletPersonID func(walletID uint64) (uint64, bool)) map[uint64]int {
+	balances := make(map[uint64]int)
+
+	for _, bill := range bills {
+		fromPersonID, ok := walletPersonID(bill.FromSubWalletID)
+		if !ok {
+			continue
+		}
+
+		if bill.Settlement {
+			toPersonID, ok := walletPersonID(bill.ToSubWalletID)
+			if !ok {
+				continue
+			}
+
+			balances[fromPersonID] += bill.StatAmount()
+			balances[toPersonID] -= bill.StatAmount()
+
+			continue
+		}
+
+		if bill.Split == nil {
+			continue
+		}
+
+		var owedSum int
+
+		for _, share := range bill.Split.Shares {
+			owed := share.Amount
+			if bill.BaseAmount != 0 {
+				owed = share.Amount * bill.BaseAmount / bill.Amount
+			}
+
+			balances[share.PersonID] -= owed
+			owedSum += owed
+		}
+
+		balances[fromPersonID] += owedSum
+	}
+
+	for personID, balance := range balances {
+		if balance == 0 {
+			delete(balances, personID)
+		}
+	}
+
+	return balances
+}
+
+// maxMinimalSettlementPersons bounds the exact search of settlementTransfers, which takes 2^n steps.
+const maxMinimalSettlementPersons = 16
+
+// settlementTransfers returns the fewest transfers settling the balances. n people settle with n-k transfers,
+// k the most groups they can be split into whose balances sum to zero, each group settled by
+// settleGreedily with one transfer less than its size. Groups over maxMinimalSettlementPersons are settled
+// greedily as a whole, at most len(balances)-1 transfers but not always the fewest.
+func settlementTransfers(balances map[uint64]int) (transfers []settlementTransfer) {
+	personIDs := make([]uint64, 0, len(balances))
+
+	for personID, balance := range balances {
+		if balance != 0 {
+			personIDs = append(personIDs, personID)
+		}
+	}
+
+	if len(personIDs) > maxMinimalSettlementPersons {
+		return settleGreedily(balances)
+	}
+
+	slices.Sort(personIDs)
+
+	for _, group := range zeroSumGroups(personIDs, balances) {
+		groupBalances := make(map[uint64]int, len(group))
+
+		for _, personID := range group {
+			groupBalances[personID] = balances[personID]
+		}
+
+		transfers = append(transfers, settleGreedily(groupBalances)...)
+	}
+
+	return
+}
+
+// zeroSumGroups splits the persons into the most groups whose balances sum to zero.
+func zeroSumGroups(personIDs []uint64, balances map[uint64]int) (groups [][]uint64) {
+	n := len(personIDs)
+	full := 1<<n - 1
+
+	sums := make([]int, full+1)
+	// most zero sum groups the persons of mask are split into, counting a non-zero remainder as none
+	groupCounts := make([]int, full+1)
+
+	for mask := 1; mask <= full; mask++ {
+		low := bits.TrailingZeros(uint(mask))
+		sums[mask] = sums[mask&(mask-1)] + balances[personIDs[low]]
+
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 && groupCounts[mask^(1<<i)] > groupCounts[mask] {
+				groupCounts[mask] = groupCounts[mask^(1<<i)]
+			}
+		}
+
+		if sums[mask] == 0 {
+			groupCounts[mask]++
+		}
+	}
+
+	// walk back the persons in the order that closes a group whenever the sum returns to zero
+	order := make([]uint64, 0, n)
+
+	for mask := full; mask != 0; {
+		rest := groupCounts[mask]
+		if sums[mask] == 0 {
+			rest--
+		}
+
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 && groupCounts[mask^(1<<i)] == rest {
+				order = append(order, personIDs[i])
+				mask ^= 1 << i
+
+				break
+			}
+		}
+	}
+
+	var group []uint64
+
+	sum := 0
+
+	for idx := len(order) - 1; idx >= 0; idx-- {
+		group = append(group, order[idx])
+		sum += balances[order[idx]]
+
+		if sum == 0 {
+			groups = append(groups, group)
+			group = nil
+		}
+	}
+
+	// balances not summing to zero are still settled as far as they go
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+
+	return
+}
+
+// settleGreedily matches the biggest debtor with the biggest creditor, which settles everything with at
+// most len(balances)-1 transfers.
+func settleGreedily(balances map[uint64]int) (transfers []settlementTransfer) {
+	type personBalance struct {
+		personID uint64
+		amount   int
+	}
+
+	var creditors, debtors []personBalance
+
+	for personID, balance := range balances {
+		if balance > 0 {
+			creditors = append(creditors, personBalance{personID: personID, amount: balance})
+		} else if balance < 0 {
+			debtors = append(debtors, personBalance{personID: personID, amount: -balance})
+		}
+	}
+
+	fnSort := func(a, b personBalance) int {
+		if a.amount != b.amount {
+			return b.amount - a.amount
+		}
+
+		if a.personID < b.personID {
+			return -1
+		}
+
+		return 1
+	}
+
+	slices.SortFunc(creditors, fnSort)
+	slices.SortFunc(debtors, fnSort)
+
+	for c, d := 0, 0; c < len(creditors) && d < len(debtors); {
+		amount := creditors[c].amount
+		if debtors[d].amount < amount {
+			amount = debtors[d].amount
+		}
+
+		transfers = append(transfers, settlementTransfer{
+			fromPersonID: debtors[d].personID,
+			toPersonID:   creditors[c].personID,
+			amount:       amount,
+		})
+
+		creditors[c].amount -= amount
+		debtors[d].amount -= amount
+
+		if creditors[c].amount == 0 {
+			c++
+		}
+
+		if debtors[d].amount == 0 {
+			d++
+		}
+	}
+
+	return
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettlementBalances(t *testing.T) {
+	// wallet ID = person ID * 10, wallet 990 belongs to nobody
+	fnWalletPersonID := func(walletID uint64) (uint64, bool) {
+		if walletID == 990 {
+			return 0, false
+		}
+
+		return walletID / 10, true
+	}
+
+	fnSplit := func(amounts map[uint64]int) *model.BillSplit {
+		split := &model.BillSplit{Mode: model.SplitModeAmount}
+		for personID := uint64(1); personID <= 3; personID++ {
+			if amount, ok := amounts[personID]; ok {
+				split.Shares = append(split.Shares, model.SplitShare{PersonID: personID, Amount: amount})
+			}
+		}
+
+		return split
+	}
+
+	cases := []struct {
+		name     string
+		bills    []model.GroupBill
+		balances map[uint64]int
+	}{
+		{
+			name: "split bill",
+			bills: []model.GroupBill{
+				{FromSubWalletID: 10, Amount: 90, Split: fnSplit(map[uint64]int{1: 30, 2: 30, 3: 30})},
+			},
+			balances: map[uint64]int{1: 60, 2: -30, 3: -30},
+		},
+		{
+			name: "split bill in a foreign currency",
+			bills: []model.GroupBill{
+				{FromSubWalletID: 10, Amount: 100, BaseAmount: 700, Split: fnSplit(map[uint64]int{1: 50, 2: 50})},
+			},
+			balances: map[uint64]int{1: 350, 2: -350},
+		},
+		{
+			name: "settlement clears the debt",
+			bills: []model.GroupBill{
+				{FromSubWalletID: 10, Amount: 60, Split: fnSplit(map[uint64]int{1: 30, 2: 30})},
+				{FromSubWalletID: 20, ToSubWalletID: 10, Amount: 30, Settlement: true},
+			},
+			balances: map[uint64]int{},
+		},
+		{
+			name: "bills without split and unknown wallets are skipped",
+			bills: []model.GroupBill{
+				{FromSubWalletID: 10, Amount: 60},
+				{FromSubWalletID: 990, Amount: 60, Split: fnSplit(map[uint64]int{1: 30, 2: 30})},
+				{FromSubWalletID: 20, ToSubWalletID: 990, Amount: 30, Settlement: true},
+			},
+			balances: map[uint64]int{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.EqualValues(t, c.balances, settlementBalances(c.bills, fnWalletPersonID))
+		})
+	}
+}
+
+func TestSettlementTransfers(t *testing.T) {
+	cases := []struct {
+		name      string
+		balances  map[uint64]int
+		transfers []settlementTransfer
+	}{
+		{
+			name: "nothing to settle",
+		},
+		{
+			name:     "one debtor",
+			balances: map[uint64]int{1: 60, 2: -60},
+			transfers: []settlementTransfer{
+				{fromPersonID: 2, toPersonID: 1, amount: 60},
+			},
+		},
+		{
+			name:     "biggest debtor pays biggest creditor first",
+			balances: map[uint64]int{1: 70, 2: 30, 3: -80, 4: -20},
+			transfers: []settlementTransfer{
+				{fromPersonID: 3, toPersonID: 1, amount: 70},
+				{fromPersonID: 3, toPersonID: 2, amount: 10},
+				{fromPersonID: 4, toPersonID: 2, amount: 20},
+			},
+		},
+		{
+			name:     "ties ordered by person ID",
+			balances: map[uint64]int{1: -50, 2: -50, 3: 100},
+			transfers: []settlementTransfer{
+				{fromPersonID: 1, toPersonID: 3, amount: 50},
+				{fromPersonID: 2, toPersonID: 3, amount: 50},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			transfers := settlementTransfers(c.balances)
+			assert.EqualValues(t, c.transfers, transfers)
+			assert.LessOrEqual(t, len(transfers), len(c.balances))
+		})
+	}
+}
+
+func TestMinimalSettlementTransfers(t *testing.T) {
+	cases := []struct {
+		name          string
+		balances      map[uint64]int
+		transferCount int
+	}{
+		{
+			// greedy: 5 pays 20 to 2 and 10 to 3, 4 pays 10 to 3 and 10 to 1
+			name:          "a pair settles apart",
+			balances:      map[uint64]int{1: 10, 2: 20, 3: 20, 4: -20, 5: -30},
+			transferCount: 3,
+		},
+		{
+			name:          "pairs",
+			balances:      map[uint64]int{1: 10, 2: 20, 3: 30, 4: -30, 5: -20, 6: -10},
+			transferCount: 3,
+		},
+		{
+			name:          "no smaller group",
+			balances:      map[uint64]int{1: 70, 2: 30, 3: -80, 4: -20},
+			transferCount: 3,
+		},
+		{
+			name: "too many persons are settled greedily",
+			balances: map[uint64]int{1: 10, 2: 10, 3: 10, 4: 10, 5: 10, 6: 10, 7: 10, 8: 10, 9: 10,
+				11: -10, 12: -10, 13: -10, 14: -10, 15: -10, 16: -10, 17: -10, 18: -10, 19: -10},
+			transferCount: 9,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			transfers := settlementTransfers(c.balances)
+			assert.EqualValues(t, c.transferCount, len(transfers))
+
+			balances := make(map[uint64]int)
+			for personID, balance := range c.balances {
+				balances[personID] = balance
+			}
+
+			for _, transfer := range transfers {
+				assert.True(t, transfer.amount > 0)
+
+				balances[transfer.fromPersonID] += transfer.amount
+				balances[transfer.toPersonID] -= transfer.amount
+			}
+
+			for personID, balance := range balances {
+				assert.EqualValues(t, 0, balance, personID)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package server
+
+import (
+	"github.com/s-min-sys/lifecostbe/internal/storage"
+	"github.com/sgostarter/i/l"
+)
+
+func MigrateToSQLite(dbPath string, logger l.Wrapper) (billCount int, err error) {
+	return storage.MigrateToSQLite(dataRoot, dbPath, logger)
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sgostarter/libcomponents/statistic/memdate/ex"
+)
+
+// shiftMonths moves at by months, the day is clamped to the last day of the target month.
+func shiftMonths(at time.Time, months int) time.Time {
+	monthFirstDay := time.Date(at.Year(), at.Month(), 1, at.Hour(), at.Minute(), at.Second(), 0,
+		at.Location()).AddDate(0, months, 0)
+
+	day := at.Day()
+	if lastDay := monthFirstDay.AddDate(0, 1, -1).Day(); day > lastDay {
+		day = lastDay
+	}
+
+	return monthFirstDay.AddDate(0, 0, day-1)
+}
+
+func statisticsDelta(current, compared Statistics) StatisticsDelta {
+	delta := StatisticsDelta{
+		IncomingCount:  current.IncomingCount - compared.IncomingCount,
+		OutgoingCount:  current.OutgoingCount - compared.OutgoingCount,
+		IncomingAmount: current.IncomingAmount - compared.IncomingAmount,
+		OutgoingAmount: current.OutgoingAmount - compared.OutgoingAmount,
+	}
+
+	delta.IncomingCountPercent = breakdownPercent(delta.IncomingCount, compared.IncomingCount)
+	delta.OutgoingCountPercent = breakdownPercent(delta.OutgoingCount, compared.OutgoingCount)
+	delta.IncomingAmountPercent = breakdownPercent(delta.IncomingAmount, compared.IncomingAmount)
+	delta.OutgoingAmountPercent = breakdownPercent(delta.OutgoingAmount, compared.OutgoingAmount)
+
+	return delta
+}
+
+// compareStatistics compares the period containing at with the period containing lastYearAt and previousAt.
+func compareStatistics(fnGet func(key string, at time.Time) (ex.LifeCostTotalData, bool), key string,
+	at, lastYearAt, previousAt time.Time) (comparison StatisticsComparison) {
+	fnStatistics := func(t time.Time) Statistics {
+		totalD, exists := fnGet(key, t)
+		if !exists {
+			return Statistics{}
+		}
+
+		return totalD2Statistics(totalD)
+	}
+
+	comparison.Current = fnStatistics(at)
+	comparison.LastYear = fnStatistics(lastYearAt)
+	comparison.Previous = fnStatistics(previousAt)
+	comparison.LastYearDelta = statisticsDelta(comparison.Current, comparison.LastYear)
+	comparison.PreviousDelta = statisticsDelta(comparison.Current, comparison.Previous)
+
+	return
+}
+
+func (s *Server) compare(key string, at time.Time) (resp CompareStatisticsResponse) {
+	resp.At = at.Unix()
+
+	lastYearAt := shiftMonths(at, -12)
+
+	resp.Day = compareStatistics(s.stat.GetDayOn, key, at, lastYearAt, at.AddDate(0, 0, -1))
+	// 52 weeks back keeps the week day
+	resp.Week = compareStatistics(s.stat.GetWeekOn, key, at, at.AddDate(0, 0, -364), at.AddDate(0, 0, -7))
+	resp.Month = compareStatistics(s.stat.GetMonthOn, key, at, lastYearAt, shiftMonths(at, -1))
+	resp.Season = compareStatistics(s.stat.GetSeasonOn, key, at, lastYearAt, shiftMonths(at, -3))
+	resp.Year = compareStatistics(s.stat.GetYearOn, key, at, lastYearAt, lastYearAt)
+
+	return
+}
+
+func (s *Server) handleStatisticsCompare(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	resp, code, msg := s.handleStatisticsCompareInner(c)
+	if code == CodeSuccess {
+		respWrapper.Resp = resp
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleStatisticsCompareInner(c *gin.Context) (resp CompareStatisticsResponse, code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	var req CompareStatisticsRequest
+
+	err := c.BindJSON(&req)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	if !req.Valid() {
+		code = CodeInvalidArgs
+
+		return
+	}
+
+	groupID, ok := s.getGroupID4Person(uid, req.GroupID)
+	if !ok {
+		code = CodeInvalidArgs
+		msg = "非法的组ID"
+
+		return
+	}
+
+	key := billStatKey(groupID, groupID)
+	if req.DHasLabel {
+		key = billStatKey(groupID, req.DLabelID)
+	}
+
+	resp = s.compare(key, time.Unix(req.At, 0))
+
+	return
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShiftMonths(t *testing.T) {
+	cases := []struct {
+		name     string
+		at       time.Time
+		months   int
+		expected time.Time
+	}{
+		{"leap day to last year", time.Date(2024, 2, 29, 12, 0, 0, 0, time.Local), -12,
+			time.Date(2023, 2, 28, 12, 0, 0, 0, time.Local)},
+		{"leap day to the previous month", time.Date(2024, 2, 29, 12, 0, 0, 0, time.Local), -1,
+			time.Date(2024, 1, 29, 12, 0, 0, 0, time.Local)},
+		{"to the leap day", time.Date(2024, 3, 31, 12, 0, 0, 0, time.Local), -1,
+			time.Date(2024, 2, 29, 12, 0, 0, 0, time.Local)},
+		{"last year of the day after the leap year", time.Date(2025, 2, 28, 12, 0, 0, 0, time.Local), -12,
+			time.Date(2024, 2, 28, 12, 0, 0, 0, time.Local)},
+		{"the previous season", time.Date(2024, 5, 31, 12, 0, 0, 0, time.Local), -3,
+			time.Date(2024, 2, 29, 12, 0, 0, 0, time.Local)},
+		{"across the year", time.Date(2024, 1, 31, 12, 0, 0, 0, time.Local), -1,
+			time.Date(2023, 12, 31, 12, 0, 0, 0, time.Local)},
+		{"forward", time.Date(2023, 1, 31, 12, 0, 0, 0, time.Local), 1,
+			time.Date(2023, 2, 28, 12, 0, 0, 0, time.Local)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.True(t, c.expected.Equal(shiftMonths(c.at, c.months)), shiftMonths(c.at, c.months))
+		})
+	}
+}
+
+func TestStatisticsDelta(t *testing.T) {
+	cases := []struct {
+		name     string
+		current  Statistics
+		compared Statistics
+		expected StatisticsDelta
+	}{
+		{
+			name:     "more",
+			current:  Statistics{OutgoingCount: 3, OutgoingAmount: 150},
+			compared: Statistics{OutgoingCount: 2, OutgoingAmount: 100},
+			expected: StatisticsDelta{OutgoingCount: 1, OutgoingAmount: 50, OutgoingCountPercent: 50,
+				OutgoingAmountPercent: 50},
+		},
+		{
+			name:     "less",
+			current:  Statistics{IncomingCount: 1, IncomingAmount: 20},
+			compared: Statistics{IncomingCount: 3, IncomingAmount: 30},
+			expected: StatisticsDelta{IncomingCount: -2, IncomingAmount: -10, IncomingCountPercent: -66.67,
+				IncomingAmountPercent: -33.33},
+		},
+		{
+			name:     "nothing to compare with",
+			current:  Statistics{OutgoingCount: 1, OutgoingAmount: 100},
+			compared: Statistics{},
+			expected: StatisticsDelta{OutgoingCount: 1, OutgoingAmount: 100},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.EqualValues(t, c.expected, statisticsDelta(c.current, c.compared))
+		})
+	}
+}
+
+func TestCompareStatistics(t *testing.T) {
+	s := utNewServer(t, "compare-statistics")
+
+	zjzID, zjzWalletID, err := s.storage.NewPersonEx("zjz", 1001)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := s.storage.NewPerson("shop")
+	assert.Nil(t, err)
+
+	groupID, err := s.storage.NewGroup("home", zjzID)
+	assert.Nil(t, err)
+
+	fnRecord := func(amount int, at int64) {
+		utRecord(t, s, groupID, model.GroupBill{
+			FromSubWalletID: zjzWalletID,
+			ToSubWalletID:   shopWalletID,
+			CostDir:         model.CostDirOut,
+			Amount:          amount,
+			At:              at,
+		})
+	}
+
+	fnRecord(50, utAt(2023, 2, 28, 12))
+	fnRecord(20, utAt(2024, 1, 31, 12))
+	fnRecord(80, utAt(2024, 2, 28, 12))
+	fnRecord(100, utAt(2024, 2, 29, 12))
+
+	out := func(count, amount int) Statistics {
+		return Statistics{OutgoingCount: count, OutgoingAmount: amount}
+	}
+
+	day := func(resp CompareStatisticsResponse) StatisticsComparison { return resp.Day }
+	week := func(resp CompareStatisticsResponse) StatisticsComparison { return resp.Week }
+	month := func(resp CompareStatisticsResponse) StatisticsComparison { return resp.Month }
+	year := func(resp CompareStatisticsResponse) StatisticsComparison { return resp.Year }
+
+	cases := []struct {
+		name     string
+		at       int64
+		period   func(resp CompareStatisticsResponse) StatisticsComparison
+		current  Statistics
+		lastYear Statistics
+		previous Statistics
+		// the outgoing amount percents of the deltas
+		lastYearPercent float64
+		previousPercent float64
+	}{
+		{"leap day, last year is Feb 28", utAt(2024, 2, 29, 8), day, out(1, 100), out(1, 50), out(1, 80), 100, 25},
+		{"day after the leap year", utAt(2025, 2, 28, 8), day, out(0, 0), out(1, 80), out(0, 0), -100, 0},
+		{"no prior day", utAt(2023, 2, 28, 8), day, out(1, 50), out(0, 0), out(0, 0), 0, 0},
+		// the weeks are within a month, 52 weeks back is the first week of March
+		{"week of the leap day", utAt(2024, 2, 29, 8), week, out(2, 180), out(0, 0), out(0, 0), 0, 0},
+		{"month of the leap day", utAt(2024, 2, 29, 8), month, out(2, 180), out(1, 50), out(1, 20), 260, 800},
+		{"no prior month", utAt(2023, 2, 1, 8), month, out(1, 50), out(0, 0), out(0, 0), 0, 0},
+		{"year of the leap day", utAt(2024, 2, 29, 8), year, out(3, 200), out(1, 50), out(1, 50), 300, 300},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			comparison := c.period(s.compare(billStatKey(groupID, groupID), time.Unix(c.at, 0)))
+			assert.EqualValues(t, c.current, comparison.Current)
+			assert.EqualValues(t, c.lastYear, comparison.LastYear)
+			assert.EqualValues(t, c.previous, comparison.Previous)
+			assert.EqualValues(t, c.current.OutgoingAmount-c.lastYear.OutgoingAmount,
+				comparison.LastYearDelta.OutgoingAmount)
+			assert.EqualValues(t, c.current.OutgoingAmount-c.previous.OutgoingAmount,
+				comparison.PreviousDelta.OutgoingAmount)
+			assert.EqualValues(t, c.lastYearPercent, comparison.LastYearDelta.OutgoingAmountPercent)
+			assert.EqualValues(t, c.previousPercent, comparison.PreviousDelta.OutgoingAmountPercent)
+		})
+	}
+}
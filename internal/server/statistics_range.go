@@ -0,0 +1,193 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/libcomponents/statistic/memdate/ex"
+)
+
+// rangeStatKey returns the statistics key holding the bills of the request, empty if no key holds them.
+func rangeStatKey(groupID uint64, req RangeStatisticsRequest) string {
+	switch {
+	case req.DHasLabel && req.DWalletID != 0:
+		return ""
+	case req.DHasLabel:
+		return billStatKey(groupID, req.DLabelID)
+	case req.DWalletID != 0:
+		return billWalletStatKey(groupID, req.DWalletID)
+	}
+
+	return billStatKey(groupID, groupID)
+}
+
+// rangeStatistics returns the statistics of the bills of the request. Without a statistics key for the
+// filters all the bills of the range are scanned.
+func (s *Server) rangeStatistics(groupID uint64, req RangeStatisticsRequest) (statistics Statistics, err error) {
+	key := rangeStatKey(groupID, req)
+	if key == "" {
+		var totalD ex.LifeCostTotalData
+
+		err = s.scanRange(groupID, req.StartAt, req.FinishAt, func(bill model.GroupBill) {
+			if req.Match(bill) {
+				totalD = *ex.LifeCostDataTrans{}.Combine(&totalD, bill2LifeCostData4Add(bill))
+			}
+		})
+		statistics = totalD2Statistics(totalD)
+
+		return
+	}
+
+	totals, err := s.rangeTotals(groupID, []string{key}, req.StartAt, req.FinishAt,
+		func(bill model.GroupBill) []string {
+			if !req.Match(bill) {
+				return nil
+			}
+
+			return []string{key}
+		})
+	if err != nil {
+		return
+	}
+
+	statistics = totalD2Statistics(totals[key])
+
+	return
+}
+
+// rangeTotals sums the day statistics of the keys over the whole days in the range, the bills of the partial
+// days are scanned once and added to the keys of fnBillKeys, the ones to sum.
+func (s *Server) rangeTotals(groupID uint64, keys []string, startAt, finishAt int64,
+	fnBillKeys func(bill model.GroupBill) []string) (totals map[string]ex.LifeCostTotalData, err error) {
+	totals = make(map[string]ex.LifeCostTotalData, len(keys))
+	for _, key := range keys {
+		totals[key] = ex.LifeCostTotalData{}
+	}
+
+	fnAdd := func(bill model.GroupBill) {
+		for _, key := range fnBillKeys(bill) {
+			if totalD, ok := totals[key]; ok {
+				totals[key] = *ex.LifeCostDataTrans{}.Combine(&totalD, bill2LifeCostData4Add(bill))
+			}
+		}
+	}
+
+	start := time.Unix(startAt, 0)
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+
+	for ; day.Unix() <= finishAt; day = day.AddDate(0, 0, 1) {
+		dayStartAt, dayFinishAt := day.Unix(), day.AddDate(0, 0, 1).Unix()-1
+
+		if dayStartAt >= startAt && dayFinishAt <= finishAt {
+			for key, totalD := range totals {
+				dayD, exists := s.stat.GetDayOn(key, day)
+				if !exists {
+					continue
+				}
+
+				totalD.EarnCount += dayD.EarnCount
+				totalD.EarnAmount += dayD.EarnAmount
+				totalD.ConsumeCount += dayD.ConsumeCount
+				totalD.ConsumeAmount += dayD.ConsumeAmount
+				totals[key] = totalD
+			}
+
+			continue
+		}
+
+		if dayStartAt < startAt {
+			dayStartAt = startAt
+		}
+
+		if dayFinishAt > finishAt {
+			dayFinishAt = finishAt
+		}
+
+		if err = s.scanRange(groupID, dayStartAt, dayFinishAt, fnAdd); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (s *Server) scanRange(groupID uint64, startAt, finishAt int64, fn func(bill model.GroupBill)) error {
+	bills, err := s.getBillsBetween(groupID, startAt, finishAt)
+	if err != nil {
+		return err
+	}
+
+	for _, bill := range bills {
+		fn(bill)
+	}
+
+	return nil
+}
+
+func (s *Server) handleStatisticsRange(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	resp, code, msg := s.handleStatisticsRangeInner(c)
+	if code == CodeSuccess {
+		respWrapper.Resp = resp
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleStatisticsRangeInner(c *gin.Context) (resp RangeStatisticsResponse, code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	var req RangeStatisticsRequest
+
+	err := c.BindJSON(&req)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	if !req.Valid() {
+		code = CodeInvalidArgs
+
+		return
+	}
+
+	groupID, ok := s.getGroupID4Person(uid, req.GroupID)
+	if !ok {
+		code = CodeInvalidArgs
+		msg = "非法的组ID"
+
+		return
+	}
+
+	if req.DWalletID != 0 {
+		if _, err = s.storage.GetWallet(req.DWalletID); err != nil {
+			code = CodeInvalidArgs
+			msg = err.Error()
+
+			return
+		}
+	}
+
+	resp.StartAt = req.StartAt
+	resp.FinishAt = req.FinishAt
+
+	resp.Statistics, err = s.rangeStatistics(groupID, req)
+	if err != nil {
+		code = CodeInternalError
+		msg = err.Error()
+
+		return
+	}
+
+	return
+}
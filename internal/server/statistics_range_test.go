@@ -0,0 +1,114 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRangeStatistics(t *testing.T) {
+	s := utNewServer(t, "range-statistics")
+
+	zjzID, zjzWalletID, err := s.storage.NewPersonEx("zjz", 1001)
+	assert.Nil(t, err)
+
+	zymID, zymWalletID, err := s.storage.NewPersonEx("zym", 1002)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := s.storage.NewPerson("shop")
+	assert.Nil(t, err)
+
+	groupID, err := s.storage.NewGroup("home", zjzID)
+	assert.Nil(t, err)
+	assert.Nil(t, s.storage.JoinGroup(groupID, zymID))
+
+	foodLabelID, err := s.storage.NewLabel("ut-food")
+	assert.Nil(t, err)
+
+	startAt := utAt(2024, 3, 10, 12)
+	finishAt := utAt(2024, 3, 12, 12)
+
+	fnRecord := func(from uint64, amount int, at int64, labelIDs ...uint64) {
+		utRecord(t, s, groupID, model.GroupBill{
+			FromSubWalletID: from,
+			ToSubWalletID:   shopWalletID,
+			CostDir:         model.CostDirOut,
+			Amount:          amount,
+			LabelIDs:        labelIDs,
+			At:              at,
+		})
+	}
+
+	// the amounts are powers of 2, so each sum tells the bills in it
+	fnRecord(zjzWalletID, 1, startAt-1)
+	fnRecord(zymWalletID, 2, startAt)
+	fnRecord(zjzWalletID, 4, utAt(2024, 3, 11, 8), foodLabelID)
+	fnRecord(zjzWalletID, 8, finishAt)
+	fnRecord(zjzWalletID, 16, finishAt+1)
+
+	dayStartAt := utAt(2024, 3, 11, 0)
+	dayFinishAt := utAt(2024, 3, 12, 0) - 1
+
+	cases := []struct {
+		name     string
+		req      RangeStatisticsRequest
+		count    int
+		amount   int
+		validReq bool
+	}{
+		{"both bounds are inclusive", RangeStatisticsRequest{StartAt: startAt, FinishAt: finishAt}, 3, 14, true},
+		{"one second", RangeStatisticsRequest{StartAt: startAt, FinishAt: startAt}, 1, 2, true},
+		{"ends before the start bill", RangeStatisticsRequest{StartAt: startAt - 3600, FinishAt: startAt - 1}, 1, 1, true},
+		{"starts after the finish bill", RangeStatisticsRequest{StartAt: finishAt + 1, FinishAt: finishAt + 3600}, 1, 16,
+			true},
+		{"a whole day", RangeStatisticsRequest{StartAt: dayStartAt, FinishAt: dayFinishAt}, 1, 4, true},
+		{"a whole day and a second", RangeStatisticsRequest{StartAt: dayStartAt, FinishAt: dayFinishAt + 1}, 1, 4, true},
+		{"a second before a whole day", RangeStatisticsRequest{StartAt: dayStartAt - 1, FinishAt: dayFinishAt}, 1, 4,
+			true},
+		{"label", RangeStatisticsRequest{StartAt: startAt, FinishAt: finishAt, LabelID: idN2S(foodLabelID)}, 1, 4, true},
+		{"no label", RangeStatisticsRequest{StartAt: startAt, FinishAt: finishAt, LabelID: "0"}, 2, 10, true},
+		{"wallet", RangeStatisticsRequest{StartAt: startAt, FinishAt: finishAt, WalletID: idN2S(zymWalletID)}, 1, 2,
+			true},
+		{"wallet and label", RangeStatisticsRequest{StartAt: startAt, FinishAt: finishAt, WalletID: idN2S(zjzWalletID),
+			LabelID: "0"}, 1, 8, true},
+		{"finish before start", RangeStatisticsRequest{StartAt: finishAt, FinishAt: startAt}, 0, 0, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := c.req
+			if !c.validReq {
+				assert.False(t, req.Valid())
+
+				return
+			}
+
+			assert.True(t, req.Valid())
+
+			statistics, e := s.rangeStatistics(groupID, req)
+			assert.Nil(t, e)
+			assert.EqualValues(t, Statistics{OutgoingCount: c.count, OutgoingAmount: c.amount}, statistics)
+
+			// the same bills as scanning the range
+			bills, e := s.getBillsBetween(groupID, req.StartAt, req.FinishAt)
+			assert.Nil(t, e)
+
+			var amount int
+
+			for _, bill := range bills {
+				if req.Match(bill) {
+					amount += bill.Amount
+				}
+			}
+
+			assert.EqualValues(t, c.amount, amount)
+		})
+	}
+
+	// the day statistics key holds the whole days
+	dayD, exists := s.stat.GetDayOn(billStatKey(groupID, groupID), time.Unix(dayStartAt, 0))
+	assert.True(t, exists)
+	assert.EqualValues(t, 4, dayD.ConsumeAmount)
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sgostarter/i/l"
+)
+
+const (
+	trashRetentionCheckInterval = time.Hour
+)
+
+func (s *Server) trashRetentionRoutine(ctx context.Context, _ func() bool) {
+	logger := s.logger.WithFields(l.StringField(l.RoutineKey, "trashRetentionRoutine"))
+
+	logger.Debug("enter")
+
+	defer logger.Debug("leave")
+
+	retention := s.cfg.DeletedRecordRetention()
+	if retention <= 0 {
+		logger.Info("deleted records are kept forever")
+
+		return
+	}
+
+	s.purgeExpiredDeletedRecords(logger, retention)
+
+	ticker := time.NewTicker(trashRetentionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.purgeExpiredDeletedRecords(logger, retention)
+		}
+	}
+}
+
+func (s *Server) purgeExpiredDeletedRecords(logger l.Wrapper, retention time.Duration) {
+	groupIDs, err := s.storage.GetGroupIDs()
+	if err != nil {
+		logger.WithFields(l.ErrorField(err)).Error("get group ids failed")
+
+		return
+	}
+
+	deletedBefore := time.Now().Add(-retention)
+
+	for _, groupID := range groupIDs {
+		count, err := s.storage.PurgeDeletedBills(groupID, deletedBefore)
+		if err != nil {
+			logger.WithFields(l.ErrorField(err), l.UInt64Field("groupID", groupID)).Error("purge deleted records failed")
+
+			continue
+		}
+
+		if count > 0 {
+			logger.WithFields(l.UInt64Field("groupID", groupID), l.IntField("count", count)).Info("purged deleted records")
+		}
+	}
+}
+
+func (s *Server) handleRemoveDeleteRecords(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	count, code, msg := s.handleDeleteRecordsBatchInner(c, s.cleanDeletedRecords)
+	if code == CodeSuccess {
+		respWrapper.Resp = DeletedRecordsCountResponse{
+			Count: count,
+		}
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleRestoreDeleteRecords(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	count, code, msg := s.handleDeleteRecordsBatchInner(c, s.restoreDeletedRecords)
+	if code == CodeSuccess {
+		respWrapper.Resp = DeletedRecordsCountResponse{
+			Count: count,
+		}
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleDeleteRecordsBatchInner(c *gin.Context,
+	fnDo func(uid uint64, recordIDs []string) (int, Code, string)) (count int, code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	var req DeletedRecordsRequest
+
+	err := c.BindJSON(&req)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	if !req.Valid() {
+		code = CodeMissArgs
+
+		return
+	}
+
+	return fnDo(uid, req.RecordIDs)
+}
+
+func (s *Server) handleEmptyTrash(c *gin.Context) {
+	respWrapper := &ResponseWrapper{}
+
+	count, code, msg := s.handleEmptyTrashInner(c)
+	if code == CodeSuccess {
+		respWrapper.Resp = DeletedRecordsCountResponse{
+			Count: count,
+		}
+	}
+
+	respWrapper.Apply(code, msg)
+
+	c.JSON(http.StatusOK, respWrapper)
+}
+
+func (s *Server) handleEmptyTrashInner(c *gin.Context) (count int, code Code, msg string) {
+	_, uid, _, code, msg := s.getAndCheckToken(c)
+	if code != CodeSuccess {
+		return
+	}
+
+	var req EmptyTrashRequest
+
+	err := c.BindJSON(&req)
+	if err != nil {
+		code = CodeProtocol
+		msg = err.Error()
+
+		return
+	}
+
+	var groupIDs []uint64
+
+	if req.GroupID != "" {
+		groupID, ok := s.getGroupID4Person(uid, req.GroupID)
+		if !ok {
+			code = CodeInvalidArgs
+			msg = "非法的组ID"
+
+			return
+		}
+
+		groupIDs = []uint64{groupID}
+	} else {
+		groupIDs, err = s.storage.GetPersonGroupsIDs(uid)
+		if err != nil {
+			code = CodeInternalError
+			msg = err.Error()
+
+			return
+		}
+	}
+
+	timeNow := time.Now()
+
+	for _, groupID := range groupIDs {
+		n, e := s.storage.PurgeDeletedBills(groupID, timeNow)
+		if e != nil {
+			s.logger.WithFields(l.ErrorField(e), l.UInt64Field("groupID", groupID)).Error("empty trash failed")
+
+			code = CodeInternalError
+			msg = e.Error()
+
+			return
+		}
+
+		count += n
+	}
+
+	code = CodeSuccess
+
+	return
+}
@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/pathutils"
+	"golang.org/x/exp/slices"
+)
+
+/*
+attachments are content addressed: attachments/<sha256>
+Organization.AttachmentRefs counts the bills (live or deleted, of every group) referencing an attachment,
+the file is removed once the count drops to zero and no upload holds it.
+*/
+
+func (impl *storageImpl) attachmentFilePath(attachmentID string) string {
+	return filepath.Join(impl.attachmentsRoot, attachmentID)
+}
+
+func (impl *storageImpl) validAttachmentID(attachmentID string) bool {
+	d, err := hex.DecodeString(attachmentID)
+
+	return err == nil && len(d) == sha256.Size
+}
+
+// SaveAttachment saves the file and holds a reference of it for the caller, released by ReleaseAttachment
+// once the attachment is added to the bills.
+func (impl *storageImpl) SaveAttachment(name, contentType string, d []byte) (attachment model.Attachment, err error) {
+	if len(d) == 0 {
+		err = commerr.ErrInvalidArgument
+
+		return
+	}
+
+	sum := sha256.Sum256(d)
+
+	attachment = model.Attachment{
+		ID:          hex.EncodeToString(sum[:]),
+		Name:        name,
+		ContentType: contentType,
+		Size:        int64(len(d)),
+	}
+
+	impl.attachmentsLock.Lock()
+	defer impl.attachmentsLock.Unlock()
+
+	filePath := impl.attachmentFilePath(attachment.ID)
+
+	if exists, _ := pathutils.IsFileExists(filePath); !exists {
+		_ = pathutils.MustDirOfFileExists(filePath)
+
+		tmpFilePath := filePath + ".tmp"
+
+		err = os.WriteFile(tmpFilePath, d, 0600)
+		if err != nil {
+			return
+		}
+
+		err = os.Rename(tmpFilePath, filePath)
+		if err != nil {
+			return
+		}
+	}
+
+	if impl.pendingAttachments == nil {
+		impl.pendingAttachments = make(map[string]int)
+	}
+
+	impl.pendingAttachments[attachment.ID]++
+
+	return
+}
+
+// ReleaseAttachment drops the reference held by SaveAttachment, the file is removed if no bill references it.
+func (impl *storageImpl) ReleaseAttachment(attachmentID string) {
+	impl.attachmentsLock.Lock()
+	defer impl.attachmentsLock.Unlock()
+
+	if impl.pendingAttachments[attachmentID] <= 0 {
+		return
+	}
+
+	impl.pendingAttachments[attachmentID]--
+
+	if impl.pendingAttachments[attachmentID] > 0 {
+		return
+	}
+
+	delete(impl.pendingAttachments, attachmentID)
+
+	var referenced bool
+
+	impl.organization.Read(func(org *Organization) {
+		referenced = org.AttachmentRefs[attachmentID] > 0
+	})
+
+	if !referenced {
+		impl.removeAttachmentFile(attachmentID)
+	}
+}
+
+func (impl *storageImpl) ReadAttachment(attachmentID string) (d []byte, err error) {
+	if !impl.validAttachmentID(attachmentID) {
+		err = commerr.ErrInvalidArgument
+
+		return
+	}
+
+	d, err = os.ReadFile(impl.attachmentFilePath(attachmentID))
+	if os.IsNotExist(err) {
+		err = commerr.ErrNotFound
+	}
+
+	return
+}
+
+func (impl *storageImpl) AddBillAttachment(groupID uint64, billID string, attachment model.Attachment) (err error) {
+	if !impl.validAttachmentID(attachment.ID) {
+		return commerr.ErrInvalidArgument
+	}
+
+	impl.billWritersLock.RLock()
+	defer impl.billWritersLock.RUnlock()
+
+	// counted before the bill references it, the file can't be removed in between
+	err = impl.referenceAttachment(attachment.ID)
+	if err != nil {
+		return
+	}
+
+	err = impl.getGroupBills(groupID).ModifyBill(billID, func(bill *model.GroupBill) error {
+		if slices.ContainsFunc(bill.Attachments, func(a model.Attachment) bool {
+			return a.ID == attachment.ID
+		}) {
+			return commerr.ErrAlreadyExists
+		}
+
+		bill.Attachments = append(bill.Attachments, attachment)
+
+		return nil
+	})
+	if err != nil {
+		impl.releaseAttachments([]model.Attachment{attachment})
+	}
+
+	return
+}
+
+func (impl *storageImpl) referenceAttachment(attachmentID string) error {
+	impl.attachmentsLock.Lock()
+	defer impl.attachmentsLock.Unlock()
+
+	if exists, _ := pathutils.IsFileExists(impl.attachmentFilePath(attachmentID)); !exists {
+		return commerr.ErrNotFound
+	}
+
+	return impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
+		newOrg = org
+
+		newOrg.AttachmentRefs[attachmentID]++
+
+		return
+	})
+}
+
+func (impl *storageImpl) RemoveBillAttachment(groupID uint64, billID string, attachmentID string) (err error) {
+	impl.billWritersLock.RLock()
+	defer impl.billWritersLock.RUnlock()
+
+	var attachment model.Attachment
+
+	err = impl.getGroupBills(groupID).ModifyBill(billID, func(bill *model.GroupBill) error {
+		idx := slices.IndexFunc(bill.Attachments, func(a model.Attachment) bool {
+			return a.ID == attachmentID
+		})
+		if idx < 0 {
+			return commerr.ErrNotFound
+		}
+
+		attachment = bill.Attachments[idx]
+
+		bill.Attachments = slices.Delete(bill.Attachments, idx, idx+1)
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	impl.releaseAttachments([]model.Attachment{attachment})
+
+	return
+}
+
+// HasBillAttachment reports whether the bill of the group, live or deleted, references the attachment.
+func (impl *storageImpl) HasBillAttachment(groupID uint64, billID, attachmentID string) (ok bool, err error) {
+	billFile := impl.getGroupBills(groupID)
+
+	bill, err := billFile.GetBill(billID)
+	if errors.Is(err, commerr.ErrNotFound) {
+		var deletedBill model.DeletedGroupBill
+
+		deletedBill, err = billFile.GetDeletedBill(billID)
+		bill = deletedBill.GroupBill
+	}
+
+	if errors.Is(err, commerr.ErrNotFound) || errors.Is(err, commerr.ErrInvalidArgument) {
+		err = nil
+
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	ok = slices.ContainsFunc(bill.Attachments, func(a model.Attachment) bool {
+		return a.ID == attachmentID
+	})
+
+	return
+}
+
+// releaseAttachments drops one reference of each attachment and removes the files nobody references.
+func (impl *storageImpl) releaseAttachments(attachments []model.Attachment) {
+	if len(attachments) == 0 {
+		return
+	}
+
+	impl.attachmentsLock.Lock()
+	defer impl.attachmentsLock.Unlock()
+
+	var orphanIDs []string
+
+	err := impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
+		newOrg = org
+
+		for _, attachment := range attachments {
+			newOrg.AttachmentRefs[attachment.ID]--
+
+			if newOrg.AttachmentRefs[attachment.ID] <= 0 {
+				delete(newOrg.AttachmentRefs, attachment.ID)
+
+				orphanIDs = append(orphanIDs, attachment.ID)
+			}
+		}
+
+		return
+	})
+	if err != nil {
+		impl.logger.WithFields(l.ErrorField(err)).Error("release attachments failed")
+
+		return
+	}
+
+	for _, attachmentID := range orphanIDs {
+		// still held by an upload
+		if impl.pendingAttachments[attachmentID] > 0 {
+			continue
+		}
+
+		impl.removeAttachmentFile(attachmentID)
+	}
+}
+
+func (impl *storageImpl) removeAttachmentFile(attachmentID string) {
+	if e := os.Remove(impl.attachmentFilePath(attachmentID)); e != nil && !os.IsNotExist(e) {
+		impl.logger.WithFields(l.ErrorField(e), l.StringField("attachmentID", attachmentID)).
+			Error("remove attachment file failed")
+	}
+}
@@ -1,17 +1,15 @@
 package storage
 
 import (
-	"bufio"
 	"encoding/json"
-	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/godruoyi/go-snowflake"
 	"github.com/s-min-sys/lifecostbe/internal/model"
 	"github.com/sgostarter/i/commerr"
 	"github.com/sgostarter/i/l"
@@ -24,19 +22,32 @@ const (
 )
 
 type BillFile interface {
-	AddBill(bill model.GroupBill) error
+	AddBill(bill model.GroupBill) (billID string, err error)
+	RemoveBill(billID string) (err error)
 	GetBill(billID string) (bill model.GroupBill, err error)
+	// UpdateBill replaces the bill, its attachments, operation person and settlement mark are kept from the
+	// stored bill.
+	UpdateBill(bill model.GroupBill) (oldBill model.GroupBill, err error)
+	// ModifyBill changes the bill in place under the lock of its day file, fnModify must keep its ID and At.
+	ModifyBill(billID string, fnModify func(bill *model.GroupBill) error) (err error)
 	GetBills(startDate, finishDate string) ([]model.GroupBill, error)
 	ListBills(id string, count int, dirNew bool) (bills []model.GroupBill, hasMore bool, err error)
 
-	DeleteRecord(billID string) (err error)
+	DeleteRecord(billID string, deletedBy uint64) (err error)
+	AddDeletedBill(bill model.DeletedGroupBill) (billID string, err error)
 	GetDeletedBill(billID string) (bill model.DeletedGroupBill, err error)
 	GetDeletedBills() ([]model.DeletedGroupBill, error)
 	RemoveDeletedBillHistory(billID string) error
 	RestoreDeletedBill(billID string) error
+	PurgeDeletedBills(deletedBefore time.Time) (bills []model.DeletedGroupBill, err error)
 }
 
 func NewBillFile(groupID uint64, dir string, base string, logger l.Wrapper) BillFile {
+	return newBillFile(groupID, dir, base, newFileHandles(defaultMaxOpenBillFiles, billFileIdleTimeout), nil, logger)
+}
+
+func newBillFile(groupID uint64, dir string, base string, handles *fileHandles, crypter *Crypter,
+	logger l.Wrapper) BillFile {
 	if logger == nil {
 		logger = l.NewNopLoggerWrapper()
 	}
@@ -46,6 +57,8 @@ func NewBillFile(groupID uint64, dir string, base string, logger l.Wrapper) Bill
 		dir:          dir,
 		base:         base,
 		logger:       logger.WithFields(l.StringField(l.ClsKey, "billFileImpl")),
+		handles:      handles,
+		crypter:      crypter,
 		files:        make(map[string]*streamFile),
 		deletedBills: make(map[uint64]map[string]model.DeletedGroupBill),
 	}
@@ -53,11 +66,13 @@ func NewBillFile(groupID uint64, dir string, base string, logger l.Wrapper) Bill
 
 type streamFile struct {
 	lock           sync.Mutex
-	file           *os.File
+	handles        *fileHandles
+	file           *os.File // nil: closed, reopened by ensureOpen
 	key            string
 	filePath       string
 	latestRecordAt time.Time
-	lastAccessAt   time.Time
+	lastAccessAt   time.Time // guarded by handles.lock
+	size           int64
 }
 
 type billFileImpl struct {
@@ -67,12 +82,30 @@ type billFileImpl struct {
 	base    string
 	logger  l.Wrapper
 
-	files map[string]*streamFile
+	handles *fileHandles
+	crypter *Crypter
+	files   map[string]*streamFile
+	index   billIndex
+
+	// moveLock is held by moveBill and shared by ModifyBill, no bill changes while it moves between day files
+	moveLock sync.RWMutex
 
 	deletedBillsLock sync.Mutex
 	deletedBills     map[uint64]map[string]model.DeletedGroupBill
 }
 
+func compareBillAt(a, b model.GroupBill) int {
+	if a.At == b.At {
+		return 0
+	}
+
+	if a.At < b.At {
+		return -1
+	}
+
+	return 1
+}
+
 func (impl *billFileImpl) getFileKey(at time.Time) string {
 	return at.Format("20060102")
 }
@@ -96,8 +129,6 @@ func (impl *billFileImpl) getFileByKey(key string) (file *streamFile, err error)
 
 	file, ok := impl.files[key]
 	if ok {
-		file.lastAccessAt = time.Now()
-
 		return
 	}
 
@@ -105,39 +136,48 @@ func (impl *billFileImpl) getFileByKey(key string) (file *streamFile, err error)
 
 	_ = pathutils.MustDirOfFileExists(filePath)
 
-	bills, _ := impl.readFileBills(filePath)
-
-	latestRecordAt := time.Now()
+	bills, badLines, complete, err := scanBillFile(filePath, impl.crypter)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
 
-	_ = os.RemoveAll(filePath)
+	err = nil
 
-	rawFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
-	if err != nil {
-		return
+	file = &streamFile{
+		handles:  impl.handles,
+		key:      key,
+		filePath: filePath,
 	}
 
-	if len(bills) > 0 {
-		slices.SortFunc(bills, func(a, b model.GroupBill) int {
-			if a.At == b.At {
-				return 0
-			}
+	// only rewrite the file if its bills are out of order or it has bad lines, appending keeps them sorted
+	if !complete || len(badLines) > 0 || !slices.IsSortedFunc(bills, compareBillAt) {
+		logBadBillLines(impl.logger, filePath, badLines)
 
-			if a.At < b.At {
-				return -1
-			}
+		slices.SortStableFunc(bills, compareBillAt)
 
-			return 1
-		})
+		var offsets map[string]int64
 
-		latestRecordAt, err = impl.writeAllBillsOnFile(rawFile, bills)
-	}
+		file.latestRecordAt, offsets, file.size, err = impl.rewriteBillFile(filePath, bills)
+		if err != nil {
+			impl.index.invalidate()
 
-	file = &streamFile{
-		file:           rawFile,
-		key:            key,
-		filePath:       filePath,
-		latestRecordAt: latestRecordAt,
-		lastAccessAt:   time.Now(),
+			return
+		}
+
+		impl.index.setFile(key, offsets)
+
+		if e := quarantineBadLines(filePath, badLines); e != nil {
+			impl.logger.WithFields(l.ErrorField(e), l.StringField("filePath", filePath)).
+				Error("quarantine bad lines failed")
+		}
+	} else {
+		if fi, e := os.Stat(filePath); e == nil {
+			file.size = fi.Size()
+		}
+
+		if len(bills) > 0 {
+			file.latestRecordAt = time.Unix(bills[len(bills)-1].At, 0)
+		}
 	}
 
 	impl.files[key] = file
@@ -145,14 +185,27 @@ func (impl *billFileImpl) getFileByKey(key string) (file *streamFile, err error)
 	return
 }
 
-func (impl *billFileImpl) AddBill(bill model.GroupBill) error {
+func (impl *billFileImpl) AddBill(bill model.GroupBill) (billID string, err error) {
 	if !bill.Valid() {
-		return commerr.ErrInvalidArgument
+		err = commerr.ErrInvalidArgument
+
+		return
 	}
 
-	at := time.Unix(bill.At, 0)
+	bill.ID = newBillID(bill)
+
+	err = impl.writeBill(bill)
+	if err != nil {
+		return
+	}
 
-	bill.ID = fmt.Sprintf("%s%d", at.Format("20060102"), snowflake.ID())
+	billID = bill.ID
+
+	return
+}
+
+func (impl *billFileImpl) writeBill(bill model.GroupBill) error {
+	at := time.Unix(bill.At, 0)
 
 	sf, err := impl.getFileAt(at)
 	if err != nil {
@@ -174,16 +227,34 @@ func (impl *billFileImpl) AddBill(bill model.GroupBill) error {
 			return err
 		}
 
-		line := string(d) + "\n"
+		line := string(impl.crypter.sealLine(d)) + "\n"
+
+		offset := sf.size
+
+		err = sf.ensureOpen()
+		if err != nil {
+			impl.logger.WithFields(l.ErrorField(err)).Error("open file failed")
+
+			return err
+		}
 
 		_, err = sf.file.Write([]byte(line))
+		if err == nil {
+			err = sf.file.Sync()
+		}
+
 		if err != nil {
 			impl.logger.WithFields(l.ErrorField(err)).Error("write file failed")
 
+			impl.index.invalidate()
+
 			return err
 		}
 
 		sf.latestRecordAt = at
+		sf.size += int64(len(line))
+
+		impl.index.add(sf.key, bill.ID, offset)
 
 		return nil
 	}
@@ -197,103 +268,294 @@ func (impl *billFileImpl) AddBill(bill model.GroupBill) error {
 	return err
 }
 
-func (impl *billFileImpl) rebuildGroupDateBills(sf *streamFile,
-	billsProc func(bills []model.GroupBill) (newBills []model.GroupBill, err error)) (err error) {
-	bills, err := impl.readFileBills(sf.filePath)
+func (impl *billFileImpl) UpdateBill(bill model.GroupBill) (oldBill model.GroupBill, err error) {
+	if len(bill.ID) <= 8 || !bill.Valid() {
+		err = commerr.ErrInvalidArgument
+
+		return
+	}
+
+	oldKey, err := impl.locateBillFileKey(bill.ID)
 	if err != nil {
-		impl.logger.WithFields(l.ErrorField(err), l.StringField("filePath", sf.filePath)).
-			Error("read bills failed")
+		return
+	}
 
-		return err
+	sf, err := impl.getFileByKey(oldKey)
+	if err != nil {
+		impl.logger.WithFields(l.ErrorField(err), l.AnyField("key", oldKey)).Error("get File failed")
+
+		err = commerr.ErrInternal
+
+		return
 	}
 
-	bills, err = billsProc(bills)
+	newKey := impl.getFileKey(time.Unix(bill.At, 0))
+	if newKey != oldKey {
+		oldBill, err = impl.moveBill(oldKey, bill)
+
+		return
+	}
+
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	err = impl.rebuildGroupDateBills(sf, func(bills []model.GroupBill) (newBills []model.GroupBill, err error) {
+		for idx := 0; idx < len(bills); idx++ {
+			if bills[idx].ID != bill.ID {
+				continue
+			}
+
+			oldBill = bills[idx]
+			keepServerBillFields(&bill, oldBill)
+			bills[idx] = bill
+
+			newBills = bills
+
+			return
+		}
+
+		err = commerr.ErrNotFound
+
+		return
+	})
+
+	return
+}
+
+func (impl *billFileImpl) ModifyBill(billID string, fnModify func(bill *model.GroupBill) error) (err error) {
+	impl.moveLock.RLock()
+	defer impl.moveLock.RUnlock()
+
+	key, err := impl.locateBillFileKey(billID)
 	if err != nil {
-		impl.logger.WithFields(l.ErrorField(err), l.StringField("filePath", sf.filePath)).
-			Error("proc bills return error")
+		return
+	}
 
-		return err
+	sf, err := impl.getFileByKey(key)
+	if err != nil {
+		impl.logger.WithFields(l.ErrorField(err), l.AnyField("key", key)).Error("get File failed")
+
+		err = commerr.ErrInternal
+
+		return
 	}
 
-	slices.SortFunc(bills, func(a, b model.GroupBill) int {
-		if a.At == b.At {
-			return 0
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	err = impl.rebuildGroupDateBills(sf, func(bills []model.GroupBill) (newBills []model.GroupBill, err error) {
+		idx := slices.IndexFunc(bills, func(bill model.GroupBill) bool {
+			return bill.ID == billID
+		})
+		if idx < 0 {
+			err = commerr.ErrNotFound
+
+			return
+		}
+
+		bill := bills[idx]
+
+		err = fnModify(&bill)
+		if err != nil {
+			return
 		}
 
-		if a.At < b.At {
-			return -1
+		if bill.ID != billID || bill.At != bills[idx].At {
+			err = commerr.ErrInvalidArgument
+
+			return
 		}
 
-		return 1
+		bills[idx] = bill
+		newBills = bills
+
+		return
 	})
 
-	_ = sf.file.Close()
+	return
+}
 
-	bakFilePath := sf.filePath + ".bak"
+// moveBill moves the updated bill from the day file oldKey to the day file of its new date. The bill is
+// written to the new day file before it is removed from the old one, so a failed write loses nothing.
+func (impl *billFileImpl) moveBill(oldKey string, bill model.GroupBill) (oldBill model.GroupBill, err error) {
+	impl.moveLock.Lock()
+	defer impl.moveLock.Unlock()
 
-	_ = os.RemoveAll(bakFilePath)
+	storedBill, err := impl.GetBill(bill.ID)
+	if err != nil {
+		return
+	}
 
-	_ = os.Rename(sf.filePath, bakFilePath)
+	keepServerBillFields(&bill, storedBill)
 
-	rawFile, err := os.OpenFile(sf.filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	err = impl.writeBill(bill)
 	if err != nil {
-		delete(impl.files, sf.key)
+		impl.logger.WithFields(l.ErrorField(err), l.StringField("billID", bill.ID)).
+			Error("write bill to new date file failed")
 
-		impl.logger.WithFields(l.ErrorField(err), l.StringField("file", sf.filePath)).
-			Error("reopen file failed")
+		return
+	}
 
-		return err
+	err = impl.removeBillInFile(oldKey, bill.ID, func(removedBill model.GroupBill) error {
+		oldBill = removedBill
+
+		return nil
+	})
+	if err == nil {
+		return
+	}
+
+	impl.logger.WithFields(l.ErrorField(err), l.StringField("billID", bill.ID)).
+		Error("remove bill from old date file failed")
+
+	// drop the new copy, the bill stays in the old day file
+	if e := impl.removeBillInFile(impl.getFileKey(time.Unix(bill.At, 0)), bill.ID, nil); e != nil {
+		impl.logger.WithFields(l.ErrorField(e), l.StringField("billID", bill.ID)).
+			Error("remove bill from new date file failed")
 	}
 
-	sf.file = rawFile
+	impl.index.invalidate()
+
+	return
+}
+
+// keepServerBillFields sets the fields only the server changes from the stored bill, so an update never
+// drops an attachment added or removed after the caller read the bill.
+func keepServerBillFields(bill *model.GroupBill, storedBill model.GroupBill) {
+	bill.OperationPersonID = storedBill.OperationPersonID
+	bill.Attachments = storedBill.Attachments
+	bill.Settlement = storedBill.Settlement
+}
 
-	sf.latestRecordAt, err = impl.writeAllBillsOnFile(sf.file, bills)
+func (impl *billFileImpl) rebuildGroupDateBills(sf *streamFile,
+	billsProc func(bills []model.GroupBill) (newBills []model.GroupBill, err error)) (err error) {
+	bills, badLines, _, err := scanBillFile(sf.filePath, impl.crypter)
 	if err != nil {
-		delete(impl.files, sf.key)
+		impl.logger.WithFields(l.ErrorField(err), l.StringField("filePath", sf.filePath)).
+			Error("read bills failed")
 
+		return err
+	}
+
+	bills, err = billsProc(bills)
+	if err != nil {
+		impl.logger.WithFields(l.ErrorField(err), l.StringField("filePath", sf.filePath)).
+			Error("proc bills return error")
+
+		return err
+	}
+
+	slices.SortStableFunc(bills, compareBillAt)
+
+	sf.closeFile()
+
+	latestRecordAt, offsets, size, err := impl.rewriteBillFile(sf.filePath, bills)
+	if err != nil {
 		impl.logger.WithFields(l.ErrorField(err), l.StringField("file", sf.filePath)).
 			Error("write all bills failed")
 
+		// the old file is still in place
 		return err
 	}
 
+	sf.latestRecordAt = latestRecordAt
+	sf.size = size
+
+	impl.index.setFile(sf.key, offsets)
+
+	// the rewrite dropped the bad lines, keep them aside now it is committed
+	if e := quarantineBadLines(sf.filePath, badLines); e != nil {
+		impl.logger.WithFields(l.ErrorField(e), l.StringField("filePath", sf.filePath)).
+			Error("quarantine bad lines failed")
+	}
+
+	return
+}
+
+// rewriteBillFile replaces the day file with bills, the old content stays intact until the new one is synced.
+func (impl *billFileImpl) rewriteBillFile(filePath string, bills []model.GroupBill) (latestRecordAt time.Time,
+	offsets map[string]int64, size int64, err error) {
+	err = writeFileAtomic(filePath, func(w io.Writer) (e error) {
+		latestRecordAt, offsets, size, e = writeAllBillsOnFile(w, bills, impl.crypter)
+
+		return
+	})
+
 	return
 }
+
 func (impl *billFileImpl) GetBill(billID string) (bill model.GroupBill, err error) {
-	if len(billID) <= 8 {
-		err = commerr.ErrInvalidArgument
+	location, err := impl.indexLocate(billID)
+	if err != nil {
+		return
+	}
 
+	bill, err = impl.readBillAt(impl.getFilePath(location.key), location.offset)
+	if err == nil && bill.ID == billID {
 		return
 	}
 
-	key := billID[:8]
+	// the file changed under the index, e.g. edited by hand
+	impl.index.invalidate()
 
-	sf, err := impl.getFileByKey(key)
+	location, err = impl.indexLocate(billID)
 	if err != nil {
-		impl.logger.WithFields(l.ErrorField(err), l.AnyField("key", key)).Error("get File failed")
+		return
+	}
 
-		err = commerr.ErrInternal
+	bill, err = impl.readBillAt(impl.getFilePath(location.key), location.offset)
+	if err == nil && bill.ID != billID {
+		err = commerr.ErrNotFound
+	}
+
+	return
+}
+
+// locateBillFileKey returns the day file key holding billID. Bill IDs are prefixed with the
+// date they were first recorded on, but an updated bill may have moved to another day file.
+func (impl *billFileImpl) locateBillFileKey(billID string) (key string, err error) {
+	if len(billID) <= 8 {
+		err = commerr.ErrInvalidArgument
 
 		return
 	}
 
-	bills, err := impl.readFileBills(sf.filePath)
+	location, err := impl.indexLocate(billID)
 	if err != nil {
-		impl.logger.WithFields(l.ErrorField(err), l.StringField("filePath", sf.filePath)).
-			Error("read bills failed")
+		return
+	}
+
+	key = location.key
 
+	return
+}
+
+func (impl *billFileImpl) listFileKeys() (keys []string, err error) {
+	files, err := os.ReadDir(impl.dir)
+	if err != nil {
 		return
 	}
 
-	for _, groupBill := range bills {
-		if groupBill.ID == billID {
-			bill = groupBill
+	prefix := impl.base + "-"
 
-			return
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), prefix) {
+			continue
+		}
+
+		key := strings.TrimPrefix(file.Name(), prefix)
+		if len(key) != 8 {
+			continue
 		}
+
+		if _, e := strconv.Atoi(key); e != nil {
+			continue
+		}
+
+		keys = append(keys, key)
 	}
 
-	err = commerr.ErrNotFound
+	slices.Sort(keys)
 
 	return
 }
@@ -321,15 +583,59 @@ func (impl *billFileImpl) RestoreDeletedBill(billID string) error {
 	return impl.restoreDeletedBill(billID)
 }
 
-func (impl *billFileImpl) DeleteRecord(billID string) (err error) {
-	if len(billID) <= 8 {
+func (impl *billFileImpl) PurgeDeletedBills(deletedBefore time.Time) (bills []model.DeletedGroupBill, err error) {
+	return impl.purgeDeletedBills(deletedBefore)
+}
+
+func (impl *billFileImpl) DeleteRecord(billID string, deletedBy uint64) (err error) {
+	return impl.removeBill(billID, func(bill model.GroupBill) error {
+		err := impl.addDeletedBill(model.DeletedGroupBill{
+			GroupBill: bill,
+			DeletedAt: time.Now(),
+			DeletedBy: deletedBy,
+		})
+		if err != nil {
+			impl.logger.WithFields(l.ErrorField(err)).Error("recordDeletedBill failed")
+		}
+
+		return err
+	})
+}
+
+func (impl *billFileImpl) AddDeletedBill(bill model.DeletedGroupBill) (billID string, err error) {
+	if !bill.Valid() {
 		err = commerr.ErrInvalidArgument
 
 		return
 	}
 
-	key := billID[:8]
+	bill.ID = newBillID(bill.GroupBill)
+
+	err = impl.addDeletedBill(bill)
+	if err != nil {
+		return
+	}
+
+	billID = bill.ID
+
+	return
+}
+
+// RemoveBill drops the bill without keeping it in the deleted history.
+func (impl *billFileImpl) RemoveBill(billID string) (err error) {
+	return impl.removeBill(billID, nil)
+}
+
+func (impl *billFileImpl) removeBill(billID string, fnRemoved func(bill model.GroupBill) error) (err error) {
+	key, err := impl.locateBillFileKey(billID)
+	if err != nil {
+		return
+	}
+
+	return impl.removeBillInFile(key, billID, fnRemoved)
+}
 
+func (impl *billFileImpl) removeBillInFile(key, billID string, fnRemoved func(bill model.GroupBill) error) (err error) {
 	sf, err := impl.getFileByKey(key)
 	if err != nil {
 		impl.logger.WithFields(l.ErrorField(err), l.AnyField("key", key)).Error("get File failed")
@@ -337,14 +643,17 @@ func (impl *billFileImpl) DeleteRecord(billID string) (err error) {
 		return commerr.ErrInternal
 	}
 
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
 	//
-	var toDeletedBill *model.GroupBill
+	var removedBill *model.GroupBill
 
 	err = impl.rebuildGroupDateBills(sf, func(bills []model.GroupBill) (newBills []model.GroupBill, err error) {
 		for idx := 0; idx < len(bills); idx++ {
 			if bills[idx].ID == billID {
 				b := bills[idx]
-				toDeletedBill = &b
+				removedBill = &b
 
 				bills = slices.Delete(bills, idx, idx+1)
 
@@ -352,20 +661,17 @@ func (impl *billFileImpl) DeleteRecord(billID string) (err error) {
 			}
 		}
 
-		if toDeletedBill == nil {
+		if removedBill == nil {
 			err = commerr.ErrNotFound
 
 			return
 		}
 
-		err = impl.addDeletedBill(model.DeletedGroupBill{
-			GroupBill: *toDeletedBill,
-			DeletedAt: time.Now(),
-		})
-		if err != nil {
-			impl.logger.WithFields(l.ErrorField(err)).Error("recordDeletedBill failed")
-
-			return
+		if fnRemoved != nil {
+			err = fnRemoved(*removedBill)
+			if err != nil {
+				return
+			}
 		}
 
 		newBills = bills
@@ -376,23 +682,28 @@ func (impl *billFileImpl) DeleteRecord(billID string) (err error) {
 	return
 }
 
-func (impl *billFileImpl) writeAllBillsOnFile(file *os.File, bills []model.GroupBill) (latestRecordAt time.Time,
-	err error) {
+func writeAllBillsOnFile(w io.Writer, bills []model.GroupBill, crypter *Crypter) (latestRecordAt time.Time,
+	offsets map[string]int64, size int64, err error) {
 	var d []byte
 
+	offsets = make(map[string]int64, len(bills))
+
 	for _, b := range bills {
 		d, err = json.Marshal(b)
 		if err != nil {
 			return
 		}
 
-		line := string(d) + "\n"
+		line := string(crypter.sealLine(d)) + "\n"
 
-		_, err = file.Write([]byte(line))
+		_, err = w.Write([]byte(line))
 		if err != nil {
 			return
 		}
 
+		offsets[b.ID] = size
+		size += int64(len(line))
+
 		latestRecordAt = time.Unix(b.At, 0)
 	}
 
@@ -400,38 +711,9 @@ func (impl *billFileImpl) writeAllBillsOnFile(file *os.File, bills []model.Group
 }
 
 func (impl *billFileImpl) readFileBills(path string) (bills []model.GroupBill, err error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return
-	}
-
-	defer file.Close()
-
-	reader := bufio.NewReader(file)
-
-	for {
-		var line []byte
-
-		line, err = reader.ReadBytes('\n')
-		if err == io.EOF {
-			err = nil
-
-			break
-		}
-
-		if err != nil {
-			return
-		}
-
-		var bill model.GroupBill
+	bills, badLines, _, err := scanBillFile(path, impl.crypter)
 
-		err = json.Unmarshal(line, &bill)
-		if err != nil {
-			return
-		}
-
-		bills = append(bills, bill)
-	}
+	logBadBillLines(impl.logger, path, badLines)
 
 	return
 }
@@ -449,53 +731,23 @@ func (impl *billFileImpl) GetBills(startDate, finishDate string) (bills []model.
 		return
 	}
 
-	var startDateFileName, finishDateFileName string
-
-	if len(startDate) != 0 {
-		startDateFileName = impl.base + "-" + startDate
-	}
-
-	if len(finishDate) != 0 {
-		finishDateFileName = impl.base + "-" + finishDate
-	}
-
-	files, err := os.ReadDir(impl.dir)
+	keys, err := impl.indexKeys()
 	if err != nil {
 		return
 	}
 
-	billFiles := make([]string, 0, 10)
-
-	for _, file := range files {
-		if file.IsDir() {
+	for _, key := range keys {
+		if startDate != "" && key < startDate {
 			continue
 		}
 
-		if !strings.HasPrefix(file.Name(), impl.base) {
+		if finishDate != "" && key > finishDate {
 			continue
 		}
 
-		if startDateFileName != "" {
-			if file.Name() < startDateFileName {
-				continue
-			}
-		}
-
-		if finishDateFileName != "" {
-			if file.Name() > finishDateFileName {
-				continue
-			}
-		}
-
-		billFiles = append(billFiles, file.Name())
-	}
-
-	slices.Sort(billFiles)
-
-	for _, file := range billFiles {
 		var dayBills []model.GroupBill
 
-		dayBills, err = impl.readFileBills(filepath.Join(impl.dir, file))
+		dayBills, err = impl.readFileBills(impl.getFilePath(key))
 		if err != nil {
 			return
 		}
@@ -507,7 +759,7 @@ func (impl *billFileImpl) GetBills(startDate, finishDate string) (bills []model.
 }
 
 func (impl *billFileImpl) ListBills(id string, count int, dirNew bool) (bills []model.GroupBill, hasMore bool, err error) {
-	files, err := os.ReadDir(impl.dir)
+	keys, err := impl.indexKeys()
 	if err != nil {
 		return
 	}
@@ -516,40 +768,33 @@ func (impl *billFileImpl) ListBills(id string, count int, dirNew bool) (bills []
 		count++
 	}
 
-	var inFileName string
+	var inKey string
 
 	if id != "" && len(id) > 8 {
-		inFileName = impl.getFileName(id[:8])
-	}
-
-	billFiles := make([]string, 0, 10)
-
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-
-		if !strings.HasPrefix(file.Name(), impl.base) {
-			continue
+		// an updated bill may have moved to another day file than the date prefix of its id
+		inKey, err = impl.locateBillFileKey(id)
+		if err != nil {
+			inKey = id[:8]
+			err = nil
 		}
+	}
 
-		if strings.HasSuffix(file.Name(), ".bak") {
-			continue
-		}
+	billFiles := make([]string, 0, len(keys))
 
-		if inFileName != "" {
+	for _, key := range keys {
+		if inKey != "" {
 			if dirNew {
-				if file.Name() < inFileName {
+				if key < inKey {
 					continue
 				}
 			} else {
-				if file.Name() > inFileName {
+				if key > inKey {
 					continue
 				}
 			}
 		}
 
-		billFiles = append(billFiles, file.Name())
+		billFiles = append(billFiles, impl.getFileName(key))
 	}
 
 	slices.SortFunc(billFiles, func(a, b string) int {
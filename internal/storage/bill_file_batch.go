@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+)
+
+const (
+	batchJournalFileName = "batch-records"
+)
+
+type batchJournalEntry struct {
+	GroupID uint64 `json:"groupID"`
+	BillID  string `json:"billID"`
+}
+
+/*
+fileBatchRecorder writes a batch of bills to the day files all or nothing. The bill IDs are assigned and
+journaled before any bill is written, the journal is removed once all are written. A journal left by a crash
+or a failed roll back is rolled back on next start.
+*/
+type fileBatchRecorder struct {
+	lock        sync.Mutex
+	impl        *storageImpl
+	journalFile string
+}
+
+func newFileBatchRecorder(impl *storageImpl) *fileBatchRecorder {
+	return &fileBatchRecorder{
+		impl:        impl,
+		journalFile: filepath.Join(impl.dataRoot, batchJournalFileName),
+	}
+}
+
+func (recorder *fileBatchRecorder) record(records []GroupRecord) (billIDs []string, err error) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	if _, e := os.Stat(recorder.journalFile); e == nil {
+		if err = recorder.rollBackLocked(); err != nil {
+			return
+		}
+	}
+
+	entries := make([]batchJournalEntry, 0, len(records))
+
+	for idx := range records {
+		if !records[idx].Bill.Valid() {
+			err = commerr.ErrInvalidArgument
+
+			return
+		}
+
+		records[idx].Bill.ID = newBillID(records[idx].Bill)
+
+		entries = append(entries, batchJournalEntry{
+			GroupID: records[idx].GroupID,
+			BillID:  records[idx].Bill.ID,
+		})
+	}
+
+	d, err := json.Marshal(entries)
+	if err != nil {
+		return
+	}
+
+	err = writeSealedFileAtomic(recorder.journalFile, d, recorder.impl.crypter)
+	if err != nil {
+		return
+	}
+
+	for _, record := range records {
+		billFile, ok := recorder.impl.getGroupBills(record.GroupID).(*billFileImpl)
+		if !ok {
+			err = commerr.ErrInternal
+
+			break
+		}
+
+		if err = billFile.writeBill(record.Bill); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		// the commit point
+		err = os.Remove(recorder.journalFile)
+	}
+
+	if err != nil {
+		if e := recorder.rollBackLocked(); e != nil {
+			err = fmt.Errorf("%w, roll back failed: %v", err, e)
+		}
+
+		return
+	}
+
+	billIDs = make([]string, 0, len(records))
+	for _, record := range records {
+		billIDs = append(billIDs, record.Bill.ID)
+	}
+
+	return
+}
+
+// recover rolls back the batch left by a crash or a failed roll back.
+func (recorder *fileBatchRecorder) recover() {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	if _, err := os.Stat(recorder.journalFile); err != nil {
+		return
+	}
+
+	if err := recorder.rollBackLocked(); err != nil {
+		recorder.impl.logger.WithFields(l.ErrorField(err)).Error("roll back batch records failed")
+	}
+}
+
+// rollBackLocked removes the journaled bills, the journal is kept until all of them are removed.
+func (recorder *fileBatchRecorder) rollBackLocked() error {
+	d, err := readSealedFile(recorder.journalFile, recorder.impl.crypter)
+	if err != nil {
+		return err
+	}
+
+	var entries []batchJournalEntry
+
+	if err = json.Unmarshal(d, &entries); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err = recorder.impl.getGroupBills(entry.GroupID).RemoveBill(entry.BillID)
+		if err != nil && !errors.Is(err, commerr.ErrNotFound) {
+			return err
+		}
+	}
+
+	return os.Remove(recorder.journalFile)
+}
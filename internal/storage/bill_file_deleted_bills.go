@@ -3,8 +3,8 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/s-min-sys/lifecostbe/internal/model"
 	"github.com/sgostarter/i/commerr"
@@ -20,7 +20,11 @@ func (impl *billFileImpl) deletedBillsFilePath() string {
 func (impl *billFileImpl) saveDeletedBillsToFile(groupID uint64) (err error) {
 	impl.mustDeletedBillsHistoryLoaded()
 
-	d, err := json.Marshal(impl.deletedBills[groupID])
+	return impl.writeDeletedBillsFile(impl.deletedBills[groupID])
+}
+
+func (impl *billFileImpl) writeDeletedBillsFile(billsM map[string]model.DeletedGroupBill) (err error) {
+	d, err := json.Marshal(billsM)
 	if err != nil {
 		return
 	}
@@ -29,7 +33,7 @@ func (impl *billFileImpl) saveDeletedBillsToFile(groupID uint64) (err error) {
 
 	_ = pathutils.MustDirOfFileExists(filePath)
 
-	err = os.WriteFile(filePath, d, 0600)
+	err = writeSealedFileAtomic(filePath, d, impl.crypter)
 
 	return
 }
@@ -47,7 +51,7 @@ func (impl *billFileImpl) isDeletedBillsHistoryLoaded() bool {
 }
 
 func (impl *billFileImpl) loadDeletedBillsHistory() (err error) {
-	d, err := os.ReadFile(impl.deletedBillsFilePath())
+	d, err := readSealedFile(impl.deletedBillsFilePath(), impl.crypter)
 	if err != nil {
 		impl.deletedBills[impl.groupID] = make(map[string]model.DeletedGroupBill)
 
@@ -145,12 +149,55 @@ func (impl *billFileImpl) deleteDeletedBill(billID string) (err error) {
 	impl.deletedBillsLock.Lock()
 	defer impl.deletedBillsLock.Unlock()
 
-	if bills, ok := impl.deletedBills[impl.groupID]; ok {
-		delete(bills, billID)
+	bills := impl.deletedBills[impl.groupID]
+	if _, ok := bills[billID]; !ok {
+		err = commerr.ErrNotFound
 
-		err = impl.saveDeletedBillsToFile(impl.groupID)
+		return
 	}
 
+	delete(bills, billID)
+
+	err = impl.saveDeletedBillsToFile(impl.groupID)
+
+	return
+}
+
+func (impl *billFileImpl) purgeDeletedBills(deletedBefore time.Time) (bills []model.DeletedGroupBill, err error) {
+	impl.mustDeletedBillsHistoryLoaded()
+
+	impl.deletedBillsLock.Lock()
+	defer impl.deletedBillsLock.Unlock()
+
+	billsM, ok := impl.deletedBills[impl.groupID]
+	if !ok {
+		return
+	}
+
+	keptBillsM := make(map[string]model.DeletedGroupBill, len(billsM))
+
+	for billID, bill := range billsM {
+		if bill.DeletedAt.Before(deletedBefore) {
+			bills = append(bills, bill)
+		} else {
+			keptBillsM[billID] = bill
+		}
+	}
+
+	if len(bills) == 0 {
+		return
+	}
+
+	// the memory keeps the purged bills if the file is not saved
+	err = impl.writeDeletedBillsFile(keptBillsM)
+	if err != nil {
+		bills = nil
+
+		return
+	}
+
+	impl.deletedBills[impl.groupID] = keptBillsM
+
 	return
 }
 
@@ -164,7 +211,7 @@ func (impl *billFileImpl) restoreDeletedBill(billID string) (err error) {
 
 	impl.logger.WithFields(l.StringField("billID", billID)).Info("restore bill before")
 
-	err = impl.AddBill(bill.GroupBill)
+	_, err = impl.AddBill(bill.GroupBill)
 
 	impl.logger.WithFields(l.StringField("billID", billID)).Info("restore bill after")
 
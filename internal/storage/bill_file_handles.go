@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+const (
+	defaultMaxOpenBillFiles = 64
+	billFileIdleTimeout     = time.Minute * 5
+	billFileEvictInterval   = time.Minute
+)
+
+// fileHandles bounds the day files kept open for appending across all groups of a storage.
+// Files are closed when idle or least recently used, and reopened on the next write.
+type fileHandles struct {
+	lock        sync.Mutex
+	maxOpen     int
+	idleTimeout time.Duration
+	open        []*streamFile // least recently used first
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func newFileHandles(maxOpen int, idleTimeout time.Duration) *fileHandles {
+	if maxOpen <= 0 {
+		maxOpen = defaultMaxOpenBillFiles
+	}
+
+	return &fileHandles{
+		maxOpen:     maxOpen,
+		idleTimeout: idleTimeout,
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// evictRoutine closes the idle files until stop is called.
+func (handles *fileHandles) evictRoutine() {
+	ticker := time.NewTicker(billFileEvictInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-handles.stopCh:
+			return
+		case <-ticker.C:
+			handles.evictIdle(time.Now())
+		}
+	}
+}
+
+// stop ends evictRoutine and closes the files not in use.
+func (handles *fileHandles) stop() {
+	handles.stopOnce.Do(func() {
+		close(handles.stopCh)
+	})
+
+	handles.lock.Lock()
+	defer handles.lock.Unlock()
+
+	for idx := 0; idx < len(handles.open); {
+		if handles.evictLocked(handles.open[idx]) {
+			continue
+		}
+
+		idx++
+	}
+}
+
+// touch marks sf as just used, the caller holds sf.lock.
+func (handles *fileHandles) touch(sf *streamFile) {
+	handles.lock.Lock()
+	defer handles.lock.Unlock()
+
+	sf.lastAccessAt = time.Now()
+
+	if idx := slices.Index(handles.open, sf); idx >= 0 {
+		handles.open = slices.Delete(handles.open, idx, idx+1)
+	}
+
+	handles.open = append(handles.open, sf)
+
+	for idx := 0; len(handles.open) > handles.maxOpen && idx < len(handles.open)-1; {
+		if handles.evictLocked(handles.open[idx]) {
+			continue
+		}
+
+		idx++
+	}
+}
+
+// closed forgets sf after its file is closed by its owner, the caller holds sf.lock.
+func (handles *fileHandles) closed(sf *streamFile) {
+	handles.lock.Lock()
+	defer handles.lock.Unlock()
+
+	if idx := slices.Index(handles.open, sf); idx >= 0 {
+		handles.open = slices.Delete(handles.open, idx, idx+1)
+	}
+}
+
+func (handles *fileHandles) evictIdle(timeNow time.Time) {
+	handles.lock.Lock()
+	defer handles.lock.Unlock()
+
+	for idx := 0; idx < len(handles.open); {
+		if timeNow.Sub(handles.open[idx].lastAccessAt) < handles.idleTimeout {
+			break
+		}
+
+		if handles.evictLocked(handles.open[idx]) {
+			continue
+		}
+
+		idx++
+	}
+}
+
+func (handles *fileHandles) openCount() int {
+	handles.lock.Lock()
+	defer handles.lock.Unlock()
+
+	return len(handles.open)
+}
+
+// evictLocked closes sf unless it is in use right now, the caller holds handles.lock.
+func (handles *fileHandles) evictLocked(sf *streamFile) bool {
+	if !sf.lock.TryLock() {
+		return false
+	}
+
+	defer sf.lock.Unlock()
+
+	if sf.file != nil {
+		_ = sf.file.Close()
+		sf.file = nil
+	}
+
+	if idx := slices.Index(handles.open, sf); idx >= 0 {
+		handles.open = slices.Delete(handles.open, idx, idx+1)
+	}
+
+	return true
+}
+
+// ensureOpen opens the file for appending if it was closed, the caller holds sf.lock.
+func (sf *streamFile) ensureOpen() (err error) {
+	if sf.file == nil {
+		sf.file, err = os.OpenFile(sf.filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return
+		}
+	}
+
+	sf.handles.touch(sf)
+
+	return
+}
+
+// closeFile closes the file before it is replaced, the caller holds sf.lock.
+func (sf *streamFile) closeFile() {
+	if sf.file == nil {
+		return
+	}
+
+	_ = sf.file.Close()
+	sf.file = nil
+
+	sf.handles.closed(sf)
+}
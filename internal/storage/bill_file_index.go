@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/i/commerr"
+	"golang.org/x/exp/slices"
+)
+
+// billIndex maps bill IDs to the day file and the line offset holding them, and keeps the sorted day
+// file keys of a group. It is loaded on first use and kept up to date by every write of the day files.
+type billIndex struct {
+	lock   sync.Mutex
+	loaded bool
+	keys   []string                    // sorted day file keys
+	files  map[string]map[string]int64 // day file key - bill ID - line offset
+	bills  map[string]string           // bill ID - day file key
+}
+
+type billLocation struct {
+	key    string
+	offset int64
+}
+
+func (impl *billFileImpl) mustIndexLoaded() error {
+	impl.index.lock.Lock()
+	defer impl.index.lock.Unlock()
+
+	if impl.index.loaded {
+		return nil
+	}
+
+	keys, err := impl.listFileKeys()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	impl.index.keys = keys
+	impl.index.files = make(map[string]map[string]int64, len(keys))
+	impl.index.bills = make(map[string]string)
+
+	for _, key := range keys {
+		offsets, e := impl.readFileBillOffsets(impl.getFilePath(key))
+		if e != nil && !os.IsNotExist(e) {
+			return e
+		}
+
+		impl.index.setFileLocked(key, offsets)
+	}
+
+	impl.index.loaded = true
+
+	return nil
+}
+
+func (index *billIndex) setFileLocked(key string, offsets map[string]int64) {
+	for billID := range index.files[key] {
+		// a bill moved to another day file is written there before it is removed from this one
+		if index.bills[billID] == key {
+			delete(index.bills, billID)
+		}
+	}
+
+	index.files[key] = offsets
+
+	for billID := range offsets {
+		index.bills[billID] = key
+	}
+
+	if idx, found := slices.BinarySearch(index.keys, key); !found {
+		index.keys = slices.Insert(index.keys, idx, key)
+	}
+}
+
+// setFile replaces the bills of the day file key after it is rewritten.
+func (index *billIndex) setFile(key string, offsets map[string]int64) {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	if !index.loaded {
+		return
+	}
+
+	index.setFileLocked(key, offsets)
+}
+
+// add records a bill appended to the day file key.
+func (index *billIndex) add(key, billID string, offset int64) {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	if !index.loaded {
+		return
+	}
+
+	if _, ok := index.files[key]; !ok {
+		index.setFileLocked(key, make(map[string]int64))
+	}
+
+	index.files[key][billID] = offset
+	index.bills[billID] = key
+}
+
+// invalidate drops the index after a failed write, it is reloaded from the day files on next use.
+func (index *billIndex) invalidate() {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	index.loaded = false
+	index.keys = nil
+	index.files = nil
+	index.bills = nil
+}
+
+func (impl *billFileImpl) indexLocate(billID string) (location billLocation, err error) {
+	if err = impl.mustIndexLoaded(); err != nil {
+		return
+	}
+
+	impl.index.lock.Lock()
+	defer impl.index.lock.Unlock()
+
+	key, ok := impl.index.bills[billID]
+	if !ok {
+		err = commerr.ErrNotFound
+
+		return
+	}
+
+	location = billLocation{
+		key:    key,
+		offset: impl.index.files[key][billID],
+	}
+
+	return
+}
+
+func (impl *billFileImpl) indexKeys() (keys []string, err error) {
+	if err = impl.mustIndexLoaded(); err != nil {
+		return
+	}
+
+	impl.index.lock.Lock()
+	defer impl.index.lock.Unlock()
+
+	keys = slices.Clone(impl.index.keys)
+
+	return
+}
+
+func (impl *billFileImpl) readFileBillOffsets(path string) (offsets map[string]int64, err error) {
+	offsets = make(map[string]int64)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	var offset int64
+
+	for {
+		var line []byte
+
+		line, err = reader.ReadBytes('\n')
+		if err == io.EOF {
+			err = nil
+
+			break
+		}
+
+		if err != nil {
+			return
+		}
+
+		var bill model.GroupBill
+
+		if d, e := impl.crypter.openLine(line); e == nil && json.Unmarshal(d, &bill) == nil && bill.ID != "" {
+			offsets[bill.ID] = offset
+		}
+
+		offset += int64(len(line))
+	}
+
+	return
+}
+
+func (impl *billFileImpl) readBillAt(path string, offset int64) (bill model.GroupBill, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+
+	line, err := bufio.NewReader(io.NewSectionReader(file, offset, 1<<20)).ReadBytes('\n')
+	if err != nil {
+		return
+	}
+
+	d, err := impl.crypter.openLine(line)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(d, &bill)
+
+	return
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sgostarter/i/l"
+)
+
+const (
+	tmpFileSuffix = ".tmp"
+	bakFileSuffix = ".bak"
+)
+
+var billDayFileNameRe = regexp.MustCompile(`^\d+-\d{8}$`)
+
+// writeFileAtomic writes a temp file next to filePath, syncs it and renames it over filePath,
+// so a crash leaves either the old or the new content.
+func writeFileAtomic(filePath string, fnWrite func(w io.Writer) error) (err error) {
+	tmpFilePath := filePath + tmpFileSuffix
+
+	file, err := os.OpenFile(tmpFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+
+	writer := bufio.NewWriter(file)
+
+	err = fnWrite(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if e := file.Close(); err == nil {
+		err = e
+	}
+
+	if err != nil {
+		_ = os.Remove(tmpFilePath)
+
+		return
+	}
+
+	err = os.Rename(tmpFilePath, filePath)
+	if err != nil {
+		_ = os.Remove(tmpFilePath)
+
+		return
+	}
+
+	syncDir(filepath.Dir(filePath))
+
+	return
+}
+
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+// recoverBillFiles cleans up after interrupted day file rewrites: temp files are dropped as the
+// original file is untouched. A .bak file (written by older versions before rewriting) only replaces
+// a day file that is missing or can't be read, otherwise it is dropped.
+func recoverBillFiles(dir string, crypter *Crypter, logger l.Wrapper) {
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+
+		if strings.HasSuffix(name, tmpFileSuffix) {
+			_ = os.Remove(filepath.Join(dir, name))
+
+			logger.WithFields(l.StringField("file", name)).Warn("removed temp file of interrupted write")
+
+			continue
+		}
+
+		if !strings.HasSuffix(name, bakFileSuffix) || !billDayFileNameRe.MatchString(strings.TrimSuffix(name, bakFileSuffix)) {
+			continue
+		}
+
+		filePath := filepath.Join(dir, strings.TrimSuffix(name, bakFileSuffix))
+		bakFilePath := filepath.Join(dir, name)
+
+		if err = recoverBillFile(filePath, bakFilePath, crypter, logger); err != nil {
+			logger.WithFields(l.ErrorField(err), l.StringField("file", filePath)).Error("recover bill file failed")
+
+			continue
+		}
+
+		_ = os.Remove(bakFilePath)
+	}
+
+	syncDir(dir)
+}
+
+// recoverBillFile never merges the two files, the .bak file would bring back the bills removed after it
+// was written. The broken lines of a readable day file are quarantined when it is loaded.
+func recoverBillFile(filePath, bakFilePath string, crypter *Crypter, logger l.Wrapper) (err error) {
+	_, _, _, err = scanBillFile(filePath, crypter)
+	if err == nil {
+		logger.WithFields(l.StringField("file", filePath)).Warn("dropped the .bak file of a readable bill file")
+
+		return
+	}
+
+	logger.WithFields(l.ErrorField(err), l.StringField("file", filePath)).Warn("bill file unreadable")
+
+	if _, _, _, err = scanBillFile(bakFilePath, crypter); err != nil {
+		return
+	}
+
+	err = os.Rename(bakFilePath, filePath)
+	if err != nil {
+		return
+	}
+
+	logger.WithFields(l.StringField("file", filePath)).Warn("restored bill file from its .bak file")
+
+	return
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/i/l"
+	"golang.org/x/exp/slices"
+)
+
+const quarantineFileSuffix = ".bad"
+
+var errEmptyBillID = errors.New("empty bill id")
+
+type badBillLine struct {
+	lineNo int
+	data   []byte
+	err    error
+}
+
+// scanBillFile reads the bills of a day file line by line, a malformed line is reported in badLines
+// instead of failing the whole day. complete is false if the last line misses its line break.
+func scanBillFile(filePath string, crypter *Crypter) (bills []model.GroupBill, badLines []badBillLine, complete bool, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	complete = true
+
+	for lineNo := 1; ; lineNo++ {
+		var line []byte
+
+		line, err = reader.ReadBytes('\n')
+		if err == io.EOF {
+			err = nil
+
+			if len(line) == 0 {
+				break
+			}
+
+			complete = false
+		}
+
+		if err != nil {
+			return
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			if !complete {
+				break
+			}
+
+			continue
+		}
+
+		var bill model.GroupBill
+
+		d, e := crypter.openLine(line)
+		if e == nil {
+			e = json.Unmarshal(d, &bill)
+		}
+
+		if e == nil && bill.ID == "" {
+			e = errEmptyBillID
+		}
+
+		if e != nil {
+			badLines = append(badLines, badBillLine{
+				lineNo: lineNo,
+				data:   line,
+				err:    e,
+			})
+		} else {
+			bills = append(bills, bill)
+		}
+
+		if !complete {
+			break
+		}
+	}
+
+	return
+}
+
+// quarantineBadLines appends the bad lines of filePath to its side file, so they can be fixed by hand.
+// It runs once the rewrite dropping them is committed, or the lines would be appended again on every retry.
+func quarantineBadLines(filePath string, badLines []badBillLine) (err error) {
+	if len(badLines) == 0 {
+		return
+	}
+
+	file, err := os.OpenFile(filePath+quarantineFileSuffix, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+
+	for _, badLine := range badLines {
+		line := badLine.data
+		if line[len(line)-1] != '\n' {
+			line = append(slices.Clip(line), '\n')
+		}
+
+		if _, err = file.Write(line); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if e := file.Close(); err == nil {
+		err = e
+	}
+
+	return
+}
+
+func logBadBillLines(logger l.Wrapper, filePath string, badLines []badBillLine) {
+	for _, badLine := range badLines {
+		logger.WithFields(l.ErrorField(badLine.err), l.StringField("file", filePath),
+			l.IntField("line", badLine.lineNo)).Warn("skip malformed bill line")
+	}
+}
+
+type BillFileProblem struct {
+	File     string
+	BadLines int
+	Broken   bool // the last line misses its line break
+	Unsorted bool
+	Repaired bool
+}
+
+type RepairBillFilesReport struct {
+	Files    int
+	Bills    int
+	Problems []BillFileProblem
+}
+
+// RepairBillFiles scans the day files in billsRoot and reports malformed lines, a broken tail
+// and unsorted bills. If fix is set the bad lines are moved to the side file, the day file is
+// rewritten sorted, and interrupted rewrites are recovered first.
+func RepairBillFiles(billsRoot string, crypter *Crypter, fix bool, logger l.Wrapper) (report RepairBillFilesReport, err error) {
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	if fix {
+		recoverBillFiles(billsRoot, crypter, logger)
+	}
+
+	entries, err := os.ReadDir(billsRoot)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !billDayFileNameRe.MatchString(entry.Name()) {
+			continue
+		}
+
+		filePath := filepath.Join(billsRoot, entry.Name())
+
+		bills, badLines, complete, e := scanBillFile(filePath, crypter)
+		if e != nil {
+			err = e
+
+			return
+		}
+
+		report.Files++
+		report.Bills += len(bills)
+
+		problem := BillFileProblem{
+			File:     entry.Name(),
+			BadLines: len(badLines),
+			Broken:   !complete,
+			Unsorted: !slices.IsSortedFunc(bills, compareBillAt),
+		}
+
+		if problem.BadLines == 0 && !problem.Broken && !problem.Unsorted {
+			continue
+		}
+
+		logBadBillLines(logger, filePath, badLines)
+
+		if fix {
+			if err = repairBillFile(filePath, bills, badLines, crypter); err != nil {
+				return
+			}
+
+			problem.Repaired = true
+		}
+
+		report.Problems = append(report.Problems, problem)
+	}
+
+	return
+}
+
+func repairBillFile(filePath string, bills []model.GroupBill, badLines []badBillLine, crypter *Crypter) (err error) {
+	slices.SortStableFunc(bills, compareBillAt)
+
+	err = writeFileAtomic(filePath, func(w io.Writer) (e error) {
+		_, _, _, e = writeAllBillsOnFile(w, bills, crypter)
+
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	// after the rewrite is committed, a failed rewrite is retried with the same bad lines
+	err = quarantineBadLines(filePath, badLines)
+
+	return
+}
@@ -0,0 +1,490 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/godruoyi/go-snowflake"
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+)
+
+type sqlExecutor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func newSQLiteBillFile(db *sql.DB, groupID uint64, logger l.Wrapper) BillFile {
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	return &sqliteBillFileImpl{
+		db:      db,
+		groupID: int64(groupID),
+		logger:  logger.WithFields(l.StringField(l.ClsKey, "sqliteBillFileImpl")),
+	}
+}
+
+type sqliteBillFileImpl struct {
+	db      *sql.DB
+	groupID int64
+	logger  l.Wrapper
+}
+
+func newBillID(bill model.GroupBill) string {
+	return fmt.Sprintf("%s%d", time.Unix(bill.At, 0).Format("20060102"), snowflake.ID())
+}
+
+func sqliteInsertBill(executor sqlExecutor, groupID int64, bill model.GroupBill) error {
+	d, err := json.Marshal(bill)
+	if err != nil {
+		return err
+	}
+
+	_, err = executor.Exec(`INSERT INTO bills (group_id, id, day, at, data) VALUES (?, ?, ?, ?, ?)`,
+		groupID, bill.ID, time.Unix(bill.At, 0).Format("20060102"), bill.At, string(d))
+
+	return err
+}
+
+func sqliteInsertDeletedBill(executor sqlExecutor, groupID int64, bill model.DeletedGroupBill) error {
+	d, err := json.Marshal(bill)
+	if err != nil {
+		return err
+	}
+
+	_, err = executor.Exec(`INSERT INTO deleted_bills (group_id, id, deleted_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (group_id, id) DO UPDATE SET deleted_at = excluded.deleted_at, data = excluded.data`,
+		groupID, bill.ID, bill.DeletedAt.UnixNano(), string(d))
+
+	return err
+}
+
+func sqliteRecordBatch(db *sql.DB, records []GroupRecord) (billIDs []string, err error) {
+	for _, record := range records {
+		if !record.Bill.Valid() {
+			err = commerr.ErrInvalidArgument
+
+			return
+		}
+	}
+
+	err = sqliteWithTx(db, func(tx *sql.Tx) error {
+		billIDs = make([]string, 0, len(records))
+
+		for _, record := range records {
+			record.Bill.ID = newBillID(record.Bill)
+
+			if e := sqliteInsertBill(tx, int64(record.GroupID), record.Bill); e != nil {
+				return e
+			}
+
+			billIDs = append(billIDs, record.Bill.ID)
+		}
+
+		return nil
+	})
+	if err != nil {
+		billIDs = nil
+	}
+
+	return
+}
+
+func (impl *sqliteBillFileImpl) getBill(executor sqlExecutor, billID string) (bill model.GroupBill, err error) {
+	var d string
+
+	err = executor.QueryRow(`SELECT data FROM bills WHERE group_id = ? AND id = ?`, impl.groupID, billID).Scan(&d)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = commerr.ErrNotFound
+		}
+
+		return
+	}
+
+	err = json.Unmarshal([]byte(d), &bill)
+
+	return
+}
+
+func (impl *sqliteBillFileImpl) getDeletedBill(executor sqlExecutor, billID string) (bill model.DeletedGroupBill, err error) {
+	var d string
+
+	err = executor.QueryRow(`SELECT data FROM deleted_bills WHERE group_id = ? AND id = ?`,
+		impl.groupID, billID).Scan(&d)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = commerr.ErrNotFound
+		}
+
+		return
+	}
+
+	err = json.Unmarshal([]byte(d), &bill)
+
+	return
+}
+
+func (impl *sqliteBillFileImpl) queryBills(query string, args ...any) (bills []model.GroupBill, err error) {
+	rows, err := impl.db.Query(query, args...)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var d string
+
+		if err = rows.Scan(&d); err != nil {
+			return
+		}
+
+		var bill model.GroupBill
+
+		if err = json.Unmarshal([]byte(d), &bill); err != nil {
+			return
+		}
+
+		bills = append(bills, bill)
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+func (impl *sqliteBillFileImpl) AddBill(bill model.GroupBill) (billID string, err error) {
+	if !bill.Valid() {
+		err = commerr.ErrInvalidArgument
+
+		return
+	}
+
+	bill.ID = newBillID(bill)
+
+	err = sqliteInsertBill(impl.db, impl.groupID, bill)
+	if err != nil {
+		impl.logger.WithFields(l.ErrorField(err)).Error("insert bill failed")
+
+		return
+	}
+
+	billID = bill.ID
+
+	return
+}
+
+func (impl *sqliteBillFileImpl) RemoveBill(billID string) (err error) {
+	r, err := impl.db.Exec(`DELETE FROM bills WHERE group_id = ? AND id = ?`, impl.groupID, billID)
+	if err != nil {
+		return
+	}
+
+	if n, _ := r.RowsAffected(); n == 0 {
+		err = commerr.ErrNotFound
+	}
+
+	return
+}
+
+func (impl *sqliteBillFileImpl) GetBill(billID string) (bill model.GroupBill, err error) {
+	return impl.getBill(impl.db, billID)
+}
+
+func (impl *sqliteBillFileImpl) UpdateBill(bill model.GroupBill) (oldBill model.GroupBill, err error) {
+	if len(bill.ID) <= 8 || !bill.Valid() {
+		err = commerr.ErrInvalidArgument
+
+		return
+	}
+
+	err = sqliteWithTx(impl.db, func(tx *sql.Tx) (err error) {
+		oldBill, err = impl.getBill(tx, bill.ID)
+		if err != nil {
+			return
+		}
+
+		keepServerBillFields(&bill, oldBill)
+
+		d, err := json.Marshal(bill)
+		if err != nil {
+			return
+		}
+
+		_, err = tx.Exec(`UPDATE bills SET day = ?, at = ?, data = ? WHERE group_id = ? AND id = ?`,
+			time.Unix(bill.At, 0).Format("20060102"), bill.At, string(d), impl.groupID, bill.ID)
+
+		return
+	})
+
+	return
+}
+
+func (impl *sqliteBillFileImpl) ModifyBill(billID string, fnModify func(bill *model.GroupBill) error) (err error) {
+	return sqliteWithTx(impl.db, func(tx *sql.Tx) (err error) {
+		bill, err := impl.getBill(tx, billID)
+		if err != nil {
+			return
+		}
+
+		oldAt := bill.At
+
+		err = fnModify(&bill)
+		if err != nil {
+			return
+		}
+
+		if bill.ID != billID || bill.At != oldAt {
+			err = commerr.ErrInvalidArgument
+
+			return
+		}
+
+		d, err := json.Marshal(bill)
+		if err != nil {
+			return
+		}
+
+		_, err = tx.Exec(`UPDATE bills SET data = ? WHERE group_id = ? AND id = ?`, string(d), impl.groupID, billID)
+
+		return
+	})
+}
+
+func (impl *sqliteBillFileImpl) GetBills(startDate, finishDate string) (bills []model.GroupBill, err error) {
+	if len(startDate) != 0 && len(startDate) != 8 {
+		err = commerr.ErrInvalidArgument
+
+		return
+	}
+
+	if len(finishDate) != 0 && len(finishDate) != 8 {
+		err = commerr.ErrInvalidArgument
+
+		return
+	}
+
+	if finishDate == "" {
+		finishDate = "99999999"
+	}
+
+	return impl.queryBills(`SELECT data FROM bills WHERE group_id = ? AND day >= ? AND day <= ?
+		ORDER BY day, at, seq`, impl.groupID, startDate, finishDate)
+}
+
+func (impl *sqliteBillFileImpl) ListBills(id string, count int, dirNew bool) (bills []model.GroupBill, hasMore bool, err error) {
+	limit := -1
+	if count > 0 {
+		limit = count + 1
+	}
+
+	var day string
+
+	var at, seq int64
+
+	if id != "" {
+		err = impl.db.QueryRow(`SELECT day, at, seq FROM bills WHERE group_id = ? AND id = ?`,
+			impl.groupID, id).Scan(&day, &at, &seq)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+
+			// like the day files: start from the day the id was recorded on
+			if len(id) > 8 {
+				day = id[:8]
+			}
+
+			at, seq = 0, 0
+
+			if !dirNew {
+				at, seq = 1<<62, 1<<62
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+
+	switch {
+	case day == "" && dirNew:
+		bills, err = impl.queryBills(`SELECT data FROM bills WHERE group_id = ?
+			ORDER BY day, at, seq LIMIT ?`, impl.groupID, limit)
+	case day == "":
+		bills, err = impl.queryBills(`SELECT data FROM bills WHERE group_id = ?
+			ORDER BY day DESC, at DESC, seq DESC LIMIT ?`, impl.groupID, limit)
+	case dirNew:
+		bills, err = impl.queryBills(`SELECT data FROM bills WHERE group_id = ? AND (day, at, seq) > (?, ?, ?)
+			ORDER BY day, at, seq LIMIT ?`, impl.groupID, day, at, seq, limit)
+	default:
+		bills, err = impl.queryBills(`SELECT data FROM bills WHERE group_id = ? AND (day, at, seq) < (?, ?, ?)
+			ORDER BY day DESC, at DESC, seq DESC LIMIT ?`, impl.groupID, day, at, seq, limit)
+	}
+
+	if err != nil {
+		return
+	}
+
+	if count > 0 && len(bills) > count {
+		bills = bills[:count]
+		hasMore = true
+	}
+
+	return
+}
+
+func (impl *sqliteBillFileImpl) DeleteRecord(billID string, deletedBy uint64) (err error) {
+	return sqliteWithTx(impl.db, func(tx *sql.Tx) (err error) {
+		bill, err := impl.getBill(tx, billID)
+		if err != nil {
+			return
+		}
+
+		_, err = tx.Exec(`DELETE FROM bills WHERE group_id = ? AND id = ?`, impl.groupID, billID)
+		if err != nil {
+			return
+		}
+
+		err = sqliteInsertDeletedBill(tx, impl.groupID, model.DeletedGroupBill{
+			GroupBill: bill,
+			DeletedAt: time.Now(),
+			DeletedBy: deletedBy,
+		})
+
+		return
+	})
+}
+
+func (impl *sqliteBillFileImpl) AddDeletedBill(bill model.DeletedGroupBill) (billID string, err error) {
+	if !bill.Valid() {
+		err = commerr.ErrInvalidArgument
+
+		return
+	}
+
+	bill.ID = newBillID(bill.GroupBill)
+
+	err = sqliteInsertDeletedBill(impl.db, impl.groupID, bill)
+	if err != nil {
+		return
+	}
+
+	billID = bill.ID
+
+	return
+}
+
+func (impl *sqliteBillFileImpl) GetDeletedBill(billID string) (bill model.DeletedGroupBill, err error) {
+	return impl.getDeletedBill(impl.db, billID)
+}
+
+func (impl *sqliteBillFileImpl) GetDeletedBills() (bills []model.DeletedGroupBill, err error) {
+	rows, err := impl.db.Query(`SELECT data FROM deleted_bills WHERE group_id = ? ORDER BY deleted_at DESC`,
+		impl.groupID)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var d string
+
+		if err = rows.Scan(&d); err != nil {
+			return
+		}
+
+		var bill model.DeletedGroupBill
+
+		if err = json.Unmarshal([]byte(d), &bill); err != nil {
+			return
+		}
+
+		bills = append(bills, bill)
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+func (impl *sqliteBillFileImpl) RemoveDeletedBillHistory(billID string) (err error) {
+	r, err := impl.db.Exec(`DELETE FROM deleted_bills WHERE group_id = ? AND id = ?`, impl.groupID, billID)
+	if err != nil {
+		return
+	}
+
+	if n, _ := r.RowsAffected(); n == 0 {
+		err = commerr.ErrNotFound
+	}
+
+	return
+}
+
+func (impl *sqliteBillFileImpl) RestoreDeletedBill(billID string) error {
+	return sqliteWithTx(impl.db, func(tx *sql.Tx) (err error) {
+		bill, err := impl.getDeletedBill(tx, billID)
+		if err != nil {
+			return
+		}
+
+		bill.ID = newBillID(bill.GroupBill)
+
+		err = sqliteInsertBill(tx, impl.groupID, bill.GroupBill)
+		if err != nil {
+			return
+		}
+
+		_, err = tx.Exec(`DELETE FROM deleted_bills WHERE group_id = ? AND id = ?`, impl.groupID, billID)
+
+		return
+	})
+}
+
+func (impl *sqliteBillFileImpl) PurgeDeletedBills(deletedBefore time.Time) (bills []model.DeletedGroupBill, err error) {
+	err = sqliteWithTx(impl.db, func(tx *sql.Tx) (err error) {
+		rows, err := tx.Query(`SELECT data FROM deleted_bills WHERE group_id = ? AND deleted_at < ?`,
+			impl.groupID, deletedBefore.UnixNano())
+		if err != nil {
+			return
+		}
+
+		for rows.Next() {
+			var d string
+
+			if err = rows.Scan(&d); err != nil {
+				break
+			}
+
+			var bill model.DeletedGroupBill
+
+			if err = json.Unmarshal([]byte(d), &bill); err != nil {
+				break
+			}
+
+			bills = append(bills, bill)
+		}
+
+		_ = rows.Close()
+
+		if err != nil {
+			return
+		}
+
+		_, err = tx.Exec(`DELETE FROM deleted_bills WHERE group_id = ? AND deleted_at < ?`,
+			impl.groupID, deletedBefore.UnixNano())
+
+		return
+	})
+	if err != nil {
+		bills = nil
+	}
+
+	return
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/stg"
+	"golang.org/x/exp/slices"
+)
+
+const encryptionKeySize = 32
+
+var (
+	sealedFileMagic  = []byte("LCENC1\n") // whole files: magic, nonce and the sealed content
+	sealedLinePrefix = []byte("!")        // bill lines: prefix and the base64 of nonce and the sealed line
+
+	errNotSealed = errors.New("data is not encrypted")
+)
+
+// Crypter seals the data files with AES-256-GCM. A nil Crypter keeps the data in plaintext.
+type Crypter struct {
+	aead cipher.AEAD
+}
+
+func NewCrypter(key []byte) (*Crypter, error) {
+	if len(key) != encryptionKeySize {
+		return nil, fmt.Errorf("%w: encryption key must be %d bytes", commerr.ErrInvalidArgument, encryptionKeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Crypter{aead: aead}, nil
+}
+
+func (crypter *Crypter) seal(d []byte) []byte {
+	nonce := make([]byte, crypter.aead.NonceSize(), crypter.aead.NonceSize()+len(d)+crypter.aead.Overhead())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		panic(err)
+	}
+
+	return crypter.aead.Seal(nonce, nonce, d, nil)
+}
+
+func (crypter *Crypter) open(d []byte) ([]byte, error) {
+	if len(d) < crypter.aead.NonceSize() {
+		return nil, commerr.ErrBadFormat
+	}
+
+	return crypter.aead.Open(nil, d[:crypter.aead.NonceSize()], d[crypter.aead.NonceSize():], nil)
+}
+
+// SealFile returns the content of a whole file to write.
+func (crypter *Crypter) SealFile(d []byte) []byte {
+	if crypter == nil {
+		return d
+	}
+
+	return append(slices.Clone(sealedFileMagic), crypter.seal(d)...)
+}
+
+// OpenFile returns the plaintext of a whole file read.
+func (crypter *Crypter) OpenFile(d []byte) ([]byte, error) {
+	if crypter == nil {
+		return d, nil
+	}
+
+	if !isSealedFile(d) {
+		return nil, errNotSealed
+	}
+
+	return crypter.open(d[len(sealedFileMagic):])
+}
+
+// sealLine returns the bill file line of the JSON d, without the line break.
+func (crypter *Crypter) sealLine(d []byte) []byte {
+	if crypter == nil {
+		return d
+	}
+
+	sealed := crypter.seal(d)
+
+	line := make([]byte, len(sealedLinePrefix)+base64.StdEncoding.EncodedLen(len(sealed)))
+	copy(line, sealedLinePrefix)
+	base64.StdEncoding.Encode(line[len(sealedLinePrefix):], sealed)
+
+	return line
+}
+
+// openLine returns the JSON of a bill file line, the line break is ignored.
+func (crypter *Crypter) openLine(line []byte) ([]byte, error) {
+	if crypter == nil {
+		return line, nil
+	}
+
+	line = bytes.TrimRight(line, "\r\n")
+	if !isSealedLine(line) {
+		return nil, errNotSealed
+	}
+
+	sealed := make([]byte, base64.StdEncoding.DecodedLen(len(line)-len(sealedLinePrefix)))
+
+	n, err := base64.StdEncoding.Decode(sealed, line[len(sealedLinePrefix):])
+	if err != nil {
+		return nil, err
+	}
+
+	return crypter.open(sealed[:n])
+}
+
+func isSealedFile(d []byte) bool {
+	return bytes.HasPrefix(d, sealedFileMagic)
+}
+
+func isSealedLine(line []byte) bool {
+	return bytes.HasPrefix(line, sealedLinePrefix)
+}
+
+func readSealedFile(filePath string, crypter *Crypter) ([]byte, error) {
+	d, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return crypter.OpenFile(d)
+}
+
+func writeSealedFileAtomic(filePath string, d []byte, crypter *Crypter) error {
+	return writeFileAtomic(filePath, func(w io.Writer) error {
+		_, err := w.Write(crypter.SealFile(d))
+
+		return err
+	})
+}
+
+//
+//
+//
+
+// NewEncryptedFileStorage seals the files of fileStorage with crypter, a nil crypter returns fileStorage as is.
+func NewEncryptedFileStorage(fileStorage stg.FileStorage, crypter *Crypter) stg.FileStorage {
+	if crypter == nil {
+		return fileStorage
+	}
+
+	return &encryptedFileStorage{
+		fileStorage: fileStorage,
+		crypter:     crypter,
+	}
+}
+
+type encryptedFileStorage struct {
+	fileStorage stg.FileStorage
+	crypter     *Crypter
+}
+
+func (fs *encryptedFileStorage) WriteFile(name string, d []byte) error {
+	return fs.fileStorage.WriteFile(name, fs.crypter.SealFile(d))
+}
+
+func (fs *encryptedFileStorage) ReadFile(name string) ([]byte, error) {
+	d, err := fs.fileStorage.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.crypter.OpenFile(d)
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+)
+
+// CheckEncryption makes sure the data in dataRoot is encrypted with crypter, or is plaintext if crypter
+// is nil, so a wrong or missing key never makes the storage take the data as empty.
+func CheckEncryption(dataRoot string, crypter *Crypter) error {
+	d, err := os.ReadFile(filepath.Join(dataRoot, organizationFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	switch {
+	case isSealedFile(d) && crypter == nil:
+		return fmt.Errorf("%w: the data is encrypted but no encryption key is configured", commerr.ErrInvalidArgument)
+	case !isSealedFile(d) && crypter != nil:
+		return fmt.Errorf("%w: the data is not encrypted yet, encrypt the data directory first", commerr.ErrInvalidArgument)
+	case crypter != nil:
+		if _, err = crypter.OpenFile(d); err != nil {
+			return fmt.Errorf("%w: wrong encryption key: %v", commerr.ErrInvalidArgument, err)
+		}
+	}
+
+	return nil
+}
+
+// EncryptDataDir encrypts the plaintext files of the file storage in dataRoot in place: the organization,
+// the tmp data, the bill day files, their quarantine files and the deleted bills files, plus extraFiles
+// in dataRoot such as the statistics. Encrypted files are skipped so an interrupted run can be repeated.
+func EncryptDataDir(dataRoot string, crypter *Crypter, extraFiles []string, logger l.Wrapper) (count int, err error) {
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	if crypter == nil {
+		err = commerr.ErrInvalidArgument
+
+		return
+	}
+
+	// a run interrupted after the organization is encrypted must go on with the same key
+	if d, e := os.ReadFile(filepath.Join(dataRoot, organizationFileName)); e == nil && isSealedFile(d) {
+		if _, err = crypter.OpenFile(d); err != nil {
+			err = fmt.Errorf("%w: the data is encrypted with another key", commerr.ErrInvalidArgument)
+
+			return
+		}
+	}
+
+	billsRoot := filepath.Join(dataRoot, "bills")
+
+	recoverBillFiles(billsRoot, nil, logger)
+
+	entries, err := os.ReadDir(billsRoot)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+
+	err = nil
+
+	var filePaths []string
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		filePath := filepath.Join(billsRoot, entry.Name())
+
+		var encrypted bool
+
+		switch {
+		case billDayFileNameRe.MatchString(entry.Name()),
+			billDayFileNameRe.MatchString(strings.TrimSuffix(entry.Name(), quarantineFileSuffix)):
+			encrypted, err = encryptBillLines(filePath, crypter)
+		case deletedBillsFileNameRe.MatchString(entry.Name()):
+			filePaths = append(filePaths, filePath)
+		}
+
+		if err != nil {
+			err = fmt.Errorf("%s: %w", entry.Name(), err)
+
+			return
+		}
+
+		if encrypted {
+			count++
+		}
+	}
+
+	for _, name := range append([]string{tmpDataFileName, schemaVersionFileName}, extraFiles...) {
+		filePaths = append(filePaths, filepath.Join(dataRoot, name))
+	}
+
+	// the organization is the last one: the storage takes the data as encrypted once it is
+	filePaths = append(filePaths, filepath.Join(dataRoot, organizationFileName))
+
+	for _, filePath := range filePaths {
+		encrypted, e := encryptWholeFile(filePath, crypter)
+		if e != nil {
+			err = fmt.Errorf("%s: %w", filePath, e)
+
+			return
+		}
+
+		if encrypted {
+			count++
+		}
+	}
+
+	logger.WithFields(l.IntField("files", count)).Info("data directory encrypted")
+
+	return
+}
+
+func encryptWholeFile(filePath string, crypter *Crypter) (encrypted bool, err error) {
+	d, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return
+	}
+
+	if isSealedFile(d) {
+		return
+	}
+
+	err = writeSealedFileAtomic(filePath, d, crypter)
+	encrypted = err == nil
+
+	return
+}
+
+func encryptBillLines(filePath string, crypter *Crypter) (encrypted bool, err error) {
+	d, err := os.ReadFile(filePath)
+	if err != nil {
+		return
+	}
+
+	lines := bytes.SplitAfter(d, []byte("\n"))
+
+	for idx, line := range lines {
+		content := bytes.TrimRight(line, "\r\n")
+		if len(bytes.TrimSpace(content)) == 0 || isSealedLine(content) {
+			continue
+		}
+
+		lines[idx] = append(crypter.sealLine(content), '\n')
+		encrypted = true
+	}
+
+	if !encrypted {
+		return
+	}
+
+	err = writeFileAtomic(filePath, func(w io.Writer) error {
+		for _, line := range lines {
+			if _, e := w.Write(line); e != nil {
+				return e
+			}
+		}
+
+		return nil
+	})
+
+	return
+}
@@ -13,6 +13,12 @@ type Organization struct {
 
 	Merchants      map[uint64]model.CostDir
 	GroupMerchants map[uint64]map[uint64]model.CostDir
+
+	RecurringRules map[uint64]model.RecurringRule
+
+	AttachmentRefs map[string]int
+
+	ExchangeRates map[string]map[string]float64 // FROM/TO - YYYYMMDD - rate
 }
 
 func NewOrganization() *Organization {
@@ -31,6 +37,9 @@ func (organization *Organization) reset() {
 	organization.GroupLabels = nil
 	organization.Merchants = nil
 	organization.GroupMerchants = nil
+	organization.RecurringRules = nil
+	organization.AttachmentRefs = nil
+	organization.ExchangeRates = nil
 
 	organization.valid()
 }
@@ -63,6 +72,18 @@ func (organization *Organization) valid() {
 	if organization.GroupMerchants == nil {
 		organization.GroupMerchants = make(map[uint64]map[uint64]model.CostDir)
 	}
+
+	if organization.RecurringRules == nil {
+		organization.RecurringRules = make(map[uint64]model.RecurringRule)
+	}
+
+	if organization.AttachmentRefs == nil {
+		organization.AttachmentRefs = make(map[string]int)
+	}
+
+	if organization.ExchangeRates == nil {
+		organization.ExchangeRates = make(map[string]map[string]float64)
+	}
 }
 
 type GroupEnterInfo struct {
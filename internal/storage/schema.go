@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/i/stg"
+	"github.com/sgostarter/libeasygo/stg/fs/rawfs"
+)
+
+const (
+	organizationFileName  = "organization"
+	schemaVersionFileName = "schema-version"
+
+	// CurrentSchemaVersion is the version of the data written by this code, 0 is the unversioned data
+	// of the first releases.
+	CurrentSchemaVersion = 1
+)
+
+type jsonObject = map[string]json.RawMessage
+
+// schemaMigration upgrades the data from version-1 to version. Migrations work on the raw JSON so they
+// don't depend on the current models, and must be idempotent: an interrupted upgrade is run again.
+type schemaMigration struct {
+	version      int
+	description  string
+	organization func(org jsonObject) (changed bool, err error)  // nil: untouched
+	bill         func(bill jsonObject) (changed bool, err error) // bills and deleted bills, nil: untouched
+}
+
+var schemaMigrations = []schemaMigration{
+	{
+		version:     1,
+		description: "rename the bill field coastDir to costDir",
+		bill:        renameJSONField("coastDir", "costDir"),
+	},
+}
+
+func renameJSONField(from, to string) func(object jsonObject) (bool, error) {
+	return func(object jsonObject) (changed bool, err error) {
+		v, ok := object[from]
+		if !ok {
+			return
+		}
+
+		if _, ok = object[to]; !ok {
+			object[to] = v
+		}
+
+		delete(object, from)
+
+		changed = true
+
+		return
+	}
+}
+
+type SchemaMigrationStep struct {
+	Version      int
+	Description  string
+	Organization bool // the organization is changed
+	Bills        int  // changed bills, deleted bills included
+}
+
+type SchemaMigrationReport struct {
+	FromVersion int
+	ToVersion   int
+	Steps       []SchemaMigrationStep
+}
+
+type schemaStore interface {
+	stg.FileStorage
+
+	// rewriteBills calls fn on every bill and deleted bill and saves the changed ones unless dryRun.
+	rewriteBills(fn func(bill jsonObject) (changed bool, err error), dryRun bool) error
+}
+
+// MigrateSchema upgrades the file storage in dataRoot to CurrentSchemaVersion, with dryRun nothing is written.
+func MigrateSchema(dataRoot string, crypter *Crypter, dryRun bool, logger l.Wrapper) (report SchemaMigrationReport,
+	err error) {
+	return migrateSchema(&fileSchemaStore{
+		FileStorage: NewEncryptedFileStorage(rawfs.NewFSStorage(dataRoot), crypter),
+		billsRoot:   filepath.Join(dataRoot, "bills"),
+		crypter:     crypter,
+	}, dryRun, logger)
+}
+
+func migrateSchema(store schemaStore, dryRun bool, logger l.Wrapper) (report SchemaMigrationReport, err error) {
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	report.FromVersion, err = readSchemaVersion(store)
+	if err != nil {
+		return
+	}
+
+	report.ToVersion = CurrentSchemaVersion
+
+	if report.FromVersion > CurrentSchemaVersion {
+		err = fmt.Errorf("%w: data schema version %d is newer than %d", commerr.ErrUnimplemented,
+			report.FromVersion, CurrentSchemaVersion)
+
+		return
+	}
+
+	if report.FromVersion == CurrentSchemaVersion {
+		return
+	}
+
+	migrations := schemaMigrations[report.FromVersion:]
+
+	for _, migration := range migrations {
+		report.Steps = append(report.Steps, SchemaMigrationStep{
+			Version:     migration.version,
+			Description: migration.description,
+		})
+	}
+
+	err = migrateOrganization(store, migrations, report.Steps, dryRun)
+	if err != nil {
+		return
+	}
+
+	err = store.rewriteBills(func(bill jsonObject) (changed bool, err error) {
+		for idx, migration := range migrations {
+			if migration.bill == nil {
+				continue
+			}
+
+			stepChanged, e := migration.bill(bill)
+			if e != nil {
+				return false, e
+			}
+
+			if stepChanged {
+				report.Steps[idx].Bills++
+				changed = true
+			}
+		}
+
+		return
+	}, dryRun)
+	if err != nil {
+		return
+	}
+
+	for _, step := range report.Steps {
+		logger.WithFields(l.IntField("version", step.Version), l.StringField("description", step.Description),
+			l.BoolField("organization", step.Organization), l.IntField("bills", step.Bills),
+			l.BoolField("dryRun", dryRun)).Info("schema migration step")
+	}
+
+	if dryRun {
+		return
+	}
+
+	err = writeSchemaVersion(store, CurrentSchemaVersion)
+
+	return
+}
+
+func migrateOrganization(store schemaStore, migrations []schemaMigration, steps []SchemaMigrationStep,
+	dryRun bool) (err error) {
+	d, err := store.ReadFile(organizationFileName)
+	if err != nil {
+		if isNotExist(err) {
+			err = nil
+		}
+
+		return
+	}
+
+	var org jsonObject
+
+	if err = json.Unmarshal(d, &org); err != nil {
+		return
+	}
+
+	var changed bool
+
+	for idx, migration := range migrations {
+		if migration.organization == nil {
+			continue
+		}
+
+		stepChanged, e := migration.organization(org)
+		if e != nil {
+			return e
+		}
+
+		steps[idx].Organization = stepChanged
+		changed = changed || stepChanged
+	}
+
+	if !changed || dryRun {
+		return
+	}
+
+	d, err = json.Marshal(org)
+	if err != nil {
+		return
+	}
+
+	err = store.WriteFile(organizationFileName, d)
+
+	return
+}
+
+type schemaVersionFile struct {
+	Version int `json:"version"`
+}
+
+func readSchemaVersion(fileStorage stg.FileStorage) (version int, err error) {
+	d, err := fileStorage.ReadFile(schemaVersionFileName)
+	if err != nil {
+		if isNotExist(err) {
+			err = nil
+		}
+
+		return
+	}
+
+	var versionFile schemaVersionFile
+
+	err = json.Unmarshal(d, &versionFile)
+	version = versionFile.Version
+
+	return
+}
+
+func encodeSchemaVersion(version int) ([]byte, error) {
+	return json.Marshal(schemaVersionFile{Version: version})
+}
+
+func writeSchemaVersion(fileStorage stg.FileStorage, version int) error {
+	d, err := encodeSchemaVersion(version)
+	if err != nil {
+		return err
+	}
+
+	return fileStorage.WriteFile(schemaVersionFileName, d)
+}
+
+func isNotExist(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, commerr.ErrNotFound)
+}
+
+//
+//
+//
+
+var deletedBillsFileNameRe = regexp.MustCompile(`^\d+-` + deletedFileName + `$`)
+
+type fileSchemaStore struct {
+	stg.FileStorage
+
+	billsRoot string
+	crypter   *Crypter
+}
+
+func (store *fileSchemaStore) rewriteBills(fn func(bill jsonObject) (changed bool, err error), dryRun bool) error {
+	entries, err := os.ReadDir(store.billsRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		filePath := filepath.Join(store.billsRoot, entry.Name())
+
+		switch {
+		case billDayFileNameRe.MatchString(entry.Name()):
+			err = store.rewriteDayFile(filePath, fn, dryRun)
+		case deletedBillsFileNameRe.MatchString(entry.Name()):
+			err = store.rewriteDeletedBillsFile(filePath, fn, dryRun)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+func (store *fileSchemaStore) rewriteDayFile(filePath string, fn func(bill jsonObject) (bool, error),
+	dryRun bool) (err error) {
+	d, err := os.ReadFile(filePath)
+	if err != nil {
+		return
+	}
+
+	lines := bytes.SplitAfter(d, []byte("\n"))
+
+	var changed bool
+
+	for idx, line := range lines {
+		var bill jsonObject
+
+		// malformed lines are left to the repair mode
+		lineJSON, e := store.crypter.openLine(line)
+		if e != nil || json.Unmarshal(lineJSON, &bill) != nil {
+			continue
+		}
+
+		lineChanged, e := fn(bill)
+		if e != nil {
+			return e
+		}
+
+		if !lineChanged {
+			continue
+		}
+
+		if lineJSON, err = json.Marshal(bill); err != nil {
+			return
+		}
+
+		lines[idx] = append(store.crypter.sealLine(lineJSON), '\n')
+		changed = true
+	}
+
+	if !changed || dryRun {
+		return
+	}
+
+	err = writeFileAtomic(filePath, func(w io.Writer) error {
+		for _, line := range lines {
+			if _, e := w.Write(line); e != nil {
+				return e
+			}
+		}
+
+		return nil
+	})
+
+	return
+}
+
+func (store *fileSchemaStore) rewriteDeletedBillsFile(filePath string, fn func(bill jsonObject) (bool, error),
+	dryRun bool) (err error) {
+	d, err := readSealedFile(filePath, store.crypter)
+	if err != nil {
+		return
+	}
+
+	var bills map[string]jsonObject
+
+	if err = json.Unmarshal(d, &bills); err != nil {
+		return
+	}
+
+	var changed bool
+
+	for _, bill := range bills {
+		billChanged, e := fn(bill)
+		if e != nil {
+			return e
+		}
+
+		changed = changed || billChanged
+	}
+
+	if !changed || dryRun {
+		return
+	}
+
+	d, err = json.Marshal(bills)
+	if err != nil {
+		return
+	}
+
+	err = writeSealedFileAtomic(filePath, d, store.crypter)
+
+	return
+}
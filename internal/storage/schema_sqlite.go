@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/sgostarter/i/l"
+)
+
+// MigrateSQLiteSchema upgrades the sqlite database dbPath to CurrentSchemaVersion, with dryRun nothing is written.
+func MigrateSQLiteSchema(dbPath string, dryRun bool, logger l.Wrapper) (report SchemaMigrationReport, err error) {
+	db, err := openSQLite(dbPath)
+	if err != nil {
+		return
+	}
+
+	defer db.Close()
+
+	return migrateSchema(&sqliteSchemaStore{
+		sqliteFileStorage: sqliteFileStorage{db: db},
+	}, dryRun, logger)
+}
+
+type sqliteSchemaStore struct {
+	sqliteFileStorage
+}
+
+func (store *sqliteSchemaStore) rewriteBills(fn func(bill jsonObject) (changed bool, err error), dryRun bool) error {
+	return sqliteWithTx(store.db, func(tx *sql.Tx) (err error) {
+		for _, table := range []string{"bills", "deleted_bills"} {
+			if err = store.rewriteTable(tx, table, fn, dryRun); err != nil {
+				return
+			}
+		}
+
+		return
+	})
+}
+
+func (store *sqliteSchemaStore) rewriteTable(tx *sql.Tx, table string, fn func(bill jsonObject) (bool, error),
+	dryRun bool) (err error) {
+	rows, err := tx.Query(`SELECT group_id, id, data FROM ` + table)
+	if err != nil {
+		return
+	}
+
+	type changedBill struct {
+		groupID int64
+		id      string
+		data    []byte
+	}
+
+	var changedBills []changedBill
+
+	for rows.Next() {
+		var bill changedBill
+
+		var d string
+
+		if err = rows.Scan(&bill.groupID, &bill.id, &d); err != nil {
+			break
+		}
+
+		var object jsonObject
+
+		if err = json.Unmarshal([]byte(d), &object); err != nil {
+			break
+		}
+
+		var changed bool
+
+		if changed, err = fn(object); err != nil {
+			break
+		}
+
+		if !changed {
+			continue
+		}
+
+		if bill.data, err = json.Marshal(object); err != nil {
+			break
+		}
+
+		changedBills = append(changedBills, bill)
+	}
+
+	if err == nil {
+		err = rows.Err()
+	}
+
+	_ = rows.Close()
+
+	if err != nil || dryRun {
+		return
+	}
+
+	for _, bill := range changedBills {
+		_, err = tx.Exec(`UPDATE `+table+` SET data = ? WHERE group_id = ? AND id = ?`,
+			string(bill.data), bill.groupID, bill.id)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
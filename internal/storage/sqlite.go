@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/i/stg"
+	"github.com/sgostarter/libeasygo/pathutils"
+	_ "modernc.org/sqlite" // pure go sqlite driver
+)
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS files (
+		name TEXT PRIMARY KEY,
+		data BLOB NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS bills (
+		seq      INTEGER PRIMARY KEY AUTOINCREMENT,
+		group_id INTEGER NOT NULL,
+		id       TEXT NOT NULL,
+		day      TEXT NOT NULL,
+		at       INTEGER NOT NULL,
+		data     TEXT NOT NULL,
+		UNIQUE (group_id, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS bills_group_day_at ON bills (group_id, day, at, seq)`,
+	`CREATE TABLE IF NOT EXISTS deleted_bills (
+		group_id   INTEGER NOT NULL,
+		id         TEXT NOT NULL,
+		deleted_at INTEGER NOT NULL,
+		data       TEXT NOT NULL,
+		PRIMARY KEY (group_id, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS deleted_bills_group_deleted_at ON deleted_bills (group_id, deleted_at)`,
+}
+
+// NewSQLiteStorage keeps the organization and the bills in the sqlite database dbPath,
+// the attachments and the temporary data stay in dataRoot.
+func NewSQLiteStorage(dataRoot, dbPath string, debug bool, logger l.Wrapper) (Storage, error) {
+	db, err := openSQLite(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	impl := newStorageImpl(dataRoot, debug, nil, logger, &sqliteFileStorage{db: db},
+		func(groupID uint64, logger l.Wrapper) BillFile {
+			return newSQLiteBillFile(db, groupID, logger)
+		})
+
+	impl.batchRecorder = func(records []GroupRecord) ([]string, error) {
+		return sqliteRecordBatch(db, records)
+	}
+
+	impl.fnClose = func() {
+		_ = db.Close()
+	}
+
+	return impl, nil
+}
+
+func openSQLite(dbPath string) (db *sql.DB, err error) {
+	_ = pathutils.MustDirOfFileExists(dbPath)
+
+	db, err = sql.Open("sqlite", "file:"+dbPath+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return
+	}
+
+	// sqlite serializes writers anyway, a single connection avoids SQLITE_BUSY between our own goroutines
+	db.SetMaxOpenConns(1)
+
+	for _, statement := range sqliteSchema {
+		if _, err = db.Exec(statement); err != nil {
+			_ = db.Close()
+
+			return
+		}
+	}
+
+	return
+}
+
+func sqliteWithTx(db *sql.DB, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+
+	err = fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+
+		return
+	}
+
+	err = tx.Commit()
+
+	return
+}
+
+//
+//
+//
+
+type sqliteFileStorage struct {
+	db *sql.DB
+}
+
+func (fs *sqliteFileStorage) WriteFile(name string, d []byte) error {
+	_, err := fs.db.Exec(`INSERT INTO files (name, data) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET data = excluded.data`, name, d)
+
+	return err
+}
+
+func (fs *sqliteFileStorage) ReadFile(name string) (d []byte, err error) {
+	err = fs.db.QueryRow(`SELECT data FROM files WHERE name = ?`, name).Scan(&d)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = commerr.ErrNotFound
+	}
+
+	return
+}
+
+var _ stg.FileStorage = (*sqliteFileStorage)(nil)
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/stg/fs/rawfs"
+)
+
+// MigrateToSQLite imports the organization, the bills and the deleted bills of the file storage in dataRoot
+// into the empty sqlite database dbPath, keeping the bill IDs. Nothing is written if any step fails.
+// The file storage is upgraded to CurrentSchemaVersion first.
+func MigrateToSQLite(dataRoot, dbPath string, logger l.Wrapper) (billCount int, err error) {
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	if d, e := rawfs.NewFSStorage(dataRoot).ReadFile(organizationFileName); e == nil && isSealedFile(d) {
+		err = fmt.Errorf("%w: the encrypted data can't be migrated to sqlite", commerr.ErrUnimplemented)
+
+		return
+	}
+
+	_, err = MigrateSchema(dataRoot, nil, false, logger)
+	if err != nil {
+		return
+	}
+
+	organization, err := rawfs.NewFSStorage(dataRoot).ReadFile(organizationFileName)
+	if err != nil {
+		return
+	}
+
+	fileStorage := NewStorage(dataRoot, false, logger)
+	defer fileStorage.Close()
+
+	groupIDs, err := fileStorage.GetGroupIDs()
+	if err != nil {
+		return
+	}
+
+	db, err := openSQLite(dbPath)
+	if err != nil {
+		return
+	}
+
+	defer db.Close()
+
+	var existsCount int
+
+	err = db.QueryRow(`SELECT (SELECT COUNT(*) FROM files) + (SELECT COUNT(*) FROM bills) +
+		(SELECT COUNT(*) FROM deleted_bills)`).Scan(&existsCount)
+	if err != nil {
+		return
+	}
+
+	if existsCount > 0 {
+		err = fmt.Errorf("%w: %s is not empty", commerr.ErrAlreadyExists, dbPath)
+
+		return
+	}
+
+	err = sqliteWithTx(db, func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(`INSERT INTO files (name, data) VALUES (?, ?)`, organizationFileName, organization)
+		if err != nil {
+			return
+		}
+
+		version, e := encodeSchemaVersion(CurrentSchemaVersion)
+		if e != nil {
+			return e
+		}
+
+		_, err = tx.Exec(`INSERT INTO files (name, data) VALUES (?, ?)`, schemaVersionFileName, version)
+		if err != nil {
+			return
+		}
+
+		for _, groupID := range groupIDs {
+			bills, e := fileStorage.GetBills(groupID)
+			if e != nil {
+				return e
+			}
+
+			for _, bill := range bills {
+				if err = sqliteInsertBill(tx, int64(groupID), bill); err != nil {
+					return
+				}
+			}
+
+			deletedBills, e := fileStorage.GetDeletedBills(groupID)
+			if e != nil {
+				return e
+			}
+
+			for _, bill := range deletedBills {
+				if err = sqliteInsertDeletedBill(tx, int64(groupID), bill); err != nil {
+					return
+				}
+			}
+
+			logger.WithFields(l.UInt64Field("groupID", groupID), l.IntField("bills", len(bills)),
+				l.IntField("deletedBills", len(deletedBills))).Info("group migrated")
+
+			billCount += len(bills)
+		}
+
+		return
+	})
+
+	return
+}
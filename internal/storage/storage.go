@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"strconv"
@@ -13,6 +15,7 @@ import (
 	"github.com/s-min-sys/lifecostbe/internal/model"
 	"github.com/sgostarter/i/commerr"
 	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/i/stg"
 	"github.com/sgostarter/libeasygo/pathutils"
 	"github.com/sgostarter/libeasygo/stg/fs/rawfs"
 	"github.com/sgostarter/libeasygo/stg/mwf"
@@ -21,8 +24,15 @@ import (
 
 const (
 	maxTmpDataDuration = time.Hour * 24 * 7
+
+	tmpDataFileName = "etd"
 )
 
+type GroupRecord struct {
+	GroupID uint64
+	Bill    model.GroupBill
+}
+
 type MerchantPersonInfo struct {
 	PersonID uint64
 	CostDir  model.CostDir
@@ -32,10 +42,15 @@ type Storage interface {
 	NewPerson(name string) (personID, defaultWalletID uint64, err error)
 	NewPersonEx(name string, suggestPersonID uint64) (personID, defaultWalletID uint64, err error)
 	GetPersonName(personID uint64) (name string, err error)
+	GetPersonIDByName(name string) (personID uint64, err error)
 	GetPersonGroupsIDs(personID uint64) (groupIDs []uint64, err error)
 	GetPersonWalletIDs(personID uint64) (subWalletIDs []uint64, err error)
 	SetPersonMerchant(personID uint64, costDir model.CostDir) error
 	SetPersonGroupMerchant(personID, groupID uint64, costDir model.CostDir) error
+	RemovePersonMerchant(personID uint64) error
+	// RemovePerson removes the person in no group with its wallets and merchant settings, e.g. to roll back
+	// an import.
+	RemovePerson(personID uint64) error
 	GetMerchantPersons() (merchants []MerchantPersonInfo)
 	IsMerchantPerson(personID uint64) (dir model.CostDir, ok bool)
 	GetGroupMerchantPersons(groupID uint64) (merchants []MerchantPersonInfo)
@@ -48,21 +63,39 @@ type Storage interface {
 	IsGroupAdmin(groupID, personID uint64) (adminFlag bool, err error)
 	GetGroupPersonIDs(groupID uint64) (personIDs, adminIDs []uint64, err error)
 	GetGroupNames(groupIDs []uint64) (names []string, err error)
+	GetGroupIDs() (groupIDs []uint64, err error)
+	// RemoveGroup removes the group with its bills, deleted bills, labels and merchants, e.g. to roll back an import.
+	RemoveGroup(groupID uint64) error
 
 	NewWallet(name string, personID uint64) (id uint64, err error)
 	GetWallet(walletID uint64) (wallet model.Wallet, err error)
+	SetWalletCurrency(walletID uint64, currency string) error
+	RemoveWallet(walletID uint64) error
+
+	SetGroupBaseCurrency(groupID uint64, currency string) error
+	GetGroupBaseCurrency(groupID uint64) (currency string, err error)
+	SetExchangeRate(rate model.ExchangeRate) error
+	GetExchangeRates() (rates []model.ExchangeRate, err error)
+	GetExchangeRate(from, to string, at time.Time) (rate float64, err error)
 
 	NewLabel(name string) (id uint64, err error)
 	GetLabels() (labels []model.Label, err error)
 	GetLabelName(id uint64) (name string, err error)
+	RemoveLabel(id uint64) error
 
 	NewGroupLabel(groupID uint64, name string) (id uint64, err error)
 	GetGroupLabels(groupID uint64) (labels []model.Label, err error)
 	GetGroupLabelName(labelID, groupID uint64) (name string, err error)
 
-	Record(groupID uint64, groupBill model.GroupBill) error
+	Record(groupID uint64, groupBill model.GroupBill) (billID string, err error)
+	RecordBatch(records []GroupRecord) (billIDs []string, err error) // all or nothing
 	GetBill(groupID uint64, billID string) (bill model.GroupBill, err error)
-	DeleteRecord(groupID uint64, recordID string) error
+	// UpdateRecord replaces the bill, its attachments, operation person and settlement mark are kept
+	UpdateRecord(groupID uint64, groupBill model.GroupBill) (oldBill model.GroupBill, err error)
+	DeleteRecord(groupID uint64, recordID string, deletedBy uint64) error
+	// AddDeletedBill adds the bill to the deleted bills with a new ID, its DeletedAt and DeletedBy are kept,
+	// e.g. to import it.
+	AddDeletedBill(groupID uint64, bill model.DeletedGroupBill) (billID string, err error)
 	GetBills(groupID uint64) ([]model.GroupBill, error)
 	GetBillsEx(groupID uint64, startYear, startMonth, startDay, finishYear,
 		finishMonth, finishDay int) ([]model.GroupBill, error)
@@ -72,29 +105,95 @@ type Storage interface {
 	GetDeletedBill(groupID uint64, billID string) (bill model.DeletedGroupBill, err error)
 	CleanDeletedBill(groupID uint64, billID string) (err error)
 	RestoreDeletedBill(groupID uint64, billID string) (err error)
+	PurgeDeletedBills(groupID uint64, deletedBefore time.Time) (count int, err error)
+
+	SaveAttachment(name, contentType string, d []byte) (attachment model.Attachment, err error)
+	ReleaseAttachment(attachmentID string)
+	ReadAttachment(attachmentID string) (d []byte, err error)
+	AddBillAttachment(groupID uint64, billID string, attachment model.Attachment) error
+	RemoveBillAttachment(groupID uint64, billID string, attachmentID string) error
+	HasBillAttachment(groupID uint64, billID, attachmentID string) (ok bool, err error)
+
+	NewRecurringRule(rule model.RecurringRule) (id uint64, err error)
+	GetRecurringRule(ruleID uint64) (rule model.RecurringRule, err error)
+	GetRecurringRules(personID uint64) (rules []model.RecurringRule, err error) // personID 0: all persons
+	PauseRecurringRule(ruleID uint64, paused bool) error
+	SetRecurringRuleLastRunAt(ruleID uint64, lastRunAt int64) error
+	DeleteRecurringRule(ruleID uint64) error
 
 	AddGroupEnterCodes(enterCodes []string, personID, groupID uint64, duration time.Duration) (err error)
 	ActiveGroupEnterCode(enterCode string) (personID, groupID uint64, ok bool, err error)
+
+	SetIdempotencyResult(personID uint64, key string, result []byte, duration time.Duration) (err error)
+	GetIdempotencyResult(personID uint64, key string) (result []byte, ok bool)
+
+	// Quiesce blocks the writers of the organization, of the bills and of the tmp data while fn runs, e.g. to copy
+	// the data files.
+	Quiesce(fn func() error) error
+
+	// Close stops the background routines and releases the files, the storage can't be used after it.
+	Close()
 }
 
 func NewStorage(dataRoot string, debug bool, logger l.Wrapper) Storage {
+	return NewStorageEx(dataRoot, debug, Options{}, logger)
+}
+
+type Options struct {
+	MaxOpenBillFiles int      // bill day files kept open, 0: default
+	Crypter          *Crypter // nil: plaintext
+}
+
+func NewStorageEx(dataRoot string, debug bool, options Options, logger l.Wrapper) Storage {
+	billsRoot := filepath.Join(dataRoot, "bills")
+
+	_ = pathutils.MustDirExists(billsRoot)
+
+	recoverBillFiles(billsRoot, options.Crypter, logger)
+
+	handles := newFileHandles(options.MaxOpenBillFiles, billFileIdleTimeout)
+
+	go handles.evictRoutine()
+
+	impl := newStorageImpl(dataRoot, debug, options.Crypter, logger,
+		NewEncryptedFileStorage(rawfs.NewFSStorage(dataRoot), options.Crypter),
+		func(groupID uint64, logger l.Wrapper) BillFile {
+			return newBillFile(groupID, billsRoot, strconv.FormatUint(groupID, 10), handles, options.Crypter, logger)
+		})
+
+	batchRecorder := newFileBatchRecorder(impl)
+	batchRecorder.recover()
+
+	impl.batchRecorder = batchRecorder.record
+	impl.fnClose = handles.stop
+
+	return impl
+}
+
+func newStorageImpl(dataRoot string, debug bool, crypter *Crypter, logger l.Wrapper, fileStorage stg.FileStorage,
+	newBillFile func(groupID uint64, logger l.Wrapper) BillFile) *storageImpl {
 	if logger == nil {
 		logger = l.NewNopLoggerWrapper()
 	}
 
-	_ = pathutils.MustDirExists(filepath.Join(dataRoot, "bills"))
+	_ = pathutils.MustDirExists(dataRoot)
+
+	organizationLock := &sync.RWMutex{}
 
 	impl := &storageImpl{
-		logger:      logger.WithFields(l.StringField(l.ClsKey, "storageImpl")),
-		dataRoot:    dataRoot,
-		billsRoot:   filepath.Join(dataRoot, "bills"),
-		tmpDataFile: filepath.Join(dataRoot, "etd"),
+		logger:          logger.WithFields(l.StringField(l.ClsKey, "storageImpl")),
+		dataRoot:        dataRoot,
+		crypter:         crypter,
+		tmpDataFile:     filepath.Join(dataRoot, tmpDataFileName),
+		attachmentsRoot: filepath.Join(dataRoot, "attachments"),
 		organization: mwf.NewMemWithFile[*Organization, mwf.Serial, mwf.Lock](
 			NewOrganization(), &mwf.JSONSerial{
 				MarshalIndent: debug,
-			}, &sync.RWMutex{}, "organization", rawfs.NewFSStorage(dataRoot)),
-		tmpData:    cache.New(maxTmpDataDuration, maxTmpDataDuration),
-		groupBills: make(map[uint64]BillFile),
+			}, organizationLock, organizationFileName, fileStorage),
+		organizationLock: organizationLock,
+		tmpData:          cache.New(maxTmpDataDuration, maxTmpDataDuration),
+		newBillFile:      newBillFile,
+		groupBills:       make(map[uint64]BillFile),
 	}
 
 	impl.init()
@@ -103,15 +202,27 @@ func NewStorage(dataRoot string, debug bool, logger l.Wrapper) Storage {
 }
 
 type storageImpl struct {
-	logger       l.Wrapper
-	organization *mwf.MemWithFile[*Organization, mwf.Serial, mwf.Lock]
-	tmpData      *cache.Cache
-
-	dataRoot       string
-	billsRoot      string
-	tmpDataFile    string
-	groupBillsLock sync.Mutex
-	groupBills     map[uint64]BillFile
+	logger           l.Wrapper
+	organization     *mwf.MemWithFile[*Organization, mwf.Serial, mwf.Lock]
+	organizationLock *sync.RWMutex
+	tmpData          *cache.Cache
+	tmpDataLock      sync.Mutex // serializes the rewrites of the tmp data file
+
+	billWritersLock sync.RWMutex // held for read by the bill writers, for write by Quiesce
+
+	attachmentsLock    sync.Mutex
+	pendingAttachments map[string]int // attachment ID - references held by SaveAttachment
+
+	crypter         *Crypter
+	dataRoot        string
+	tmpDataFile     string
+	attachmentsRoot string
+	newBillFile     func(groupID uint64, logger l.Wrapper) BillFile
+	groupBillsLock  sync.Mutex
+	groupBills      map[uint64]BillFile
+
+	batchRecorder func(records []GroupRecord) (billIDs []string, err error) // all or nothing
+	fnClose       func()
 }
 
 func (impl *storageImpl) init() {
@@ -135,7 +246,30 @@ func (impl *storageImpl) init() {
 		_ = impl.initData()
 	}
 
-	_ = impl.tmpData.LoadFile(impl.tmpDataFile)
+	_ = impl.loadTmpData()
+}
+
+func (impl *storageImpl) loadTmpData() error {
+	d, err := readSealedFile(impl.tmpDataFile, impl.crypter)
+	if err != nil {
+		return err
+	}
+
+	return impl.tmpData.Load(bytes.NewReader(d))
+}
+
+// saveTmpData rewrites the whole tmp data file, it is small as the entries expire in maxTmpDataDuration.
+func (impl *storageImpl) saveTmpData() error {
+	impl.tmpDataLock.Lock()
+	defer impl.tmpDataLock.Unlock()
+
+	var buf bytes.Buffer
+
+	if err := impl.tmpData.Save(&buf); err != nil {
+		return err
+	}
+
+	return writeSealedFileAtomic(impl.tmpDataFile, buf.Bytes(), impl.crypter)
 }
 
 func (impl *storageImpl) getGroupBills(groupID uint64) BillFile {
@@ -144,7 +278,7 @@ func (impl *storageImpl) getGroupBills(groupID uint64) BillFile {
 
 	groupBill, ok := impl.groupBills[groupID]
 	if !ok {
-		groupBill = NewBillFile(groupID, impl.billsRoot, strconv.FormatUint(groupID, 10), impl.logger)
+		groupBill = impl.newBillFile(groupID, impl.logger)
 
 		impl.groupBills[groupID] = groupBill
 	}
@@ -247,6 +381,22 @@ func (impl *storageImpl) GetPersonName(personID uint64) (name string, err error)
 	return
 }
 
+func (impl *storageImpl) GetPersonIDByName(name string) (personID uint64, err error) {
+	impl.organization.Read(func(org *Organization) {
+		for _, person := range org.Persons {
+			if person.Name == name {
+				personID = person.ID
+
+				return
+			}
+		}
+
+		err = commerr.ErrNotFound
+	})
+
+	return
+}
+
 func (impl *storageImpl) GetPersonGroupsIDs(personID uint64) (groupIDs []uint64, err error) {
 	impl.organization.Read(func(org *Organization) {
 		person, ok := org.Persons[personID]
@@ -440,6 +590,8 @@ func (impl *storageImpl) LeaveGroup(groupID, personID uint64) error {
 			}
 		}
 
+		newOrg.Persons[personID] = person
+
 		return
 	})
 }
@@ -475,6 +627,20 @@ func (impl *storageImpl) GetGroupNames(groupIDs []uint64) (names []string, err e
 	return
 }
 
+func (impl *storageImpl) GetGroupIDs() (groupIDs []uint64, err error) {
+	impl.organization.Read(func(org *Organization) {
+		groupIDs = make([]uint64, 0, len(org.Groups))
+
+		for groupID := range org.Groups {
+			groupIDs = append(groupIDs, groupID)
+		}
+	})
+
+	slices.Sort(groupIDs)
+
+	return
+}
+
 func (impl *storageImpl) SetGroupAdmin(groupID, personID uint64, adminFlag bool) error {
 	return impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
 		newOrg = org
@@ -634,6 +800,30 @@ func (impl *storageImpl) GetWallet(walletID uint64) (wallet model.Wallet, err er
 	return
 }
 
+func (impl *storageImpl) RemoveWallet(walletID uint64) error {
+	return impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
+		newOrg = org
+
+		wallet, ok := newOrg.SubWallets[walletID]
+		if !ok {
+			err = commerr.ErrNotFound
+
+			return
+		}
+
+		delete(newOrg.SubWallets, walletID)
+
+		if person, ok := newOrg.Persons[wallet.PersonID]; ok {
+			person.SubWalletIDs = slices.DeleteFunc(slices.Clone(person.SubWalletIDs), func(id uint64) bool {
+				return id == walletID
+			})
+			newOrg.Persons[wallet.PersonID] = person
+		}
+
+		return
+	})
+}
+
 func (impl *storageImpl) GetPersonWalletIDs(personID uint64) (subWalletIDs []uint64, err error) {
 	impl.organization.Read(func(org *Organization) {
 		person, ok := org.Persons[personID]
@@ -673,6 +863,48 @@ func (impl *storageImpl) SetPersonGroupMerchant(personID, groupID uint64, costDi
 	})
 }
 
+func (impl *storageImpl) RemovePersonMerchant(personID uint64) error {
+	return impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
+		newOrg = org
+
+		delete(newOrg.Merchants, personID)
+
+		return
+	})
+}
+
+func (impl *storageImpl) RemovePerson(personID uint64) error {
+	return impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
+		newOrg = org
+
+		person, ok := newOrg.Persons[personID]
+		if !ok {
+			err = commerr.ErrNotFound
+
+			return
+		}
+
+		if len(person.Groups) > 0 {
+			err = commerr.ErrInvalidArgument
+
+			return
+		}
+
+		for _, walletID := range person.SubWalletIDs {
+			delete(newOrg.SubWallets, walletID)
+		}
+
+		delete(newOrg.Persons, personID)
+		delete(newOrg.Merchants, personID)
+
+		for _, merchants := range newOrg.GroupMerchants {
+			delete(merchants, personID)
+		}
+
+		return
+	})
+}
+
 func (impl *storageImpl) GetMerchantPersons() (merchants []MerchantPersonInfo) {
 	impl.organization.Read(func(org *Organization) {
 		for u, dir := range org.Merchants {
@@ -752,6 +984,22 @@ func (impl *storageImpl) GetLabels() (labels []model.Label, err error) {
 	return
 }
 
+func (impl *storageImpl) RemoveLabel(id uint64) error {
+	return impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
+		newOrg = org
+
+		if _, ok := newOrg.Labels[id]; !ok {
+			err = commerr.ErrNotFound
+
+			return
+		}
+
+		delete(newOrg.Labels, id)
+
+		return
+	})
+}
+
 func (impl *storageImpl) GetLabelName(id uint64) (name string, err error) {
 	impl.organization.Read(func(org *Organization) {
 		label, ok := org.Labels[id]
@@ -830,16 +1078,51 @@ func (impl *storageImpl) GetGroupLabelName(labelID, groupID uint64) (name string
 	return
 }
 
-func (impl *storageImpl) Record(groupID uint64, groupBill model.GroupBill) error {
+func (impl *storageImpl) Record(groupID uint64, groupBill model.GroupBill) (billID string, err error) {
+	impl.billWritersLock.RLock()
+	defer impl.billWritersLock.RUnlock()
+
 	return impl.getGroupBills(groupID).AddBill(groupBill)
 }
 
+func (impl *storageImpl) RecordBatch(records []GroupRecord) (billIDs []string, err error) {
+	impl.billWritersLock.RLock()
+	defer impl.billWritersLock.RUnlock()
+
+	for _, record := range records {
+		if !record.Bill.Valid() {
+			err = commerr.ErrInvalidArgument
+
+			return
+		}
+	}
+
+	return impl.batchRecorder(records)
+}
+
 func (impl *storageImpl) GetBill(groupID uint64, billID string) (bill model.GroupBill, err error) {
 	return impl.getGroupBills(groupID).GetBill(billID)
 }
 
-func (impl *storageImpl) DeleteRecord(groupID uint64, recordID string) error {
-	return impl.getGroupBills(groupID).DeleteRecord(recordID)
+func (impl *storageImpl) UpdateRecord(groupID uint64, groupBill model.GroupBill) (oldBill model.GroupBill, err error) {
+	impl.billWritersLock.RLock()
+	defer impl.billWritersLock.RUnlock()
+
+	return impl.getGroupBills(groupID).UpdateBill(groupBill)
+}
+
+func (impl *storageImpl) DeleteRecord(groupID uint64, recordID string, deletedBy uint64) error {
+	impl.billWritersLock.RLock()
+	defer impl.billWritersLock.RUnlock()
+
+	return impl.getGroupBills(groupID).DeleteRecord(recordID, deletedBy)
+}
+
+func (impl *storageImpl) AddDeletedBill(groupID uint64, bill model.DeletedGroupBill) (billID string, err error) {
+	impl.billWritersLock.RLock()
+	defer impl.billWritersLock.RUnlock()
+
+	return impl.getGroupBills(groupID).AddDeletedBill(bill)
 }
 
 func (impl *storageImpl) GetBills(groupID uint64) ([]model.GroupBill, error) {
@@ -874,13 +1157,126 @@ func (impl *storageImpl) GetDeletedBill(groupID uint64, billID string) (bill mod
 }
 
 func (impl *storageImpl) CleanDeletedBill(groupID uint64, billID string) (err error) {
-	return impl.getGroupBills(groupID).RemoveDeletedBillHistory(billID)
+	impl.billWritersLock.RLock()
+	defer impl.billWritersLock.RUnlock()
+
+	billFile := impl.getGroupBills(groupID)
+
+	bill, err := billFile.GetDeletedBill(billID)
+	if err != nil {
+		return
+	}
+
+	err = billFile.RemoveDeletedBillHistory(billID)
+	if err != nil {
+		return
+	}
+
+	impl.releaseAttachments(bill.Attachments)
+
+	return
 }
 
 func (impl *storageImpl) RestoreDeletedBill(groupID uint64, billID string) (err error) {
+	impl.billWritersLock.RLock()
+	defer impl.billWritersLock.RUnlock()
+
 	return impl.getGroupBills(groupID).RestoreDeletedBill(billID)
 }
 
+func (impl *storageImpl) PurgeDeletedBills(groupID uint64, deletedBefore time.Time) (count int, err error) {
+	impl.billWritersLock.RLock()
+	defer impl.billWritersLock.RUnlock()
+
+	bills, err := impl.getGroupBills(groupID).PurgeDeletedBills(deletedBefore)
+	if err != nil {
+		return
+	}
+
+	for _, bill := range bills {
+		impl.releaseAttachments(bill.Attachments)
+	}
+
+	count = len(bills)
+
+	return
+}
+
+func (impl *storageImpl) RemoveGroup(groupID uint64) (err error) {
+	impl.billWritersLock.RLock()
+	defer impl.billWritersLock.RUnlock()
+
+	billFile := impl.getGroupBills(groupID)
+
+	bills, err := billFile.GetBills("", "")
+	if err != nil {
+		return
+	}
+
+	for _, bill := range bills {
+		if err = billFile.RemoveBill(bill.ID); err != nil && !errors.Is(err, commerr.ErrNotFound) {
+			return
+		}
+
+		impl.releaseAttachments(bill.Attachments)
+	}
+
+	deletedBills, err := billFile.GetDeletedBills()
+	if err != nil {
+		return
+	}
+
+	for _, bill := range deletedBills {
+		if err = billFile.RemoveDeletedBillHistory(bill.ID); err != nil && !errors.Is(err, commerr.ErrNotFound) {
+			return
+		}
+
+		impl.releaseAttachments(bill.Attachments)
+	}
+
+	return impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
+		newOrg = org
+
+		if _, ok := newOrg.Groups[groupID]; !ok {
+			err = commerr.ErrNotFound
+
+			return
+		}
+
+		delete(newOrg.Groups, groupID)
+		delete(newOrg.GroupLabels, groupID)
+		delete(newOrg.GroupMerchants, groupID)
+
+		for personID, person := range newOrg.Persons {
+			if idx := slices.Index(person.Groups, groupID); idx >= 0 {
+				person.Groups = slices.Delete(person.Groups, idx, idx+1)
+				newOrg.Persons[personID] = person
+			}
+		}
+
+		return
+	})
+}
+
+func (impl *storageImpl) Quiesce(fn func() error) error {
+	impl.billWritersLock.Lock()
+	defer impl.billWritersLock.Unlock()
+
+	impl.organizationLock.Lock()
+	defer impl.organizationLock.Unlock()
+
+	impl.tmpDataLock.Lock()
+	defer impl.tmpDataLock.Unlock()
+
+	return fn()
+}
+
+func (impl *storageImpl) Close() {
+	if impl.fnClose != nil {
+		impl.fnClose()
+	}
+}
+
 func (impl *storageImpl) key4GroupEnterCode(enterCode string) string {
 	return "enter-code:" + enterCode
 }
@@ -897,7 +1293,7 @@ func (impl *storageImpl) AddGroupEnterCodes(enterCodes []string, personID, group
 		impl.tmpData.Set(impl.key4GroupEnterCode(code), d, duration)
 	}
 
-	err = impl.tmpData.SaveFile(impl.tmpDataFile)
+	err = impl.saveTmpData()
 
 	return
 }
@@ -924,7 +1320,7 @@ func (impl *storageImpl) ActiveGroupEnterCode(enterCode string) (personID, group
 
 	impl.tmpData.Delete(impl.key4GroupEnterCode(enterCode))
 
-	err = impl.tmpData.SaveFile(impl.tmpDataFile)
+	err = impl.saveTmpData()
 	if err != nil {
 		return
 	}
@@ -935,3 +1331,30 @@ func (impl *storageImpl) ActiveGroupEnterCode(enterCode string) (personID, group
 
 	return
 }
+
+func (impl *storageImpl) key4Idempotency(personID uint64, key string) string {
+	return "idempotency:" + strconv.FormatUint(personID, 10) + ":" + key
+}
+
+func (impl *storageImpl) SetIdempotencyResult(personID uint64, key string, result []byte, duration time.Duration) (err error) {
+	if duration > maxTmpDataDuration {
+		duration = maxTmpDataDuration
+	}
+
+	impl.tmpData.Set(impl.key4Idempotency(personID, key), result, duration)
+
+	err = impl.saveTmpData()
+
+	return
+}
+
+func (impl *storageImpl) GetIdempotencyResult(personID uint64, key string) (result []byte, ok bool) {
+	i, ok := impl.tmpData.Get(impl.key4Idempotency(personID, key))
+	if !ok {
+		return
+	}
+
+	result, ok = i.([]byte)
+
+	return
+}
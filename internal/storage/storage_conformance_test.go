@@ -0,0 +1,944 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/i/commerr"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/slices"
+)
+
+// storageFactory returns an empty storage in its own temp dir.
+type storageFactory func(t *testing.T) Storage
+
+var conformanceStorages = []struct {
+	name       string
+	newStorage storageFactory
+}{
+	{
+		name: "file",
+		newStorage: func(t *testing.T) Storage {
+			return NewStorage(t.TempDir(), false, nil)
+		},
+	},
+	{
+		name: "file-encrypted",
+		newStorage: func(t *testing.T) Storage {
+			crypter, err := NewCrypter([]byte("0123456789abcdef0123456789abcdef"))
+			assert.Nil(t, err)
+
+			return NewStorageEx(t.TempDir(), false, Options{MaxOpenBillFiles: 2, Crypter: crypter}, nil)
+		},
+	},
+	{
+		name: "sqlite",
+		newStorage: func(t *testing.T) Storage {
+			dataRoot := t.TempDir()
+
+			stg, err := NewSQLiteStorage(dataRoot, filepath.Join(dataRoot, "lifecost.db"), false, nil)
+			assert.Nil(t, err)
+
+			return stg
+		},
+	},
+}
+
+var conformanceCases = []struct {
+	name string
+	fn   func(t *testing.T, stg Storage)
+}{
+	{"persons", conformancePersons},
+	{"groups", conformanceGroups},
+	{"admins", conformanceAdmins},
+	{"wallets", conformanceWallets},
+	{"labels", conformanceLabels},
+	{"merchants", conformanceMerchants},
+	{"bills", conformanceBills},
+	{"paging", conformancePaging},
+	{"deleted bills", conformanceDeletedBills},
+	{"add deleted bill", conformanceAddDeletedBill},
+	{"update keeps server fields", conformanceUpdateKeepsServerFields},
+	{"remove group", conformanceRemoveGroup},
+	{"remove person", conformanceRemovePerson},
+	{"enter codes", conformanceEnterCodes},
+	{"recurring rules", conformanceRecurringRules},
+}
+
+// TestStorageConformance runs the same cases on every Storage implementation, a new backend is added
+// to conformanceStorages.
+func TestStorageConformance(t *testing.T) {
+	for _, backend := range conformanceStorages {
+		backend := backend
+
+		t.Run(backend.name, func(t *testing.T) {
+			runStorageConformance(t, backend.newStorage)
+		})
+	}
+}
+
+func runStorageConformance(t *testing.T, newStorage storageFactory) {
+	for _, c := range conformanceCases {
+		c := c
+
+		t.Run(c.name, func(t *testing.T) {
+			c.fn(t, newStorage(t))
+		})
+	}
+}
+
+func conformancePersons(t *testing.T, stg Storage) {
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+	assert.True(t, personID > 0)
+	assert.True(t, walletID > 0)
+
+	_, _, err = stg.NewPerson("zjz")
+	assert.ErrorIs(t, err, commerr.ErrAlreadyExists)
+
+	name, err := stg.GetPersonName(personID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "zjz", name)
+
+	id, err := stg.GetPersonIDByName("zjz")
+	assert.Nil(t, err)
+	assert.EqualValues(t, personID, id)
+
+	_, err = stg.GetPersonIDByName("nobody")
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+
+	_, err = stg.GetPersonName(personID + 1)
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+
+	walletIDs, err := stg.GetPersonWalletIDs(personID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []uint64{walletID}, walletIDs)
+
+	// registered persons get their suggested id and the default wallets
+	userID, userWalletID, err := stg.NewPersonEx("zym", 1000)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1000, userID)
+	assert.EqualValues(t, 1000, userWalletID)
+
+	walletIDs, err = stg.GetPersonWalletIDs(userID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 4, len(walletIDs))
+	assert.True(t, slices.Contains(walletIDs, userWalletID))
+
+	_, _, err = stg.NewPersonEx("zzx", 1000)
+	assert.ErrorIs(t, err, commerr.ErrAlreadyExists)
+
+	groupIDs, err := stg.GetPersonGroupsIDs(userID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(groupIDs))
+
+	_, err = stg.GetPersonGroupsIDs(userID + 1)
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+}
+
+func conformanceGroups(t *testing.T, stg Storage) {
+	zjzPersonID, _, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	zymPersonID, _, err := stg.NewPerson("zym")
+	assert.Nil(t, err)
+
+	homeGroupID, err := stg.NewGroup("home", zjzPersonID)
+	assert.Nil(t, err)
+	assert.True(t, homeGroupID > 0)
+
+	_, err = stg.NewGroup("home", zymPersonID)
+	assert.ErrorIs(t, err, commerr.ErrAlreadyExists)
+
+	_, err = stg.NewGroup("work", zjzPersonID+zymPersonID)
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+
+	workGroupID, err := stg.NewGroup("work", zymPersonID)
+	assert.Nil(t, err)
+
+	groupIDs, err := stg.GetGroupIDs()
+	assert.Nil(t, err)
+	utEqualSliceIgnoreOrder(t, []uint64{homeGroupID, workGroupID}, groupIDs)
+
+	names, err := stg.GetGroupNames([]uint64{workGroupID, homeGroupID})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"work", "home"}, names)
+
+	assert.Nil(t, stg.JoinGroup(homeGroupID, zymPersonID))
+	assert.ErrorIs(t, stg.JoinGroup(homeGroupID, zymPersonID), commerr.ErrAlreadyExists)
+	assert.ErrorIs(t, stg.JoinGroup(homeGroupID+workGroupID, zymPersonID), commerr.ErrNotFound)
+
+	personIDs, adminIDs, err := stg.GetGroupPersonIDs(homeGroupID)
+	assert.Nil(t, err)
+	utEqualSliceIgnoreOrder(t, []uint64{zjzPersonID, zymPersonID}, personIDs)
+	utEqualSliceIgnoreOrder(t, []uint64{zjzPersonID}, adminIDs)
+
+	groupIDs, err = stg.GetPersonGroupsIDs(zymPersonID)
+	assert.Nil(t, err)
+	utEqualSliceIgnoreOrder(t, []uint64{homeGroupID, workGroupID}, groupIDs)
+
+	assert.Nil(t, stg.LeaveGroup(homeGroupID, zymPersonID))
+	assert.ErrorIs(t, stg.LeaveGroup(homeGroupID, zymPersonID), commerr.ErrNotFound)
+
+	personIDs, _, err = stg.GetGroupPersonIDs(homeGroupID)
+	assert.Nil(t, err)
+	utEqualSliceIgnoreOrder(t, []uint64{zjzPersonID}, personIDs)
+
+	groupIDs, err = stg.GetPersonGroupsIDs(zymPersonID)
+	assert.Nil(t, err)
+	utEqualSliceIgnoreOrder(t, []uint64{workGroupID}, groupIDs)
+
+	currency, err := stg.GetGroupBaseCurrency(homeGroupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, model.DefaultCurrency, currency)
+
+	assert.Nil(t, stg.SetGroupBaseCurrency(homeGroupID, "USD"))
+
+	currency, err = stg.GetGroupBaseCurrency(homeGroupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "USD", currency)
+}
+
+func conformanceAdmins(t *testing.T, stg Storage) {
+	zjzPersonID, _, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	zymPersonID, _, err := stg.NewPerson("zym")
+	assert.Nil(t, err)
+
+	zzxPersonID, _, err := stg.NewPerson("zzx")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", zjzPersonID)
+	assert.Nil(t, err)
+
+	assert.Nil(t, stg.JoinGroup(groupID, zymPersonID))
+
+	adminFlag, err := stg.IsGroupAdmin(groupID, zjzPersonID)
+	assert.Nil(t, err)
+	assert.True(t, adminFlag)
+
+	adminFlag, err = stg.IsGroupAdmin(groupID, zymPersonID)
+	assert.Nil(t, err)
+	assert.False(t, adminFlag)
+
+	_, err = stg.IsGroupAdmin(groupID, zzxPersonID)
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+
+	assert.Nil(t, stg.SetGroupAdmin(groupID, zymPersonID, true))
+	assert.ErrorIs(t, stg.SetGroupAdmin(groupID, zzxPersonID, true), commerr.ErrNotFound)
+
+	adminFlag, err = stg.IsGroupAdmin(groupID, zymPersonID)
+	assert.Nil(t, err)
+	assert.True(t, adminFlag)
+
+	_, adminIDs, err := stg.GetGroupPersonIDs(groupID)
+	assert.Nil(t, err)
+	utEqualSliceIgnoreOrder(t, []uint64{zjzPersonID, zymPersonID}, adminIDs)
+
+	assert.Nil(t, stg.SetGroupAdmin(groupID, zjzPersonID, false))
+
+	adminFlag, err = stg.IsGroupAdmin(groupID, zjzPersonID)
+	assert.Nil(t, err)
+	assert.False(t, adminFlag)
+}
+
+func conformanceWallets(t *testing.T, stg Storage) {
+	personID, defaultWalletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	wallet, err := stg.GetWallet(defaultWalletID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, personID, wallet.PersonID)
+
+	walletID, err := stg.NewWallet("bank", personID)
+	assert.Nil(t, err)
+
+	_, err = stg.NewWallet("bank", personID)
+	assert.ErrorIs(t, err, commerr.ErrAlreadyExists)
+
+	_, err = stg.NewWallet("bank", personID+walletID)
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+
+	walletIDs, err := stg.GetPersonWalletIDs(personID)
+	assert.Nil(t, err)
+	utEqualSliceIgnoreOrder(t, []uint64{defaultWalletID, walletID}, walletIDs)
+
+	wallet, err = stg.GetWallet(walletID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "bank", wallet.Name)
+	assert.EqualValues(t, personID, wallet.PersonID)
+	assert.EqualValues(t, "", wallet.Currency)
+
+	assert.Nil(t, stg.SetWalletCurrency(walletID, "USD"))
+
+	wallet, err = stg.GetWallet(walletID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "USD", wallet.Currency)
+
+	_, err = stg.GetWallet(walletID + defaultWalletID)
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+}
+
+func conformanceLabels(t *testing.T, stg Storage) {
+	labelID, err := stg.NewLabel("food")
+	assert.Nil(t, err)
+
+	_, err = stg.NewLabel("food")
+	assert.ErrorIs(t, err, commerr.ErrAlreadyExists)
+
+	name, err := stg.GetLabelName(labelID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "food", name)
+
+	_, err = stg.GetLabelName(labelID + 1)
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+
+	labels, err := stg.GetLabels()
+	assert.Nil(t, err)
+	assert.True(t, slices.Contains(labels, model.Label{ID: labelID, Name: "food"}))
+
+	personID, _, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	homeGroupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	workGroupID, err := stg.NewGroup("work", personID)
+	assert.Nil(t, err)
+
+	groupLabelID, err := stg.NewGroupLabel(homeGroupID, "kid")
+	assert.Nil(t, err)
+
+	_, err = stg.NewGroupLabel(homeGroupID, "kid")
+	assert.ErrorIs(t, err, commerr.ErrAlreadyExists)
+
+	_, err = stg.NewGroupLabel(workGroupID, "kid")
+	assert.Nil(t, err)
+
+	labels, err = stg.GetGroupLabels(homeGroupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []model.Label{{ID: groupLabelID, Name: "kid"}}, labels)
+
+	name, err = stg.GetGroupLabelName(groupLabelID, homeGroupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "kid", name)
+
+	_, err = stg.GetGroupLabelName(groupLabelID, workGroupID)
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+}
+
+func conformanceMerchants(t *testing.T, stg Storage) {
+	shopPersonID, _, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	salaryPersonID, _, err := stg.NewPerson("salary")
+	assert.Nil(t, err)
+
+	_, ok := stg.IsMerchantPerson(shopPersonID)
+	assert.False(t, ok)
+
+	assert.Nil(t, stg.SetPersonMerchant(shopPersonID, model.CostDirIn))
+
+	dir, ok := stg.IsMerchantPerson(shopPersonID)
+	assert.True(t, ok)
+	assert.EqualValues(t, model.CostDirIn, dir)
+
+	assert.True(t, slices.Contains(stg.GetMerchantPersons(), MerchantPersonInfo{
+		PersonID: shopPersonID,
+		CostDir:  model.CostDirIn,
+	}))
+
+	groupID, err := stg.NewGroup("home", shopPersonID)
+	assert.Nil(t, err)
+
+	assert.Nil(t, stg.SetPersonGroupMerchant(salaryPersonID, groupID, model.CostDirOut))
+
+	dir, ok = stg.IsGroupMerchantPerson(salaryPersonID, groupID)
+	assert.True(t, ok)
+	assert.EqualValues(t, model.CostDirOut, dir)
+
+	_, ok = stg.IsGroupMerchantPerson(salaryPersonID, groupID+1)
+	assert.False(t, ok)
+
+	_, ok = stg.IsMerchantPerson(salaryPersonID)
+	assert.False(t, ok)
+
+	assert.EqualValues(t, []MerchantPersonInfo{{PersonID: salaryPersonID, CostDir: model.CostDirOut}},
+		stg.GetGroupMerchantPersons(groupID))
+}
+
+// conformanceGroupBills returns a group with a person wallet and a shop wallet to record bills.
+func conformanceGroupBills(t *testing.T, stg Storage) (groupID, walletID, shopWalletID uint64) {
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	_, shopWalletID, err = stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	groupID, err = stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	return
+}
+
+func conformanceBills(t *testing.T, stg Storage) {
+	groupID, walletID, shopWalletID := conformanceGroupBills(t, stg)
+
+	at := time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local)
+
+	bill := model.GroupBill{
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          100,
+		LabelIDs:        []uint64{1},
+		Remark:          "lunch",
+		At:              at.Unix(),
+	}
+
+	billID, err := stg.Record(groupID, bill)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, billID)
+
+	_, err = stg.Record(groupID, model.GroupBill{FromSubWalletID: walletID})
+	assert.NotNil(t, err)
+
+	dbBill, err := stg.GetBill(groupID, billID)
+	assert.Nil(t, err)
+
+	bill.ID = billID
+	assert.EqualValues(t, bill, dbBill)
+
+	_, err = stg.GetBill(groupID, billID+"0")
+	assert.NotNil(t, err)
+
+	updatedBill := bill
+	updatedBill.Amount = 200
+	updatedBill.Remark = "dinner"
+
+	oldBill, err := stg.UpdateRecord(groupID, updatedBill)
+	assert.Nil(t, err)
+	assert.EqualValues(t, bill, oldBill)
+
+	dbBill, err = stg.GetBill(groupID, billID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, updatedBill, dbBill)
+
+	// all or nothing
+	_, err = stg.RecordBatch([]GroupRecord{
+		{GroupID: groupID, Bill: bill},
+		{GroupID: groupID, Bill: model.GroupBill{FromSubWalletID: walletID}},
+	})
+	assert.NotNil(t, err)
+
+	bill.ID = ""
+	bill.At = at.AddDate(0, 0, 2).Unix()
+
+	billIDs, err := stg.RecordBatch([]GroupRecord{{GroupID: groupID, Bill: bill}, {GroupID: groupID, Bill: bill}})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(billIDs))
+
+	bills, err := stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, len(bills))
+
+	bills, err = stg.GetBillsEx(groupID, 2023, 11, 11, 2023, 11, 12)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(bills))
+
+	for _, b := range bills {
+		assert.True(t, slices.Contains(billIDs, b.ID))
+	}
+
+	bills, err = stg.GetBillsEx(groupID, 2023, 11, 10, 2023, 11, 10)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(bills))
+
+	// groups don't share bills
+	personID, _, err := stg.NewPerson("zym")
+	assert.Nil(t, err)
+
+	otherGroupID, err := stg.NewGroup("work", personID)
+	assert.Nil(t, err)
+
+	bills, err = stg.GetBills(otherGroupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(bills))
+}
+
+func conformancePaging(t *testing.T, stg Storage) {
+	groupID, walletID, shopWalletID := conformanceGroupBills(t, stg)
+
+	at := time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local)
+
+	// 5 bills on 3 days, newest first
+	var billIDs []string
+
+	for idx, day := range []int{0, 0, 1, 2, 2} {
+		billID, err := stg.Record(groupID, model.GroupBill{
+			FromSubWalletID: walletID,
+			ToSubWalletID:   shopWalletID,
+			CostDir:         model.CostDirOut,
+			Amount:          100 + idx,
+			At:              at.AddDate(0, 0, day).Add(time.Duration(idx) * time.Minute).Unix(),
+		})
+		assert.Nil(t, err)
+
+		billIDs = append([]string{billID}, billIDs...)
+	}
+
+	var (
+		pagedIDs []string
+		lastID   string
+	)
+
+	for pages := 0; ; pages++ {
+		assert.Less(t, pages, 3)
+
+		bills, hasMore, err := stg.GetBillsByID(groupID, lastID, 2, false)
+		assert.Nil(t, err)
+
+		for _, bill := range bills {
+			pagedIDs = append(pagedIDs, bill.ID)
+		}
+
+		if !hasMore || len(bills) == 0 {
+			break
+		}
+
+		lastID = bills[len(bills)-1].ID
+	}
+
+	assert.EqualValues(t, billIDs, pagedIDs)
+
+	// newer than the oldest one
+	bills, hasMore, err := stg.GetBillsByID(groupID, billIDs[4], 10, true)
+	assert.Nil(t, err)
+	assert.False(t, hasMore)
+	assert.EqualValues(t, 4, len(bills))
+
+	for idx, bill := range bills {
+		assert.EqualValues(t, billIDs[3-idx], bill.ID)
+	}
+
+	bills, hasMore, err = stg.GetBillsByID(groupID, "", 0, false)
+	assert.Nil(t, err)
+	assert.False(t, hasMore)
+	assert.EqualValues(t, 5, len(bills))
+}
+
+func conformanceDeletedBills(t *testing.T, stg Storage) {
+	groupID, walletID, shopWalletID := conformanceGroupBills(t, stg)
+
+	bill := model.GroupBill{
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          100,
+		At:              time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local).Unix(),
+	}
+
+	var billIDs []string
+
+	for idx := 0; idx < 3; idx++ {
+		billID, err := stg.Record(groupID, bill)
+		assert.Nil(t, err)
+
+		assert.Nil(t, stg.DeleteRecord(groupID, billID, uint64(idx+1)))
+
+		billIDs = append(billIDs, billID)
+	}
+
+	bills, err := stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(bills))
+
+	_, err = stg.GetBill(groupID, billIDs[0])
+	assert.NotNil(t, err)
+
+	deletedBills, err := stg.GetDeletedBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, len(deletedBills))
+
+	deletedBill, err := stg.GetDeletedBill(groupID, billIDs[0])
+	assert.Nil(t, err)
+	assert.EqualValues(t, billIDs[0], deletedBill.ID)
+	assert.EqualValues(t, 100, deletedBill.Amount)
+	assert.EqualValues(t, 1, deletedBill.DeletedBy)
+	assert.False(t, deletedBill.DeletedAt.IsZero())
+
+	// restored bills get a new id
+	assert.Nil(t, stg.RestoreDeletedBill(groupID, billIDs[0]))
+	assert.NotNil(t, stg.RestoreDeletedBill(groupID, billIDs[0]))
+
+	bills, err = stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(bills))
+	assert.EqualValues(t, 100, bills[0].Amount)
+
+	assert.Nil(t, stg.CleanDeletedBill(groupID, billIDs[1]))
+	assert.ErrorIs(t, stg.CleanDeletedBill(groupID, billIDs[1]), commerr.ErrNotFound)
+	assert.ErrorIs(t, stg.(*storageImpl).getGroupBills(groupID).RemoveDeletedBillHistory(billIDs[1]),
+		commerr.ErrNotFound)
+
+	_, err = stg.GetDeletedBill(groupID, billIDs[1])
+	assert.NotNil(t, err)
+
+	count, err := stg.PurgeDeletedBills(groupID, time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, count)
+
+	count, err = stg.PurgeDeletedBills(groupID, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, count)
+
+	deletedBills, err = stg.GetDeletedBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(deletedBills))
+
+	bills, err = stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(bills))
+}
+
+func conformanceAddDeletedBill(t *testing.T, stg Storage) {
+	groupID, walletID, shopWalletID := conformanceGroupBills(t, stg)
+
+	deletedAt := time.Now().Add(-time.Hour * 24 * 10)
+
+	billID, err := stg.AddDeletedBill(groupID, model.DeletedGroupBill{
+		GroupBill: model.GroupBill{
+			ID:              "old",
+			FromSubWalletID: walletID,
+			ToSubWalletID:   shopWalletID,
+			CostDir:         model.CostDirOut,
+			Amount:          100,
+			At:              time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local).Unix(),
+		},
+		DeletedAt: deletedAt,
+		DeletedBy: 7,
+	})
+	assert.Nil(t, err)
+	assert.NotEqualValues(t, "old", billID)
+
+	_, err = stg.AddDeletedBill(groupID, model.DeletedGroupBill{})
+	assert.ErrorIs(t, err, commerr.ErrInvalidArgument)
+
+	bills, err := stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(bills))
+
+	deletedBill, err := stg.GetDeletedBill(groupID, billID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 100, deletedBill.Amount)
+	assert.EqualValues(t, 7, deletedBill.DeletedBy)
+	assert.True(t, deletedAt.Equal(deletedBill.DeletedAt))
+
+	// the retention goes on from the kept deletion time
+	count, err := stg.PurgeDeletedBills(groupID, time.Now().Add(-time.Hour*24))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, count)
+}
+
+func conformanceUpdateKeepsServerFields(t *testing.T, stg Storage) {
+	groupID, walletID, shopWalletID := conformanceGroupBills(t, stg)
+
+	at := time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local)
+
+	billID, err := stg.Record(groupID, model.GroupBill{
+		FromSubWalletID:   walletID,
+		ToSubWalletID:     shopWalletID,
+		CostDir:           model.CostDirOut,
+		Amount:            100,
+		At:                at.Unix(),
+		OperationPersonID: 7,
+	})
+	assert.Nil(t, err)
+
+	// read before the attachment is added
+	staleBill, err := stg.GetBill(groupID, billID)
+	assert.Nil(t, err)
+
+	attachment, err := stg.SaveAttachment("receipt.png", "image/png", []byte("receipt"))
+	assert.Nil(t, err)
+	assert.Nil(t, stg.AddBillAttachment(groupID, billID, attachment))
+	stg.ReleaseAttachment(attachment.ID)
+
+	staleBill.Amount = 200
+	staleBill.OperationPersonID = 8
+	staleBill.Settlement = true
+
+	_, err = stg.UpdateRecord(groupID, staleBill)
+	assert.Nil(t, err)
+
+	dbBill, err := stg.GetBill(groupID, billID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 200, dbBill.Amount)
+	assert.EqualValues(t, 7, dbBill.OperationPersonID)
+	assert.False(t, dbBill.Settlement)
+	assert.EqualValues(t, []model.Attachment{attachment}, dbBill.Attachments)
+
+	// moved to another day
+	staleBill.At = at.AddDate(0, 0, 2).Unix()
+
+	_, err = stg.UpdateRecord(groupID, staleBill)
+	assert.Nil(t, err)
+
+	dbBill, err = stg.GetBill(groupID, billID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, staleBill.At, dbBill.At)
+	assert.EqualValues(t, 7, dbBill.OperationPersonID)
+	assert.EqualValues(t, []model.Attachment{attachment}, dbBill.Attachments)
+
+	// the reference is still counted, the blob goes with the last one
+	assert.Nil(t, stg.RemoveBillAttachment(groupID, billID, attachment.ID))
+
+	_, err = stg.ReadAttachment(attachment.ID)
+	assert.NotNil(t, err)
+}
+
+func conformanceRemoveGroup(t *testing.T, stg Storage) {
+	groupID, walletID, shopWalletID := conformanceGroupBills(t, stg)
+
+	personIDs, _, err := stg.GetGroupPersonIDs(groupID)
+	assert.Nil(t, err)
+
+	labelID, err := stg.NewGroupLabel(groupID, "rent")
+	assert.Nil(t, err)
+
+	shopPersonID, err := stg.GetPersonIDByName("shop")
+	assert.Nil(t, err)
+
+	assert.Nil(t, stg.SetPersonGroupMerchant(shopPersonID, groupID, model.CostDirOut))
+
+	bill := model.GroupBill{
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          100,
+		LabelIDs:        []uint64{labelID},
+		At:              time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local).Unix(),
+	}
+
+	billID, err := stg.Record(groupID, bill)
+	assert.Nil(t, err)
+
+	deletedBillID, err := stg.Record(groupID, bill)
+	assert.Nil(t, err)
+	assert.Nil(t, stg.DeleteRecord(groupID, deletedBillID, personIDs[0]))
+
+	assert.Nil(t, stg.RemoveGroup(groupID))
+	assert.ErrorIs(t, stg.RemoveGroup(groupID), commerr.ErrNotFound)
+
+	groupIDs, err := stg.GetGroupIDs()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(groupIDs))
+
+	groupIDs, err = stg.GetPersonGroupsIDs(personIDs[0])
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(groupIDs))
+
+	_, _, err = stg.GetGroupPersonIDs(groupID)
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+
+	labels, err := stg.GetGroupLabels(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(labels))
+
+	assert.EqualValues(t, 0, len(stg.GetGroupMerchantPersons(groupID)))
+
+	bills, err := stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(bills))
+
+	_, err = stg.GetBill(groupID, billID)
+	assert.NotNil(t, err)
+
+	deletedBills, err := stg.GetDeletedBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(deletedBills))
+
+	// the name is free again
+	_, err = stg.NewGroup("home", personIDs[0])
+	assert.Nil(t, err)
+}
+
+func conformanceRemovePerson(t *testing.T, stg Storage) {
+	personID, walletID, err := stg.NewPersonEx("zjz", 1001)
+	assert.Nil(t, err)
+
+	shopID, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	assert.Nil(t, stg.SetPersonMerchant(shopID, model.CostDirOut))
+	assert.Nil(t, stg.SetPersonGroupMerchant(shopID, groupID, model.CostDirOut))
+
+	assert.ErrorIs(t, stg.RemovePerson(personID), commerr.ErrInvalidArgument) // still in the group
+
+	assert.Nil(t, stg.RemovePerson(shopID))
+	assert.ErrorIs(t, stg.RemovePerson(shopID), commerr.ErrNotFound)
+
+	_, err = stg.GetPersonName(shopID)
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+
+	_, err = stg.GetWallet(shopWalletID)
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+
+	_, ok := stg.IsMerchantPerson(shopID)
+	assert.False(t, ok)
+
+	_, ok = stg.IsGroupMerchantPerson(shopID, groupID)
+	assert.False(t, ok)
+
+	// the name can be taken again
+	_, _, err = stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	cashWalletID, err := stg.NewWallet("cash", personID)
+	assert.Nil(t, err)
+
+	assert.Nil(t, stg.RemoveWallet(cashWalletID))
+	assert.ErrorIs(t, stg.RemoveWallet(cashWalletID), commerr.ErrNotFound)
+
+	walletIDs, err := stg.GetPersonWalletIDs(personID)
+	assert.Nil(t, err)
+	assert.NotContains(t, walletIDs, cashWalletID)
+	assert.Contains(t, walletIDs, walletID)
+
+	labelID, err := stg.NewLabel("food")
+	assert.Nil(t, err)
+
+	assert.Nil(t, stg.RemoveLabel(labelID))
+	assert.ErrorIs(t, stg.RemoveLabel(labelID), commerr.ErrNotFound)
+
+	_, err = stg.GetLabelName(labelID)
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+
+	assert.Nil(t, stg.SetPersonMerchant(personID, model.CostDirIn))
+	assert.Nil(t, stg.RemovePersonMerchant(personID))
+
+	_, ok = stg.IsMerchantPerson(personID)
+	assert.False(t, ok)
+}
+
+func conformanceEnterCodes(t *testing.T, stg Storage) {
+	personID, _, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	assert.Nil(t, stg.AddGroupEnterCodes([]string{"a1", "a2"}, personID, groupID, time.Minute))
+	assert.Nil(t, stg.AddGroupEnterCodes([]string{"b1"}, personID, groupID, time.Millisecond))
+
+	codePersonID, codeGroupID, ok, err := stg.ActiveGroupEnterCode("a1")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.EqualValues(t, personID, codePersonID)
+	assert.EqualValues(t, groupID, codeGroupID)
+
+	// codes are used once
+	_, _, ok, err = stg.ActiveGroupEnterCode("a1")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	_, _, ok, err = stg.ActiveGroupEnterCode("a2")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	_, _, ok, err = stg.ActiveGroupEnterCode("unknown")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	time.Sleep(10 * time.Millisecond)
+
+	_, _, ok, err = stg.ActiveGroupEnterCode("b1")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func conformanceRecurringRules(t *testing.T, stg Storage) {
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	rule := model.RecurringRule{
+		PersonID:        personID,
+		Name:            "rent",
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		Amount:          100,
+		Schedule:        model.RecurringScheduleMonthly,
+		Day:             31,
+	}
+
+	_, err = stg.NewRecurringRule(model.RecurringRule{PersonID: personID})
+	assert.ErrorIs(t, err, commerr.ErrInvalidArgument)
+
+	noPersonRule := rule
+	noPersonRule.PersonID = personID + 1000
+
+	_, err = stg.NewRecurringRule(noPersonRule)
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+
+	ruleID, err := stg.NewRecurringRule(rule)
+	assert.Nil(t, err)
+
+	otherRuleID, err := stg.NewRecurringRule(rule)
+	assert.Nil(t, err)
+	assert.NotEqual(t, ruleID, otherRuleID)
+
+	savedRule, err := stg.GetRecurringRule(ruleID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "rent", savedRule.Name)
+	assert.True(t, savedRule.StartAt > 0)
+
+	rules, err := stg.GetRecurringRules(personID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(rules))
+
+	rules, err = stg.GetRecurringRules(personID + 1000)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(rules))
+
+	assert.Nil(t, stg.SetRecurringRuleLastRunAt(ruleID, 1000))
+
+	savedRule, err = stg.GetRecurringRule(ruleID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1000, savedRule.LastRunAt)
+
+	assert.Nil(t, stg.PauseRecurringRule(ruleID, true))
+
+	savedRule, err = stg.GetRecurringRule(ruleID)
+	assert.Nil(t, err)
+	assert.True(t, savedRule.Paused)
+
+	// the paused period is skipped on resuming
+	assert.Nil(t, stg.PauseRecurringRule(ruleID, false))
+
+	savedRule, err = stg.GetRecurringRule(ruleID)
+	assert.Nil(t, err)
+	assert.False(t, savedRule.Paused)
+	assert.True(t, savedRule.LastRunAt > 1000)
+
+	assert.Nil(t, stg.DeleteRecurringRule(ruleID))
+	assert.ErrorIs(t, stg.DeleteRecurringRule(ruleID), commerr.ErrNotFound)
+	assert.ErrorIs(t, stg.PauseRecurringRule(ruleID, true), commerr.ErrNotFound)
+	assert.ErrorIs(t, stg.SetRecurringRuleLastRunAt(ruleID, 1000), commerr.ErrNotFound)
+
+	_, err = stg.GetRecurringRule(ruleID)
+	assert.ErrorIs(t, err, commerr.ErrNotFound)
+
+	rules, err = stg.GetRecurringRules(0)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(rules))
+	assert.EqualValues(t, otherRuleID, rules[0].ID)
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"strings"
+	"time"
+
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/i/commerr"
+	"golang.org/x/exp/slices"
+)
+
+func exchangeRatePairKey(from, to string) string {
+	return from + "/" + to
+}
+
+func (impl *storageImpl) SetWalletCurrency(walletID uint64, currency string) error {
+	if currency != "" && !model.ValidCurrency(currency) {
+		return commerr.ErrInvalidArgument
+	}
+
+	return impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
+		newOrg = org
+
+		wallet, ok := newOrg.SubWallets[walletID]
+		if !ok {
+			err = commerr.ErrNotFound
+
+			return
+		}
+
+		wallet.Currency = currency
+
+		newOrg.SubWallets[walletID] = wallet
+
+		return
+	})
+}
+
+func (impl *storageImpl) SetGroupBaseCurrency(groupID uint64, currency string) error {
+	if currency != "" && !model.ValidCurrency(currency) {
+		return commerr.ErrInvalidArgument
+	}
+
+	return impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
+		newOrg = org
+
+		group, ok := newOrg.Groups[groupID]
+		if !ok {
+			err = commerr.ErrNotFound
+
+			return
+		}
+
+		group.BaseCurrency = currency
+
+		newOrg.Groups[groupID] = group
+
+		return
+	})
+}
+
+func (impl *storageImpl) GetGroupBaseCurrency(groupID uint64) (currency string, err error) {
+	impl.organization.Read(func(org *Organization) {
+		group, ok := org.Groups[groupID]
+		if !ok {
+			err = commerr.ErrNotFound
+
+			return
+		}
+
+		currency = model.CurrencyOrDefault(group.BaseCurrency)
+	})
+
+	return
+}
+
+func (impl *storageImpl) SetExchangeRate(rate model.ExchangeRate) error {
+	if !rate.Valid() {
+		return commerr.ErrInvalidArgument
+	}
+
+	if _, err := time.ParseInLocation("20060102", rate.Date, time.Local); err != nil {
+		return commerr.ErrInvalidArgument
+	}
+
+	return impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
+		newOrg = org
+
+		key := exchangeRatePairKey(rate.From, rate.To)
+
+		if newOrg.ExchangeRates[key] == nil {
+			newOrg.ExchangeRates[key] = make(map[string]float64)
+		}
+
+		newOrg.ExchangeRates[key][rate.Date] = rate.Rate
+
+		return
+	})
+}
+
+func (impl *storageImpl) GetExchangeRates() (rates []model.ExchangeRate, err error) {
+	impl.organization.Read(func(org *Organization) {
+		for key, dateRates := range org.ExchangeRates {
+			ps := strings.Split(key, "/")
+			if len(ps) != 2 {
+				continue
+			}
+
+			for date, rate := range dateRates {
+				rates = append(rates, model.ExchangeRate{
+					From: ps[0],
+					To:   ps[1],
+					Date: date,
+					Rate: rate,
+				})
+			}
+		}
+	})
+
+	slices.SortFunc(rates, func(a, b model.ExchangeRate) int {
+		if r := strings.Compare(exchangeRatePairKey(a.From, a.To), exchangeRatePairKey(b.From, b.To)); r != 0 {
+			return r
+		}
+
+		return strings.Compare(a.Date, b.Date)
+	})
+
+	return
+}
+
+// GetExchangeRate returns the latest rate effective on at, the reverse pair is used if there is no direct one.
+func (impl *storageImpl) GetExchangeRate(from, to string, at time.Time) (rate float64, err error) {
+	from = model.CurrencyOrDefault(from)
+	to = model.CurrencyOrDefault(to)
+
+	if from == to {
+		rate = 1
+
+		return
+	}
+
+	date := at.Format("20060102")
+
+	fnLatest := func(dateRates map[string]float64) (rate float64, ok bool) {
+		var latestDate string
+
+		for d, r := range dateRates {
+			if d <= date && d > latestDate {
+				latestDate = d
+				rate = r
+				ok = true
+			}
+		}
+
+		return
+	}
+
+	impl.organization.Read(func(org *Organization) {
+		var ok bool
+
+		rate, ok = fnLatest(org.ExchangeRates[exchangeRatePairKey(from, to)])
+		if ok {
+			return
+		}
+
+		rate, ok = fnLatest(org.ExchangeRates[exchangeRatePairKey(to, from)])
+		if ok {
+			rate = 1 / rate
+
+			return
+		}
+
+		err = commerr.ErrNotFound
+	})
+
+	return
+}
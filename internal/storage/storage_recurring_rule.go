@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/godruoyi/go-snowflake"
+	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/i/commerr"
+	"golang.org/x/exp/slices"
+)
+
+func (impl *storageImpl) NewRecurringRule(rule model.RecurringRule) (id uint64, err error) {
+	if !rule.Valid() {
+		err = commerr.ErrInvalidArgument
+
+		return
+	}
+
+	err = impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
+		newOrg = org
+
+		if _, ok := newOrg.Persons[rule.PersonID]; !ok {
+			err = commerr.ErrNotFound
+
+			return
+		}
+
+		id = snowflake.ID()
+
+		rule.ID = id
+		newOrg.RecurringRules[id] = rule
+
+		return
+	})
+
+	return
+}
+
+func (impl *storageImpl) GetRecurringRule(ruleID uint64) (rule model.RecurringRule, err error) {
+	impl.organization.Read(func(org *Organization) {
+		var ok bool
+
+		rule, ok = org.RecurringRules[ruleID]
+		if !ok {
+			err = commerr.ErrNotFound
+
+			return
+		}
+	})
+
+	return
+}
+
+func (impl *storageImpl) GetRecurringRules(personID uint64) (rules []model.RecurringRule, err error) {
+	impl.organization.Read(func(org *Organization) {
+		rules = make([]model.RecurringRule, 0, len(org.RecurringRules))
+
+		for _, rule := range org.RecurringRules {
+			if personID != 0 && rule.PersonID != personID {
+				continue
+			}
+
+			rules = append(rules, rule)
+		}
+	})
+
+	slices.SortFunc(rules, func(a, b model.RecurringRule) int {
+		if a.ID == b.ID {
+			return 0
+		}
+
+		if a.ID < b.ID {
+			return -1
+		}
+
+		return 1
+	})
+
+	return
+}
+
+func (impl *storageImpl) PauseRecurringRule(ruleID uint64, paused bool) error {
+	return impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
+		newOrg = org
+
+		rule, ok := newOrg.RecurringRules[ruleID]
+		if !ok {
+			err = commerr.ErrNotFound
+
+			return
+		}
+
+		if rule.Paused && !paused {
+			// the paused period is not caught up after resuming
+			rule.LastRunAt = time.Now().Unix()
+		}
+
+		rule.Paused = paused
+
+		newOrg.RecurringRules[ruleID] = rule
+
+		return
+	})
+}
+
+func (impl *storageImpl) SetRecurringRuleLastRunAt(ruleID uint64, lastRunAt int64) error {
+	return impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
+		newOrg = org
+
+		rule, ok := newOrg.RecurringRules[ruleID]
+		if !ok {
+			err = commerr.ErrNotFound
+
+			return
+		}
+
+		rule.LastRunAt = lastRunAt
+
+		newOrg.RecurringRules[ruleID] = rule
+
+		return
+	})
+}
+
+func (impl *storageImpl) DeleteRecurringRule(ruleID uint64) error {
+	return impl.organization.Change(func(org *Organization) (newOrg *Organization, err error) {
+		newOrg = org
+
+		if _, ok := newOrg.RecurringRules[ruleID]; !ok {
+			err = commerr.ErrNotFound
+
+			return
+		}
+
+		delete(newOrg.RecurringRules, ruleID)
+
+		return
+	})
+}
@@ -1,11 +1,17 @@
 package storage
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/s-min-sys/lifecostbe/internal/model"
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/libeasygo/pathutils"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/exp/slices"
 )
@@ -257,7 +263,7 @@ func TestStorage(t *testing.T) {
 
 	huaFeiLabelID, _ := stg.NewLabel("日常花费")
 
-	err = stg.Record(homeGroupID, model.GroupBill{
+	_, err = stg.Record(homeGroupID, model.GroupBill{
 		FromSubWalletID: subWeChatWalletID,
 		ToSubWalletID:   xiaoFeiSubWalletID,
 		CostDir:         model.CostDirOut,
@@ -268,7 +274,7 @@ func TestStorage(t *testing.T) {
 	})
 	assert.Nil(t, err)
 
-	err = stg.Record(homeGroupID, model.GroupBill{
+	_, err = stg.Record(homeGroupID, model.GroupBill{
 		FromSubWalletID: liXiSubWalletID,
 		ToSubWalletID:   subWeChatWalletID,
 		CostDir:         model.CostDirIn,
@@ -284,3 +290,1087 @@ func TestStorage(t *testing.T) {
 
 	t.Log(bills)
 }
+
+func TestUpdateRecord(t *testing.T) {
+	_ = os.RemoveAll("update")
+	stg := NewStorage("update", false, nil)
+
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	shopPersonID, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+	assert.True(t, shopPersonID > 0)
+
+	at := time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local)
+
+	_, err = stg.Record(groupID, model.GroupBill{
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          100,
+		At:              at.Unix(),
+	})
+	assert.Nil(t, err)
+
+	bills, err := stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(bills))
+
+	bill := bills[0]
+	bill.Amount = 200
+	bill.Remark = "changed"
+
+	oldBill, err := stg.UpdateRecord(groupID, bill)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 100, oldBill.Amount)
+
+	bill, err = stg.GetBill(groupID, bills[0].ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 200, bill.Amount)
+	assert.EqualValues(t, "changed", bill.Remark)
+
+	bill.At = at.AddDate(0, 0, 3).Unix()
+
+	_, err = stg.UpdateRecord(groupID, bill)
+	assert.Nil(t, err)
+
+	bills, err = stg.GetBillsEx(groupID, 2023, 11, 10, 2023, 11, 10)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(bills))
+
+	bills, err = stg.GetBillsEx(groupID, 2023, 11, 13, 2023, 11, 13)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(bills))
+	assert.EqualValues(t, bill.ID, bills[0].ID)
+
+	bill, err = stg.GetBill(groupID, bills[0].ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, bills[0].At, bill.At)
+
+	// paging from the moved bill starts at its new day, not at the date prefix of its id
+	for _, day := range []int{11, 12, 14} {
+		_, err = stg.Record(groupID, model.GroupBill{
+			FromSubWalletID: walletID,
+			ToSubWalletID:   shopWalletID,
+			CostDir:         model.CostDirOut,
+			Amount:          day,
+			At:              time.Date(2023, 11, day, 12, 0, 0, 0, time.Local).Unix(),
+		})
+		assert.Nil(t, err)
+	}
+
+	newerBills, _, err := stg.GetBillsByID(groupID, bill.ID, 10, true)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(newerBills))
+	assert.EqualValues(t, 14, newerBills[0].Amount)
+
+	olderBills, _, err := stg.GetBillsByID(groupID, bill.ID, 10, false)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(olderBills))
+	assert.EqualValues(t, 12, olderBills[0].Amount)
+	assert.EqualValues(t, 11, olderBills[1].Amount)
+
+	err = stg.DeleteRecord(groupID, bill.ID, 0)
+	assert.Nil(t, err)
+
+	_, err = stg.UpdateRecord(groupID, bill)
+	assert.NotNil(t, err)
+}
+
+func TestBillAttachment(t *testing.T) {
+	_ = os.RemoveAll("attachment")
+	stg := NewStorage("attachment", false, nil)
+
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	_, err = stg.Record(groupID, model.GroupBill{
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          100,
+		At:              time.Now().Unix(),
+	})
+	assert.Nil(t, err)
+
+	bills, err := stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(bills))
+
+	attachment, err := stg.SaveAttachment("receipt.png", "image/png", []byte("receipt"))
+	assert.Nil(t, err)
+
+	err = stg.AddBillAttachment(groupID, bills[0].ID, attachment)
+	assert.Nil(t, err)
+
+	err = stg.AddBillAttachment(groupID, bills[0].ID, attachment)
+	assert.ErrorIs(t, err, commerr.ErrAlreadyExists)
+
+	err = stg.AddBillAttachment(groupID, "20000101-unknown", attachment)
+	assert.NotNil(t, err)
+
+	stg.ReleaseAttachment(attachment.ID)
+
+	bill, err := stg.GetBill(groupID, bills[0].ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []model.Attachment{attachment}, bill.Attachments)
+
+	ok, err := stg.HasBillAttachment(groupID, bill.ID, attachment.ID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	otherBillID, err := stg.Record(groupID, model.GroupBill{
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          50,
+		At:              time.Now().Unix(),
+	})
+	assert.Nil(t, err)
+
+	// only the named bill counts
+	ok, err = stg.HasBillAttachment(groupID, otherBillID, attachment.ID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	ok, err = stg.HasBillAttachment(groupID, "20000101-unknown", attachment.ID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// an upload never attached is removed once released
+	orphan, err := stg.SaveAttachment("orphan.png", "image/png", []byte("orphan"))
+	assert.Nil(t, err)
+
+	err = stg.AddBillAttachment(groupID, "20000101-unknown", orphan)
+	assert.NotNil(t, err)
+
+	_, err = stg.ReadAttachment(orphan.ID)
+	assert.Nil(t, err)
+
+	stg.ReleaseAttachment(orphan.ID)
+
+	_, err = stg.ReadAttachment(orphan.ID)
+	assert.NotNil(t, err)
+
+	err = stg.DeleteRecord(groupID, bill.ID, 0)
+	assert.Nil(t, err)
+
+	d, err := stg.ReadAttachment(attachment.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "receipt", string(d))
+
+	ok, err = stg.HasBillAttachment(groupID, bill.ID, attachment.ID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	err = stg.CleanDeletedBill(groupID, bill.ID)
+	assert.Nil(t, err)
+
+	_, err = stg.ReadAttachment(attachment.ID)
+	assert.NotNil(t, err)
+
+	ok, err = stg.HasBillAttachment(groupID, bill.ID, attachment.ID)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestExchangeRate(t *testing.T) {
+	_ = os.RemoveAll("currency")
+	stg := NewStorage("currency", false, nil)
+
+	err := stg.SetExchangeRate(model.ExchangeRate{From: "usd", To: "CNY", Date: "20230101", Rate: 7})
+	assert.Nil(t, err)
+
+	err = stg.SetExchangeRate(model.ExchangeRate{From: "USD", To: "CNY", Date: "20230601", Rate: 7.2})
+	assert.Nil(t, err)
+
+	err = stg.SetExchangeRate(model.ExchangeRate{From: "USD", To: "USD", Date: "20230601", Rate: 1})
+	assert.NotNil(t, err)
+
+	_, err = stg.GetExchangeRate("USD", "CNY", time.Date(2022, 12, 31, 0, 0, 0, 0, time.Local))
+	assert.NotNil(t, err)
+
+	rate, err := stg.GetExchangeRate("USD", "CNY", time.Date(2023, 3, 1, 0, 0, 0, 0, time.Local))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 7, rate)
+
+	rate, err = stg.GetExchangeRate("USD", "", time.Date(2023, 6, 1, 0, 0, 0, 0, time.Local))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 7.2, rate)
+
+	rate, err = stg.GetExchangeRate("CNY", "USD", time.Date(2023, 3, 1, 0, 0, 0, 0, time.Local))
+	assert.Nil(t, err)
+	assert.InDelta(t, 1.0/7, rate, 1e-9)
+
+	rates, err := stg.GetExchangeRates()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(rates))
+}
+
+func TestIdempotencyResult(t *testing.T) {
+	_ = os.RemoveAll("idempotency")
+	stg := NewStorage("idempotency", false, nil)
+
+	_, ok := stg.GetIdempotencyResult(1, "k1")
+	assert.False(t, ok)
+
+	err := stg.SetIdempotencyResult(1, "k1", []byte("r1"), time.Hour)
+	assert.Nil(t, err)
+
+	_, ok = stg.GetIdempotencyResult(2, "k1")
+	assert.False(t, ok)
+
+	stg = NewStorage("idempotency", false, nil)
+
+	result, ok := stg.GetIdempotencyResult(1, "k1")
+	assert.True(t, ok)
+	assert.EqualValues(t, "r1", string(result))
+}
+
+func TestRecordBatch(t *testing.T) {
+	_ = os.RemoveAll("batch")
+	stg := NewStorage("batch", false, nil)
+
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	at := time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local)
+
+	bill := model.GroupBill{
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          100,
+		At:              at.Unix(),
+	}
+
+	invalidBill := bill
+	invalidBill.Amount = 0
+
+	_, err = stg.RecordBatch([]GroupRecord{{GroupID: groupID, Bill: bill}, {GroupID: groupID, Bill: invalidBill}})
+	assert.NotNil(t, err)
+
+	bills, err := stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(bills))
+
+	nextDayBill := bill
+	nextDayBill.At = at.AddDate(0, 0, 1).Unix()
+
+	billIDs, err := stg.RecordBatch([]GroupRecord{{GroupID: groupID, Bill: bill}, {GroupID: groupID, Bill: nextDayBill}})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(billIDs))
+
+	for _, billID := range billIDs {
+		_, err = stg.GetBill(groupID, billID)
+		assert.Nil(t, err)
+	}
+
+	err = stg.(*storageImpl).getGroupBills(groupID).RemoveBill(billIDs[0])
+	assert.Nil(t, err)
+
+	_, err = stg.GetBill(groupID, billIDs[0])
+	assert.NotNil(t, err)
+
+	deletedBills, err := stg.GetDeletedBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(deletedBills))
+
+	journalFile := filepath.Join("batch", batchJournalFileName)
+
+	exists, _ := pathutils.IsFileExists(journalFile)
+	assert.False(t, exists)
+
+	// a crash before the batch commits leaves the journal, the bills are rolled back on next start
+	d, err := json.Marshal([]batchJournalEntry{
+		{GroupID: groupID, BillID: billIDs[0]},
+		{GroupID: groupID, BillID: billIDs[1]},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, writeSealedFileAtomic(journalFile, d, nil))
+
+	stg = NewStorage("batch", false, nil)
+
+	_, err = stg.GetBill(groupID, billIDs[1])
+	assert.NotNil(t, err)
+
+	exists, _ = pathutils.IsFileExists(journalFile)
+	assert.False(t, exists)
+}
+
+func TestPurgeDeletedBills(t *testing.T) {
+	_ = os.RemoveAll("purge")
+	stg := NewStorage("purge", false, nil)
+
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	billID, err := stg.Record(groupID, model.GroupBill{
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          100,
+		At:              time.Now().Unix(),
+	})
+	assert.Nil(t, err)
+
+	err = stg.DeleteRecord(groupID, billID, 0)
+	assert.Nil(t, err)
+
+	count, err := stg.PurgeDeletedBills(groupID, time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, count)
+
+	// the purged bills stay if the file can't be saved
+	deletedFilePath := filepath.Join("purge", "bills", fmt.Sprintf("%d-%s", groupID, deletedFileName))
+
+	assert.Nil(t, os.Remove(deletedFilePath))
+	assert.Nil(t, os.MkdirAll(filepath.Join(deletedFilePath, "x"), os.ModePerm))
+
+	_, err = stg.PurgeDeletedBills(groupID, time.Now().Add(time.Second))
+	assert.NotNil(t, err)
+
+	deletedBills, err := stg.GetDeletedBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(deletedBills))
+
+	assert.Nil(t, os.RemoveAll(deletedFilePath))
+
+	count, err = stg.PurgeDeletedBills(groupID, time.Now().Add(time.Second))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, count)
+
+	deletedBills, err = stg.GetDeletedBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(deletedBills))
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	_ = os.RemoveAll("sqlite")
+	stg, err := NewSQLiteStorage("sqlite", "sqlite/lifecost.db", false, nil)
+	assert.Nil(t, err)
+
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	at := time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local)
+
+	bill := model.GroupBill{
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          100,
+		At:              at.Unix(),
+	}
+
+	billIDs, err := stg.RecordBatch([]GroupRecord{{GroupID: groupID, Bill: bill}, {GroupID: groupID, Bill: bill}})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(billIDs))
+
+	bill.At = at.AddDate(0, 0, 1).Unix()
+
+	billID, err := stg.Record(groupID, bill)
+	assert.Nil(t, err)
+
+	bills, hasMore, err := stg.GetBillsByID(groupID, "", 2, false)
+	assert.Nil(t, err)
+	assert.True(t, hasMore)
+	assert.EqualValues(t, []string{billID, billIDs[1]}, []string{bills[0].ID, bills[1].ID})
+
+	bills, hasMore, err = stg.GetBillsByID(groupID, billIDs[1], 2, false)
+	assert.Nil(t, err)
+	assert.False(t, hasMore)
+	assert.EqualValues(t, 1, len(bills))
+	assert.EqualValues(t, billIDs[0], bills[0].ID)
+
+	bill, err = stg.GetBill(groupID, billIDs[0])
+	assert.Nil(t, err)
+
+	bill.At = at.AddDate(0, 0, 3).Unix()
+
+	oldBill, err := stg.UpdateRecord(groupID, bill)
+	assert.Nil(t, err)
+	assert.EqualValues(t, at.Unix(), oldBill.At)
+
+	bills, err = stg.GetBillsEx(groupID, 2023, 11, 13, 2023, 11, 13)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(bills))
+	assert.EqualValues(t, billIDs[0], bills[0].ID)
+
+	err = stg.DeleteRecord(groupID, billID, 0)
+	assert.Nil(t, err)
+
+	deletedBills, err := stg.GetDeletedBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(deletedBills))
+
+	err = stg.RestoreDeletedBill(groupID, billID)
+	assert.Nil(t, err)
+
+	bills, err = stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, len(bills))
+
+	// reopen: the organization is read back from the database
+	stg, err = NewSQLiteStorage("sqlite", "sqlite/lifecost.db", false, nil)
+	assert.Nil(t, err)
+
+	name, err := stg.GetPersonName(personID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "zjz", name)
+}
+
+func TestMigrateToSQLite(t *testing.T) {
+	_ = os.RemoveAll("migrate")
+	stg := NewStorage("migrate", false, nil)
+
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	bill := model.GroupBill{
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          100,
+		At:              time.Now().Unix(),
+	}
+
+	billID, err := stg.Record(groupID, bill)
+	assert.Nil(t, err)
+
+	deletedBillID, err := stg.Record(groupID, bill)
+	assert.Nil(t, err)
+
+	err = stg.DeleteRecord(groupID, deletedBillID, 0)
+	assert.Nil(t, err)
+
+	count, err := MigrateToSQLite("migrate", "migrate/lifecost.db", nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, count)
+
+	_, err = MigrateToSQLite("migrate", "migrate/lifecost.db", nil)
+	assert.NotNil(t, err)
+
+	sqliteStg, err := NewSQLiteStorage("migrate", "migrate/lifecost.db", false, nil)
+	assert.Nil(t, err)
+
+	_, err = sqliteStg.GetBill(groupID, billID)
+	assert.Nil(t, err)
+
+	_, err = sqliteStg.GetDeletedBill(groupID, deletedBillID)
+	assert.Nil(t, err)
+
+	groupIDs, err := sqliteStg.GetPersonGroupsIDs(personID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []uint64{groupID}, groupIDs)
+
+	report, err := MigrateSQLiteSchema("migrate/lifecost.db", true, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, CurrentSchemaVersion, report.FromVersion)
+}
+
+func TestBillIndex(t *testing.T) {
+	_ = os.RemoveAll("index")
+	stg := NewStorage("index", false, nil)
+
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	at := time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local)
+
+	var billIDs []string
+
+	// out of order on purpose: the second bill of a day is recorded before the first one
+	for _, offset := range []time.Duration{time.Hour, 0, 24 * time.Hour, 48 * time.Hour} {
+		billID, e := stg.Record(groupID, model.GroupBill{
+			FromSubWalletID: walletID,
+			ToSubWalletID:   shopWalletID,
+			CostDir:         model.CostDirOut,
+			Amount:          100,
+			At:              at.Add(offset).Unix(),
+		})
+		assert.Nil(t, e)
+
+		billIDs = append(billIDs, billID)
+	}
+
+	for _, billID := range billIDs {
+		bill, e := stg.GetBill(groupID, billID)
+		assert.Nil(t, e)
+		assert.EqualValues(t, billID, bill.ID)
+	}
+
+	err = stg.DeleteRecord(groupID, billIDs[2], 0)
+	assert.Nil(t, err)
+
+	_, err = stg.GetBill(groupID, billIDs[2])
+	assert.NotNil(t, err)
+
+	// a new instance loads the index from the day files
+	stg = NewStorage("index", false, nil)
+
+	bills, hasMore, err := stg.GetBillsByID(groupID, "", 2, false)
+	assert.Nil(t, err)
+	assert.True(t, hasMore)
+	assert.EqualValues(t, []string{billIDs[3], billIDs[0]}, []string{bills[0].ID, bills[1].ID})
+
+	bills, hasMore, err = stg.GetBillsByID(groupID, billIDs[0], 2, false)
+	assert.Nil(t, err)
+	assert.False(t, hasMore)
+	assert.EqualValues(t, 1, len(bills))
+	assert.EqualValues(t, billIDs[1], bills[0].ID)
+
+	for _, billID := range []string{billIDs[0], billIDs[1], billIDs[3]} {
+		bill, e := stg.GetBill(groupID, billID)
+		assert.Nil(t, e)
+		assert.EqualValues(t, billID, bill.ID)
+	}
+}
+
+func TestRecoverBillFiles(t *testing.T) {
+	_ = os.RemoveAll("recover")
+	stg := NewStorage("recover", false, nil)
+
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	at := time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local)
+
+	for idx := 0; idx < 3; idx++ {
+		_, err = stg.Record(groupID, model.GroupBill{
+			FromSubWalletID: walletID,
+			ToSubWalletID:   shopWalletID,
+			CostDir:         model.CostDirOut,
+			Amount:          100,
+			At:              at.Add(time.Duration(idx) * time.Minute).Unix(),
+		})
+		assert.Nil(t, err)
+	}
+
+	// simulate a rewrite of an older version interrupted in the middle of the second line
+	filePath := filepath.Join("recover", "bills", fmt.Sprintf("%d-20231110", groupID))
+
+	d, err := os.ReadFile(filePath)
+	assert.Nil(t, err)
+
+	err = os.WriteFile(filePath+".bak", d, 0600)
+	assert.Nil(t, err)
+
+	err = os.WriteFile(filePath, d[:bytes.IndexByte(d, '\n')+10], 0600)
+	assert.Nil(t, err)
+
+	err = os.WriteFile(filePath+".tmp", []byte("garbage"), 0600)
+	assert.Nil(t, err)
+
+	stg = NewStorage("recover", false, nil)
+
+	// the readable day file wins, the .bak file is never merged in
+	bills, err := stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(bills))
+
+	_, err = os.Stat(filePath + ".bak")
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = os.Stat(filePath + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	// a finished rewrite is kept as is, the bills it removed are not brought back from the .bak file
+	err = os.WriteFile(filePath+".bak", d, 0600)
+	assert.Nil(t, err)
+
+	err = os.WriteFile(filePath, d[:bytes.IndexByte(d, '\n')+1], 0600)
+	assert.Nil(t, err)
+
+	stg = NewStorage("recover", false, nil)
+
+	bills, err = stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(bills))
+
+	_, err = os.Stat(filePath + ".bak")
+	assert.True(t, os.IsNotExist(err))
+
+	// a missing day file is restored from the .bak file
+	err = os.Remove(filePath)
+	assert.Nil(t, err)
+
+	err = os.WriteFile(filePath+".bak", d, 0600)
+	assert.Nil(t, err)
+
+	stg = NewStorage("recover", false, nil)
+
+	bills, err = stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, len(bills))
+
+	_, err = os.Stat(filePath + ".bak")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFileHandlesEviction(t *testing.T) {
+	_ = os.RemoveAll("handles")
+	stg := NewStorageEx("handles", false, Options{MaxOpenBillFiles: 2}, nil)
+
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	handles := stg.(*storageImpl).getGroupBills(groupID).(*billFileImpl).handles
+
+	at := time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local)
+
+	// the first days are written again after their files are evicted
+	for _, day := range []int{0, 1, 2, 3, 0, 1} {
+		_, err = stg.Record(groupID, model.GroupBill{
+			FromSubWalletID: walletID,
+			ToSubWalletID:   shopWalletID,
+			CostDir:         model.CostDirOut,
+			Amount:          100,
+			At:              at.AddDate(0, 0, day).Unix(),
+		})
+		assert.Nil(t, err)
+
+		assert.LessOrEqual(t, handles.openCount(), 2)
+	}
+
+	handles.evictIdle(time.Now().Add(billFileIdleTimeout))
+	assert.EqualValues(t, 0, handles.openCount())
+
+	bills, err := stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 6, len(bills))
+
+	bills, err = NewStorage("handles", false, nil).GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 6, len(bills))
+
+	// Close ends the evict routine
+	stopped := make(chan struct{})
+
+	go func() {
+		handles.evictRoutine()
+
+		close(stopped)
+	}()
+
+	stg.Close()
+
+	<-stopped
+}
+
+func TestCorruptBillLines(t *testing.T) {
+	_ = os.RemoveAll("corrupt")
+	stg := NewStorage("corrupt", false, nil)
+
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	at := time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local)
+
+	for idx := 0; idx < 2; idx++ {
+		_, err = stg.Record(groupID, model.GroupBill{
+			FromSubWalletID: walletID,
+			ToSubWalletID:   shopWalletID,
+			CostDir:         model.CostDirOut,
+			Amount:          100,
+			At:              at.Add(time.Duration(idx) * time.Minute).Unix(),
+		})
+		assert.Nil(t, err)
+	}
+
+	billsRoot := filepath.Join("corrupt", "bills")
+	filePath := filepath.Join(billsRoot, fmt.Sprintf("%d-20231110", groupID))
+
+	d, err := os.ReadFile(filePath)
+	assert.Nil(t, err)
+
+	// a malformed line in the middle and a torn tail
+	idx := bytes.IndexByte(d, '\n') + 1
+	d = append(append(append([]byte{}, d[:idx]...), []byte("{not json\n")...), d[idx:]...)
+	d = append(d, []byte(`{"id":"2023`)...)
+
+	err = os.WriteFile(filePath, d, 0600)
+	assert.Nil(t, err)
+
+	stg = NewStorage("corrupt", false, nil)
+
+	bills, err := stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(bills))
+
+	report, err := RepairBillFiles(billsRoot, nil, false, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(report.Problems))
+	assert.EqualValues(t, 2, report.Problems[0].BadLines)
+	assert.True(t, report.Problems[0].Broken)
+	assert.False(t, report.Problems[0].Repaired)
+
+	// a failed rewrite quarantines nothing, so the retry doesn't append the bad lines twice
+	assert.Nil(t, os.MkdirAll(filePath+tmpFileSuffix, os.ModePerm))
+
+	_, err = RepairBillFiles(billsRoot, nil, true, nil)
+	assert.NotNil(t, err)
+
+	_, err = os.Stat(filePath + quarantineFileSuffix)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, os.Remove(filePath+tmpFileSuffix))
+
+	report, err = RepairBillFiles(billsRoot, nil, true, nil)
+	assert.Nil(t, err)
+	assert.True(t, report.Problems[0].Repaired)
+
+	bad, err := os.ReadFile(filePath + quarantineFileSuffix)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "{not json\n{\"id\":\"2023\n", string(bad))
+
+	report, err = RepairBillFiles(billsRoot, nil, false, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(report.Problems))
+	assert.EqualValues(t, 2, report.Bills)
+}
+
+func TestMigrateSchema(t *testing.T) {
+	_ = os.RemoveAll("schema")
+	stg := NewStorage("schema", false, nil)
+
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	at := time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local)
+
+	var billIDs []string
+
+	for idx := 0; idx < 3; idx++ {
+		billID, e := stg.Record(groupID, model.GroupBill{
+			FromSubWalletID: walletID,
+			ToSubWalletID:   shopWalletID,
+			CostDir:         model.CostDirOut,
+			Amount:          100,
+			At:              at.Add(time.Duration(idx) * time.Minute).Unix(),
+		})
+		assert.Nil(t, e)
+
+		billIDs = append(billIDs, billID)
+	}
+
+	err = stg.DeleteRecord(groupID, billIDs[2], 0)
+	assert.Nil(t, err)
+
+	// turn the files back into the unversioned format
+	billsRoot := filepath.Join("schema", "bills")
+
+	for _, name := range []string{fmt.Sprintf("%d-20231110", groupID), fmt.Sprintf("%d-%s", groupID, deletedFileName)} {
+		d, e := os.ReadFile(filepath.Join(billsRoot, name))
+		assert.Nil(t, e)
+
+		err = os.WriteFile(filepath.Join(billsRoot, name), bytes.ReplaceAll(d, []byte(`"costDir"`), []byte(`"coastDir"`)), 0600)
+		assert.Nil(t, err)
+	}
+
+	report, err := MigrateSchema("schema", nil, true, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, report.FromVersion)
+	assert.EqualValues(t, CurrentSchemaVersion, report.ToVersion)
+	assert.EqualValues(t, 3, report.Steps[0].Bills)
+
+	_, err = os.Stat(filepath.Join("schema", schemaVersionFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	report, err = MigrateSchema("schema", nil, false, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, report.Steps[0].Bills)
+
+	report, err = MigrateSchema("schema", nil, false, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, CurrentSchemaVersion, report.FromVersion)
+	assert.EqualValues(t, 0, len(report.Steps))
+
+	stg = NewStorage("schema", false, nil)
+
+	bills, err := stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(bills))
+	assert.EqualValues(t, model.CostDirOut, bills[0].CostDir)
+
+	deletedBills, err := stg.GetDeletedBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(deletedBills))
+	assert.EqualValues(t, model.CostDirOut, deletedBills[0].CostDir)
+
+	err = os.WriteFile(filepath.Join("schema", schemaVersionFileName), []byte(`{"version":999}`), 0600)
+	assert.Nil(t, err)
+
+	_, err = MigrateSchema("schema", nil, false, nil)
+	assert.NotNil(t, err)
+}
+
+func TestEncryptDataDir(t *testing.T) {
+	_ = os.RemoveAll("encrypt")
+	stg := NewStorage("encrypt", false, nil)
+
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	at := time.Date(2023, 11, 10, 12, 0, 0, 0, time.Local)
+
+	var billIDs []string
+
+	for idx := 0; idx < 3; idx++ {
+		billID, e := stg.Record(groupID, model.GroupBill{
+			FromSubWalletID: walletID,
+			ToSubWalletID:   shopWalletID,
+			CostDir:         model.CostDirOut,
+			Amount:          100 + idx,
+			At:              at.Add(time.Duration(idx) * time.Minute).Unix(),
+		})
+		assert.Nil(t, e)
+
+		billIDs = append(billIDs, billID)
+	}
+
+	err = stg.DeleteRecord(groupID, billIDs[2], 0)
+	assert.Nil(t, err)
+
+	err = stg.SetIdempotencyResult(personID, "k", []byte("r"), time.Hour)
+	assert.Nil(t, err)
+
+	crypter, err := NewCrypter(bytes.Repeat([]byte{7}, encryptionKeySize))
+	assert.Nil(t, err)
+
+	assert.NotNil(t, CheckEncryption("encrypt", crypter))
+
+	count, err := EncryptDataDir("encrypt", crypter, nil, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 4, count) // day file, deleted bills, tmp data, organization
+
+	count, err = EncryptDataDir("encrypt", crypter, nil, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, count)
+
+	d, err := os.ReadFile(filepath.Join("encrypt", organizationFileName))
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(d, []byte("zjz")))
+
+	d, err = os.ReadFile(filepath.Join("encrypt", "bills", fmt.Sprintf("%d-20231110", groupID)))
+	assert.Nil(t, err)
+	assert.True(t, isSealedLine(d))
+
+	assert.NotNil(t, CheckEncryption("encrypt", nil))
+	assert.Nil(t, CheckEncryption("encrypt", crypter))
+
+	otherCrypter, err := NewCrypter(bytes.Repeat([]byte{8}, encryptionKeySize))
+	assert.Nil(t, err)
+	assert.NotNil(t, CheckEncryption("encrypt", otherCrypter))
+
+	stg = NewStorageEx("encrypt", false, Options{Crypter: crypter}, nil)
+
+	bill, err := stg.GetBill(groupID, billIDs[1])
+	assert.Nil(t, err)
+	assert.EqualValues(t, 101, bill.Amount)
+
+	// rewrites the day file
+	bill.Amount = 200
+	_, err = stg.UpdateRecord(groupID, bill)
+	assert.Nil(t, err)
+
+	_, err = stg.Record(groupID, model.GroupBill{
+		FromSubWalletID: walletID,
+		ToSubWalletID:   shopWalletID,
+		CostDir:         model.CostDirOut,
+		Amount:          300,
+		At:              at.Add(-time.Minute).Unix(),
+	})
+	assert.Nil(t, err)
+
+	stg = NewStorageEx("encrypt", false, Options{Crypter: crypter}, nil)
+
+	bills, err := stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int{300, 100, 200}, []int{bills[0].Amount, bills[1].Amount, bills[2].Amount})
+
+	deletedBills, err := stg.GetDeletedBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(deletedBills))
+
+	result, ok := stg.GetIdempotencyResult(personID, "k")
+	assert.True(t, ok)
+	assert.EqualValues(t, "r", string(result))
+
+	report, err := RepairBillFiles(filepath.Join("encrypt", "bills"), crypter, false, nil)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(report.Problems))
+	assert.EqualValues(t, 3, report.Bills)
+}
+
+func TestLeaveGroup(t *testing.T) {
+	_ = os.RemoveAll("leave-group")
+	stg := NewStorage("leave-group", false, nil)
+
+	zjzPersonID, _, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	zymPersonID, _, err := stg.NewPerson("zym")
+	assert.Nil(t, err)
+
+	homeGroupID, err := stg.NewGroup("home", zjzPersonID)
+	assert.Nil(t, err)
+
+	workGroupID, err := stg.NewGroup("work", zymPersonID)
+	assert.Nil(t, err)
+
+	assert.Nil(t, stg.JoinGroup(homeGroupID, zymPersonID))
+	assert.Nil(t, stg.LeaveGroup(homeGroupID, zymPersonID))
+
+	fnCheck := func(stg Storage) {
+		groupIDs, e := stg.GetPersonGroupsIDs(zymPersonID)
+		assert.Nil(t, e)
+		assert.EqualValues(t, []uint64{workGroupID}, groupIDs)
+
+		groupIDs, e = stg.GetPersonGroupsIDs(zjzPersonID)
+		assert.Nil(t, e)
+		assert.EqualValues(t, []uint64{homeGroupID}, groupIDs)
+	}
+
+	fnCheck(stg)
+
+	stg.Close()
+
+	stg = NewStorage("leave-group", false, nil)
+	fnCheck(stg)
+	stg.Close()
+
+	_ = os.RemoveAll("leave-group")
+}
+
+func TestQuiesce(t *testing.T) {
+	_ = os.RemoveAll("quiesce")
+	stg := NewStorage("quiesce", false, nil)
+
+	personID, walletID, err := stg.NewPerson("zjz")
+	assert.Nil(t, err)
+
+	groupID, err := stg.NewGroup("home", personID)
+	assert.Nil(t, err)
+
+	_, shopWalletID, err := stg.NewPerson("shop")
+	assert.Nil(t, err)
+
+	recorded := make(chan error, 1)
+	savedTmpData := make(chan error, 1)
+
+	err = stg.Quiesce(func() error {
+		go func() {
+			_, e := stg.Record(groupID, model.GroupBill{
+				FromSubWalletID: walletID,
+				ToSubWalletID:   shopWalletID,
+				CostDir:         model.CostDirOut,
+				Amount:          100,
+				At:              time.Now().Unix(),
+			})
+			recorded <- e
+		}()
+
+		select {
+		case <-recorded:
+			t.Fatal("record while quiesced")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		bills, e := stg.GetBills(groupID)
+		assert.Nil(t, e)
+		assert.EqualValues(t, 0, len(bills))
+
+		go func() {
+			savedTmpData <- stg.SetIdempotencyResult(personID, "key", []byte("result"), time.Minute)
+		}()
+
+		select {
+		case <-savedTmpData:
+			t.Fatal("save tmp data while quiesced")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		return nil
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, <-recorded)
+	assert.Nil(t, <-savedTmpData)
+
+	bills, err := stg.GetBills(groupID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(bills))
+
+	_ = os.RemoveAll("quiesce")
+}